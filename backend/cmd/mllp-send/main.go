@@ -0,0 +1,42 @@
+// mllp-send 把 HL7 消息文件通过 MLLP 发送到接口，打印返回的 ACK
+// 用法: go run ./cmd/mllp-send -addr localhost:2575 internal/hl7/testdata/adt_a04.hl7
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hospital-system/internal/hl7"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:2575", "MLLP 监听地址")
+	timeout := flag.Duration("timeout", 10*time.Second, "等待 ACK 的超时时间")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("请指定要发送的 HL7 消息文件")
+	}
+
+	for _, path := range flag.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("读取 %s 失败: %v", path, err)
+		}
+		// 文件里按行保存，HL7 段分隔符是 \r
+		text := strings.ReplaceAll(strings.TrimSpace(string(data)), "\r\n", "\n")
+		msg, err := hl7.Parse(strings.ReplaceAll(text, "\n", "\r"))
+		if err != nil {
+			log.Fatalf("解析 %s 失败: %v", path, err)
+		}
+
+		ack, err := hl7.Send(*addr, msg, *timeout)
+		if err != nil {
+			log.Fatalf("发送 %s 失败: %v", path, err)
+		}
+		fmt.Printf("== %s\n%s\n", path, strings.ReplaceAll(ack.String(), "\r", "\n"))
+	}
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"hospital-system/config"
 	"hospital-system/internal/api"
 	"hospital-system/internal/api/middleware"
+	"hospital-system/internal/authz"
 	"hospital-system/internal/database"
+	"hospital-system/internal/hl7"
 	"hospital-system/internal/model"
+	"hospital-system/internal/storage"
+	"hospital-system/internal/token"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,13 +23,54 @@ func main() {
 		log.Fatalf("无法加载配置文件: %v", err)
 	}
 
-	// 2. 初始化 JWT 密钥
-	middleware.InitAuth(config.AppConfig.Auth.JwtSecret)
+	// 2. 初始化 JWT 签名密钥 (支持多密钥轮换)
+	if err := token.Init(*config.AppConfig); err != nil {
+		log.Fatalf("无法加载 JWT 签名密钥: %v", err)
+	}
+
+	// 2.1 密码策略：加载常见 / 泄露密码列表
+	if err := api.LoadCommonPasswords(config.AppConfig.Password.CommonList); err != nil {
+		log.Printf("无法加载常见密码列表: %v", err)
+	}
 
 	// 3. 初始化数据库 (使用配置文件中的路径)
 	// 确保 config.yaml 里的路径是 "./storage/db/hospital.db"
 	database.InitDB(config.AppConfig.Database.Path)
 
+	// 3.0 同步内置角色与权限 (角色权限可在管理后台调整)
+	if err := authz.Init(database.DB); err != nil {
+		log.Fatalf("无法初始化角色权限: %v", err)
+	}
+
+	// 3.1 初始化附件存储 (默认放在数据库旁边的 storage/blobs)
+	blobPath := config.AppConfig.Storage.Path
+	if blobPath == "" {
+		blobPath = "./storage/blobs"
+	}
+	if err := storage.InitStorage(blobPath); err != nil {
+		log.Fatalf("无法初始化附件存储: %v", err)
+	}
+
+	// 3.2 HL7 v2 接口：出站推送 + 入站 MLLP 监听 (按配置启用)
+	hl7.InitSender(config.AppConfig.HL7.OutboundAddr)
+	if addr := config.AppConfig.HL7.ListenAddr; addr != "" {
+		go func() {
+			server := &hl7.Server{Addr: addr, Handler: api.HandleHL7Message}
+			if err := server.ListenAndServe(); err != nil {
+				log.Printf("HL7 MLLP 监听退出: %v", err)
+			}
+		}()
+	}
+
+	// 3.3 急诊分诊候诊超时提醒
+	go api.RunTriageMonitor(time.Minute)
+
+	// 3.4 住院床位费每日计费
+	go api.RunBedChargeAccrual(time.Hour)
+
+	// 3.5 复诊状态推进 (就诊完成 / 爽约提醒)，列表接口不再实时刷新，间隔不宜过长
+	go api.RunFollowUpMonitor(5 * time.Minute)
+
 	// 4. 初始化全局管理员(如果没有管理员，自动创建一个)
 	var adminCount int64
 	database.DB.Model(&model.User{}).Where("role = ?", "global_admin").Count(&adminCount)
@@ -34,7 +80,7 @@ func main() {
 			Username: "admin",
 			Password: "admin123", // 会自动加密
 			Role:     "global_admin",
-			OrgID:    1,
+			OrgID:    model.DefaultOrgID,
 		}
 		if err := database.DB.Create(&defaultAdmin).Error; err != nil {
 			log.Fatalf("初始化管理员失败: %v", err)
@@ -59,10 +105,26 @@ func main() {
 
 	// 1. 公开接口 (Public)
 	// 对应图中: /login, /register
+	// 签名公钥 (JWKS)，内部服务用来校验访问令牌
+	r.GET("/.well-known/jwks.json", api.GetJWKS)
+
 	auth := r.Group("/api/v1")
 	{
-		auth.POST("/login", api.LoginHandler)       // 登录获取 Token
-		auth.POST("/register", api.RegisterHandler) // 用户注册 (仅供演示或初始管理员用)
+		auth.POST("/login", api.LoginHandler)            // 登录获取 Token
+		auth.POST("/register", api.RegisterHandler)      // 用户注册 (仅供演示或初始管理员用)
+		auth.POST("/refresh", api.RefreshToken)          // 刷新令牌换发访问令牌
+		auth.POST("/login/mfa", api.LoginMFAVerify)      // 登录第二步：动态码 / 恢复码
+		auth.POST("/login/mfa/setup", api.LoginMFASetup) // 角色要求两步验证但未绑定：登录时绑定
+
+		// 统一身份认证 (OIDC 授权码模式；LDAP 走上面的 /login)
+		auth.GET("/sso/providers", api.GetSSOProviders)
+		auth.GET("/sso/oidc/login", api.OIDCLogin)
+		auth.GET("/sso/oidc/callback", api.OIDCCallback)
+		auth.POST("/sso/exchange", api.SSOExchange) // 一次性 sso_code 换 Token
+
+		// 候诊区叫号屏：凭屏幕令牌访问，只读且不含患者隐私
+		auth.GET("/display/:token", api.GetDisplayBoard)
+		auth.GET("/display/:token/stream", api.StreamDisplayBoard)
 	}
 
 	// 2. 受保护接口组 (Dashboard)
@@ -72,64 +134,168 @@ func main() {
 	{
 		// 对应 Module 6：获取首页统计数据
 		dash.GET("/stats", api.GetDashboardStats)
+
+		// 登录会话：退出登录、查看 / 退出所有设备
+		dash.POST("/logout", api.Logout)
+		dash.GET("/sessions", api.GetMySessions)
+		dash.DELETE("/sessions", api.RevokeMySessions)
+		dash.POST("/password", api.ChangePassword) // 修改本人密码
+
+		// 两步验证 (TOTP)：开启、关闭、重新生成恢复码
+		dash.GET("/mfa", api.GetMFAStatus)
+		dash.POST("/mfa/enroll", api.EnrollMFA)
+		dash.POST("/mfa/confirm", api.ConfirmMFA)
+		dash.POST("/mfa/recovery_codes", api.RegenerateRecoveryCodes)
+		dash.DELETE("/mfa", api.DisableMFA)
 		// 通用数据接口，所有登录用户都能获取医生列表
 		dash.GET("/doctors", api.GetDoctorList)
+		dash.GET("/permissions", api.GetMyPermissions)      // 当前用户的权限点 (前端菜单)
+		dash.POST("/events/ticket", api.CreateStreamTicket) // 推送通道的一次性票据 (30 秒内有效)
 
 		// [Group 1] 挂号业务 (/bookings)
 		// 对应图中: /bookings -> 预约就诊相关
 		booking := dash.Group("/bookings")
-		booking.Use(middleware.RoleMiddleware("general_user", "registration", "org_admin", "global_admin"))
+		booking.Use(middleware.RequirePermission("booking.read.own", "booking.read.all", "booking.create", "booking.cancel"))
 		{
-			booking.GET("/", api.GetBookings)    // 列表：显示所有挂号
-			booking.POST("/", api.CreateBooking) // 操作：新增挂号
+			booking.GET("/", middleware.RequirePermission("booking.read.own", "booking.read.all"), api.GetBookings) // 列表：显示所有挂号
+			booking.POST("/", middleware.RequirePermission("booking.create"), api.CreateBooking)                    // 操作：新增挂号
+			booking.PUT("/:id/cancel", middleware.RequirePermission("booking.cancel"), api.CancelBooking)           // 操作：退号
+			booking.POST("/:id/checkin", middleware.RequirePermission("booking.cancel"), api.CheckInBooking)        // 复诊预约当天签到
+		}
+
+		// [Group 1.1] 候诊队列 (/queue)
+		// 挂号台与医生工作台看到同一份队列
+		queue := dash.Group("/queue")
+		queue.Use(middleware.RequirePermission("queue.manage"))
+		{
+			queue.GET("/", api.GetQueue)
+			queue.GET("/stream", api.StreamQueue)            // 队列推送 (SSE)
+			queue.POST("/:id/requeue", api.RequeuePatient)   // 过号重排
+			queue.PUT("/:id/priority", api.SetQueuePriority) // 调整优先标志
+		}
+
+		// [Group 1.2] 急诊分诊 (/triage)
+		// 分诊挂号不占号源，按分级排在医生队列前面
+		triage := dash.Group("/triage")
+		triage.Use(middleware.RequirePermission("triage.manage"))
+		{
+			triage.POST("/", api.CreateTriage)
+			triage.GET("/overdue", api.GetOverdueTriage) // 候诊超时
+			triage.GET("/:id", api.GetTriageHistory)
+			triage.POST("/:id/retriage", api.Retriage) // 复评
+		}
+
+		// [Group 1.3] 叫号屏管理 (/displays)
+		displays := dash.Group("/displays")
+		displays.Use(middleware.RequirePermission("display.manage"))
+		{
+			displays.GET("/", api.GetDisplayScreens)
+			displays.POST("/", api.CreateDisplayScreen)
+			displays.PUT("/:id", api.UpdateDisplayScreen)
+			displays.DELETE("/:id", api.DeleteDisplayScreen)
 		}
 
 		// [Group 2] 缴费业务 (/payment)
 		// 对应图中: /payment -> 缴费入口
 		payment := dash.Group("/payment")
-		payment.Use(middleware.RoleMiddleware("general_user", "registration", "finance", "org_admin", "global_admin"))
+		payment.Use(middleware.RequirePermission("payment.read.own", "payment.read.all"))
+		{
+			payment.GET("/", api.GetUnpaidOrders)                                                                     // 列表：显示所有 Unpaid 订单
+			payment.POST("/", middleware.RequirePermission("payment.collect", "payment.pay.own"), api.ConfirmPayment) // 操作：点击“确认收费”
+			payment.GET("/history", api.GetPaidOrders)                                                                // 查缴费历史
+		}
+
+		// [Group 2.1] 预交金 (/deposits)
+		deposits := dash.Group("/deposits")
+		deposits.Use(middleware.RequirePermission("deposit.read"))
 		{
-			payment.GET("/", api.GetUnpaidOrders)      // 列表：显示所有 Unpaid 订单
-			payment.POST("/", api.ConfirmPayment)      // 操作：点击“确认收费”
-			payment.GET("/history", api.GetPaidOrders) // 查缴费历史
+			deposits.GET("/low", api.GetLowBalanceAccounts) // 余额不足提醒
+			deposits.GET("/:patient_id", api.GetDepositAccount)
+			deposits.GET("/:patient_id/statement", api.GetDepositStatement)                                         // 对账单
+			deposits.POST("/:patient_id/deposit", middleware.RequirePermission("deposit.manage"), api.TakeDeposit)  // 缴存
+			deposits.POST("/:patient_id/refund", middleware.RequirePermission("deposit.manage"), api.RefundDeposit) // 退款
 		}
 
 		// [Group 3] 财务分析 (/finance)
 		finance := dash.Group("/finance")
-		finance.Use(middleware.RoleMiddleware("finance", "org_admin", "global_admin"))
+		finance.Use(middleware.RequirePermission("finance.report"))
 		{
-			finance.GET("/stats", api.GetFinanceStats)     // 核心指标
-			finance.GET("/dept_stats", api.GetDeptRevenue) // 科室排名
+			finance.GET("/stats", api.GetFinanceStats)               // 核心指标
+			finance.GET("/dept_stats", api.GetDeptRevenue)           // 科室排名
+			finance.GET("/diagnosis_stats", api.GetDiagnosisRevenue) // 按诊断编码统计
+			finance.GET("/referral_stats", api.GetReferralStats)     // 转诊流向
 		}
 
 		// [Group 4] 医生工作台 (/doctor)
 		// 对应图中: /doctor -> 医生专用面板
 		doctor := dash.Group("/doctor")
-		doctor.Use(middleware.RoleMiddleware("doctor", "org_admin", "global_admin"))
+		doctor.Use(middleware.RequirePermission("consult.queue"))
 		{
-			doctor.GET("/patients", api.GetPendingPatients)          // 左侧：候诊列表 (Status=Pending)
-			doctor.POST("/medical_records", api.SubmitMedicalRecord) // 右侧：提交诊断 -> 生成订单
+			doctor.GET("/patients", api.GetPendingPatients)                                                                      // 左侧：候诊列表 (Status=Pending)
+			doctor.GET("/queue", api.GetDoctorQueue)                                                                             // 叫号队列
+			doctor.GET("/queue/stream", api.StreamDoctorQueue)                                                                   // 队列推送 (SSE)
+			doctor.POST("/queue/next", api.CallNextPatient)                                                                      // 叫下一位
+			doctor.POST("/queue/:id/recall", api.RecallPatient)                                                                  // 重呼
+			doctor.POST("/queue/:id/skip", api.SkipPatient)                                                                      // 过号
+			doctor.POST("/medical_records", middleware.RequirePermission("record.write"), api.SubmitMedicalRecord)               // 右侧：提交诊断 -> 生成订单
+			doctor.PUT("/medical_records/:id", middleware.RequirePermission("record.write"), api.UpdateDraftRecord)              // 修改草稿
+			doctor.POST("/medical_records/:id/sign", middleware.RequirePermission("record.write"), api.SignMedicalRecord)        // 签署
+			doctor.POST("/medical_records/:id/amendments", middleware.RequirePermission("record.write"), api.AmendMedicalRecord) // 修订已签署病历
+			doctor.POST("/lab_orders", middleware.RequirePermission("lab.order"), api.CreateLabOrders)                           // 开检验单
+			doctor.GET("/lab_results", middleware.RequirePermission("lab.order"), api.GetDoctorLabResults)                       // 检验结果提醒
+			doctor.POST("/referrals", middleware.RequirePermission("referral.manage"), api.CreateReferral)                       // 转诊
+			doctor.GET("/referrals", middleware.RequirePermission("referral.manage"), api.GetReferrals)                          // 转入/转出列表
+			doctor.GET("/referrals/:id", middleware.RequirePermission("referral.manage"), api.GetReferral)                       // 转诊详情 (含随附信息)
+			doctor.GET("/follow_ups", middleware.RequirePermission("followup.read"), api.GetFollowUps)                           // 复诊 / 爽约报表
+			doctor.POST("/lab_results/:id/ack", middleware.RequirePermission("lab.order"), api.AcknowledgeLabResult)             // 确认已查看
 		}
 
 		// [Group 5] 病历 (/medical_record)
 		// 对应图中: /medical_record -> 展示问诊记录
 		medical_record := dash.Group("/medical_record")
-		medical_record.Use(middleware.RoleMiddleware("general_user", "doctor", "registration", "finance", "org_admin", "global_admin"))
+		medical_record.Use(middleware.RequirePermission("record.read.own", "record.read.assigned", "record.read.all"))
 		{
 			medical_record.GET("/", api.GetMedicalRecords)
+			medical_record.GET("/:id/versions", api.GetRecordVersions) // 版本历史
+			medical_record.GET("/:id/diff", api.DiffRecordVersions)    // 版本对比
+			medical_record.GET("/:id/lab_results", api.GetRecordLabResults)
+
+			// 附件：查看权限与病历一致，上传需要书写病历的权限
+			medical_record.GET("/:id/attachments", api.GetAttachments)
+			medical_record.GET("/:id/attachments/:aid", api.DownloadAttachment)
+			medical_record.GET("/:id/attachments/:aid/thumbnail", api.GetAttachmentThumbnail)
+			medical_record.POST("/:id/attachments", middleware.RequirePermission("record.write"), api.UploadAttachment)
+		}
+
+		// [Group 5.0] 患者档案 (/patients)
+		// 时间轴与病历使用同一套查看权限
+		patients := dash.Group("/patients")
+		patients.Use(middleware.RequirePermission("record.read.own", "record.read.assigned", "record.read.all"))
+		{
+			patients.GET("/:id/timeline", api.GetPatientTimeline)
+			patients.GET("/review", middleware.RequirePermission("patient.all"), api.GetPatientsForReview) // 待人工核对合并的同名档案
+		}
+
+		// [Group 5.1] ICD-10 诊断字典 (/icd10)
+		icd := dash.Group("/icd10")
+		{
+			// 搜索/自动补全：医生开诊断、财务看报表都会用到
+			icd.GET("/", middleware.RequirePermission("icd.read"), api.SearchICD10)
+			// 导入字典
+			icd.POST("/import", middleware.RequirePermission("icd.import"), api.ImportICD10)
 		}
 
 		// [Group 6] 物资/库房 (/storehouse)
 		// 对应图中: /storehouse -> 物资管理
 		store := dash.Group("/storehouse")
 		{
-			// 1. 公共权限接口 (GET)：医生 + 库管 + 管理员
+			// 1. 公共权限接口 (GET)：医生开药也要查库存
 			// 这个接口权限比较宽，单独写
-			store.GET("/", middleware.RoleMiddleware("doctor", "storekeeper", "org_admin", "global_admin"), api.GetInventory)
+			store.GET("/", middleware.RequirePermission("inventory.read"), api.GetInventory)
 
-			// 2. 管理权限接口 (增/删/改)：仅库管 + 管理员
+			// 2. 管理权限接口 (增/删/改)
 			manage := store.Group("/")
-			manage.Use(middleware.RoleMiddleware("storekeeper", "org_admin", "global_admin"))
+			manage.Use(middleware.RequirePermission("inventory.adjust"))
 			{
 				manage.POST("/", api.AddOrUpdateInventoryItem)
 				manage.PUT("/:id", api.UpdateInventoryItem)
@@ -137,18 +303,129 @@ func main() {
 			}
 		}
 
+		// [Group 6.1] 检验科 (/lab)
+		// 对应图中: /lab -> 标本采集、结果录入
+		lab := dash.Group("/lab")
+		{
+			// 项目目录：医生开单时也要查
+			lab.GET("/tests", middleware.RequirePermission("lab.catalog.read"), api.GetLabTests)
+			lab.POST("/tests", middleware.RequirePermission("lab.catalog.manage"), api.SaveLabTest)
+
+			work := lab.Group("/orders")
+			work.Use(middleware.RequirePermission("lab.process"))
+			{
+				work.GET("/", api.GetLabWorklist)
+				work.POST("/:id/collect", api.CollectSpecimen)
+				work.POST("/:id/result", api.SubmitLabResult)
+			}
+		}
+
+		// [Group 6.2] 住院管理 (/inpatient)
+		inpatient := dash.Group("/inpatient")
+		inpatient.Use(middleware.RequirePermission("inpatient.read"))
+		{
+			inpatient.GET("/wards", api.GetWards) // 病区及床位占用
+			inpatient.GET("/admissions", api.GetAdmissions)
+			inpatient.GET("/admissions/:id", api.GetAdmission) // 详情 + 住院账户
+
+			// 入院、转床、出院：医生和住院处
+			ward := inpatient.Group("/")
+			ward.Use(middleware.RequirePermission("inpatient.manage"))
+			{
+				ward.POST("/admissions", api.AdmitPatient)
+				ward.POST("/admissions/:id/transfer", api.TransferBed)
+				ward.POST("/admissions/:id/discharge", api.DischargePatient)
+				ward.PUT("/beds/:id/status", api.SetBedStatus)
+			}
+
+			// 药品医嘱
+			inpatient.POST("/admissions/:id/drug_orders", middleware.RequirePermission("inpatient.order"), api.AddDrugOrder)
+
+			// 病区、床位维护
+			inpatient.POST("/wards", middleware.RequirePermission("ward.configure"), api.SaveWard)
+			inpatient.POST("/wards/:id/beds", middleware.RequirePermission("ward.configure"), api.AddBeds)
+		}
+
+		// [Group 6.1] 安全审计 (/security)
+		security := dash.Group("/security")
+		security.Use(middleware.RequirePermission("security.audit"))
+		{
+			security.GET("/events", api.GetSecurityEvents)
+		}
+
+		// [Group 6.3] 角色与权限 (/roles)
+		// 角色 = 一组权限点，修改后立即生效
+		roles := dash.Group("/roles")
+		roles.Use(middleware.RequirePermission("role.manage"))
+		{
+			roles.GET("/", api.GetRoles)
+			roles.GET("/permissions", api.GetPermissionCatalog) // 全部权限点
+			roles.POST("/", api.CreateRole)
+			roles.PUT("/:name", api.UpdateRole)
+			roles.DELETE("/:name", api.DeleteRole)
+			roles.POST("/:name/reset", api.ResetRole) // 内置角色恢复默认权限
+		}
+
+		// [Group 6.4] 机构 (/orgs)
+		// 列表所有登录用户可查 (只返回可见的机构)，增改需要 org.manage
+		orgs := dash.Group("/orgs")
+		{
+			orgs.GET("/", api.GetOrganizations)
+			orgs.POST("/", middleware.RequirePermission("org.manage"), api.CreateOrganization)
+			orgs.PUT("/:id", middleware.RequirePermission("org.manage"), api.UpdateOrganization)
+		}
+
 		// [Group 7] 用户管理 (/users)
-		// 权限: 仅限管理员
+		// 权限: user.manage
 		// 对应图中: /users -> 统一管理账号
 		admin := dash.Group("/users")
-		admin.Use(middleware.RoleMiddleware("org_admin", "global_admin"))
+		admin.Use(middleware.RequirePermission("user.manage"))
 		{
 			admin.GET("/", api.ManageUserStatus)
+			admin.GET("/lockouts", api.GetLoginLockouts)     // 登录锁定列表
+			admin.DELETE("/lockouts", api.ClearLoginLockout) // 解除用户名 / IP 锁定
 			admin.POST("/", api.CreateUser)
 			admin.PUT("/:id", api.UpdateUser)
 			admin.DELETE("/:id", api.DeleteUser)
+			admin.POST("/:id/revoke_sessions", api.RevokeUserSessions) // 强制下线
+			admin.POST("/:id/reset_password", api.ResetUserPassword)   // 重置密码 (下次登录需修改)
+			admin.POST("/:id/unlock", api.UnlockUser)                  // 解除账号锁定
+			admin.POST("/:id/reset_mfa", api.ResetUserMFA)             // 清除两步验证 (验证器丢失)
+
+			// 管理员角色授予审批 (需申请人以外的另一位管理员)
+			admin.GET("/role_grants", api.GetRoleGrants)
+			admin.POST("/role_grants/:id/approve", api.ApproveRoleGrant)
+			admin.POST("/role_grants/:id/reject", api.RejectRoleGrant) // 驳回 / 申请人撤回
 		}
 	}
 
+	// 2.1 实时事件推送 (/dashboard/events)
+	// EventSource / WebSocket 无法带请求头，先 POST /dashboard/events/ticket 换一次性票据，再用 ?ticket= 连接
+	stream := r.Group("/api/v1/dashboard/events")
+	stream.Use(middleware.StreamAuthMiddleware())
+	{
+		stream.GET("", api.StreamEvents)       // SSE
+		stream.GET("/ws", api.EventsWebSocket) // WebSocket
+	}
+
+	// 3. FHIR R4 接口 (对接区域卫生平台)
+	// 同样使用 JWT 认证，数据范围与病历接口一致
+	fhirR4 := r.Group("/fhir/r4")
+	fhirR4.Use(middleware.AuthMiddleware(), middleware.RequirePermission("fhir.read"))
+	{
+		fhirR4.GET("/Patient", api.FhirSearchPatients)
+		fhirR4.GET("/Patient/:id", api.FhirReadPatient)
+		fhirR4.GET("/Patient/:id/$everything", api.FhirPatientEverything) // 患者 Bundle 导出
+		fhirR4.GET("/Encounter", api.FhirSearch("Encounter"))
+		fhirR4.GET("/Condition", api.FhirSearch("Condition"))
+		fhirR4.GET("/Observation", api.FhirSearch("Observation"))
+		fhirR4.GET("/MedicationRequest", api.FhirSearch("MedicationRequest"))
+		fhirR4.GET("/ChargeItem", api.FhirSearch("ChargeItem"))
+		fhirR4.GET("/Invoice", api.FhirSearch("Invoice"))
+
+		// 批量导入患者
+		fhirR4.POST("/import", middleware.RequirePermission("fhir.import"), api.FhirImportPatients)
+	}
+
 	r.Run(":8080")
 }
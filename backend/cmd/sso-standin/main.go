@@ -0,0 +1,42 @@
+// sso-standin 本地联调用的目录服务 + OIDC 身份提供方，不要在生产环境使用
+//
+//	go run ./cmd/sso-standin
+//
+// 然后在 config.yaml 中打开 sso.ldap.enabled / sso.oidc.enabled (默认地址与这里一致)。
+// 演示账号 (密码均为 Standin-2026):
+//
+//	zhangsan  组 doctors，科室 内科
+//	lisi      组 finance
+//	wangwu    不属于任何映射组 (应被拒绝登录)
+//
+// 目录和身份提供方的实现在 internal/ssostandin，测试中直接在进程内启动
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"hospital-system/internal/ssostandin"
+)
+
+func main() {
+	ldapAddr := flag.String("ldap", ":3389", "LDAP 监听地址")
+	oidcAddr := flag.String("oidc", ":9000", "OIDC 监听地址")
+	issuer := flag.String("issuer", "http://127.0.0.1:9000", "OIDC issuer (须与 config.yaml 一致)")
+	clientID := flag.String("client-id", "hospital-system", "OIDC client_id")
+	clientSecret := flag.String("client-secret", "standin-secret", "OIDC client_secret")
+	flag.Parse()
+
+	srv := ssostandin.NewLDAPServer(*ldapAddr)
+	go func() { log.Fatal(srv.ListenAndServe()) }()
+
+	iss := strings.TrimRight(*issuer, "/")
+	idp, err := ssostandin.NewIdP(iss, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("OIDC 联调服务已启动: %s (issuer %s)", *oidcAddr, iss)
+	log.Fatal(http.ListenAndServe(*oidcAddr, idp.Handler()))
+}
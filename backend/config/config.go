@@ -16,12 +16,110 @@ type Config struct {
 		Path string `yaml:"path"`
 	} `yaml:"database"`
 
+	Storage struct {
+		Path        string `yaml:"path"`          // 附件存储目录
+		MaxUploadMB int    `yaml:"max_upload_mb"` // 单个附件大小上限
+	} `yaml:"storage"`
+
+	HL7 struct {
+		ListenAddr   string `yaml:"listen_addr"`   // MLLP 监听地址，为空则不启动
+		OutboundAddr string `yaml:"outbound_addr"` // HIS 的 MLLP 地址，挂号/退号时推送 ADT
+		Facility     string `yaml:"facility"`      // 本院在 MSH-4 中的标识
+		OrgID        uint   `yaml:"org_id"`        // 入站消息归属的机构，0 为默认机构
+	} `yaml:"hl7"`
+
+	Booking struct {
+		DoctorDailyLimit int `yaml:"doctor_daily_limit"` // 每位医生每日号源上限，0 表示不限 (急诊分诊不受限)
+	} `yaml:"booking"`
+
+	Triage struct {
+		MaxWaitMinutes []int `yaml:"max_wait_minutes"` // 1~5 级分诊的最长候诊时间 (分钟)，超时提醒
+	} `yaml:"triage"`
+
+	Deposit struct {
+		LowBalance float64 `yaml:"low_balance"` // 预交金余额低于该值时提醒
+	} `yaml:"deposit"`
+
+	Password struct {
+		MinLength  int    `yaml:"min_length"`  // 最短长度
+		MinClasses int    `yaml:"min_classes"` // 大写、小写、数字、符号中至少包含几类
+		CommonList string `yaml:"common_list"` // 常见 / 已泄露密码列表文件，每行一个
+	} `yaml:"password"`
+
+	Login struct {
+		MaxFailures        int `yaml:"max_failures"`         // 同一用户名连续失败多少次后锁定
+		IPMaxFailures      int `yaml:"ip_max_failures"`      // 同一 IP 连续失败多少次后锁定
+		LockoutMinutes     int `yaml:"lockout_minutes"`      // 首次锁定时长，之后每次翻倍 (最长 24 小时)
+		BackoffBaseSeconds int `yaml:"backoff_base_seconds"` // 第 n 次失败后需等待 base × 2^(n-1) 秒
+		WindowMinutes      int `yaml:"window_minutes"`       // 超过该时长没有失败，计数清零
+	} `yaml:"login"`
+
+	MFA struct {
+		Issuer        string   `yaml:"issuer"`         // 验证器 App 中显示的名称
+		RequiredRoles []string `yaml:"required_roles"` // 这些角色必须启用两步验证，未绑定的登录时先完成绑定
+	} `yaml:"mfa"`
+
+	SSO struct {
+		LDAP struct {
+			Enabled             bool   `yaml:"enabled"`
+			URL                 string `yaml:"url"`                  // ldap://host:389 或 ldaps://host:636
+			BindDN              string `yaml:"bind_dn"`              // 查找用户用的服务账号，为空则匿名查找
+			BindPassword        string `yaml:"bind_password"`        // 服务账号密码
+			BaseDN              string `yaml:"base_dn"`              // 用户所在子树
+			UserFilter          string `yaml:"user_filter"`          // 例如 (uid=%s)，%s 为转义后的登录名
+			GroupAttribute      string `yaml:"group_attribute"`      // 用户所属组，例如 memberOf
+			DepartmentAttribute string `yaml:"department_attribute"` // 科室，例如 departmentNumber
+		} `yaml:"ldap"`
+
+		OIDC struct {
+			Enabled         bool     `yaml:"enabled"`
+			Issuer          string   `yaml:"issuer"`
+			ClientID        string   `yaml:"client_id"`
+			ClientSecret    string   `yaml:"client_secret"`
+			RedirectURL     string   `yaml:"redirect_url"` // 本系统的回调地址 /api/v1/sso/oidc/callback
+			FrontendURL     string   `yaml:"frontend_url"` // 登录完成后带一次性 sso_code 跳回前端登录页
+			Scopes          []string `yaml:"scopes"`
+			UsernameClaim   string   `yaml:"username_claim"`   // 默认 preferred_username
+			GroupsClaim     string   `yaml:"groups_claim"`     // 默认 groups
+			DepartmentClaim string   `yaml:"department_claim"` // 默认 department
+		} `yaml:"oidc"`
+
+		RoleMapping []GroupMapping `yaml:"role_mapping"` // 目录组 → 角色 / 科室，按顺序取第一个匹配
+		DefaultRole string         `yaml:"default_role"` // 没有匹配的组时的角色，为空则拒绝登录
+		OrgID       uint           `yaml:"org_id"`       // 首次登录创建的账号归属的机构，0 为默认机构
+	} `yaml:"sso"`
+
+	Users struct {
+		Departments        []string `yaml:"departments"`          // 可选科室，账号的所属科室只能从中选择，为空则不校验
+		AdminGrantApproval bool     `yaml:"admin_grant_approval"` // 授予管理员角色需另一位管理员审批
+	} `yaml:"users"`
+
 	Auth struct {
-		JwtSecret      string `yaml:"jwt_secret"`
-		JwtExpireHours int    `yaml:"jwt_expire_hours"`
+		JwtSecret           string       `yaml:"jwt_secret"`            // HS256 默认密钥 (kid = default)
+		JwtExpireHours      int          `yaml:"jwt_expire_hours"`      // 登录会话 (刷新令牌) 有效期
+		AccessExpireMinutes int          `yaml:"access_expire_minutes"` // 访问令牌有效期，过期后凭刷新令牌换发
+		Issuer              string       `yaml:"issuer"`                // Token 的 iss，其他内部服务据此校验
+		ActiveKid           string       `yaml:"active_kid"`            // 当前签发用的密钥，为空则用 signing_keys 第一个 (再没有就用 jwt_secret)
+		SigningKeys         []SigningKey `yaml:"signing_keys"`          // 额外签名密钥，旧密钥保留在列表中继续验证
 	} `yaml:"auth"`
 }
 
+// SigningKey JWT 签名密钥
+type SigningKey struct {
+	Kid        string `yaml:"kid"`
+	Alg        string `yaml:"alg"`         // HS256, EdDSA, RS256
+	Secret     string `yaml:"secret"`      // HS256 共享密钥
+	PrivateKey string `yaml:"private_key"` // EdDSA/RS256 私钥 PEM 文件，不存在时自动生成
+	PublicKey  string `yaml:"public_key"`  // 只有公钥时该密钥只用于验证 (例如已停用的旧密钥)
+}
+
+// GroupMapping 目录组到本系统角色的映射
+type GroupMapping struct {
+	Group      string `yaml:"group"` // 组的完整 DN 或组名 (cn)，不区分大小写
+	Role       string `yaml:"role"`
+	Department string `yaml:"department"` // 为空则使用目录中的科室属性
+}
+
 var AppConfig *Config
 
 // LoadConfig 读取配置文件
@@ -0,0 +1,473 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 病历签署与修订 (Amendments) ---
+// 草稿可由作者直接修改；签署后病历不可变，更正只能以修订 (新版本) 的形式追加
+
+// RecordUpdateRequest 修改草稿病历 (整体覆盖临床内容)
+type RecordUpdateRequest struct {
+	ChiefComplaint string       `json:"chief_complaint"`
+	PresentIllness string       `json:"present_illness"`
+	PastHistory    string       `json:"past_history"`
+	PhysicalExam   string       `json:"physical_exam"`
+	Vitals         *VitalsInput `json:"vitals"`
+	Diagnosis      string       `json:"diagnosis"`
+	DiagnosisCodes []string     `json:"diagnosis_codes"`
+}
+
+// AmendRequest 修订已签署病历，只需传需要更正的字段，未传的字段沿用当前版本
+type AmendRequest struct {
+	Reason         string       `json:"reason" binding:"required"` // 修订原因 (必填)
+	ChiefComplaint *string      `json:"chief_complaint"`
+	PresentIllness *string      `json:"present_illness"`
+	PastHistory    *string      `json:"past_history"`
+	PhysicalExam   *string      `json:"physical_exam"`
+	Vitals         *VitalsInput `json:"vitals"`
+	Diagnosis      *string      `json:"diagnosis"`
+	DiagnosisCodes []string     `json:"diagnosis_codes"` // 传了就整体替换编码诊断
+}
+
+// RecordFieldChange 版本对比中的单个字段变化
+type RecordFieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// recordContent 生成病历当前版本的内容快照
+func recordContent(record model.MedicalRecord, diagnoses []model.MedicalRecordDiagnosis) model.RecordContent {
+	codes := make([]string, 0, len(diagnoses))
+	for _, d := range diagnoses {
+		codes = append(codes, d.Code)
+	}
+	return model.RecordContent{
+		ChiefComplaint: record.ChiefComplaint,
+		PresentIllness: record.PresentIllness,
+		PastHistory:    record.PastHistory,
+		PhysicalExam:   record.PhysicalExam,
+		Vitals:         record.Vitals,
+		Diagnosis:      record.Diagnosis,
+		DiagnosisCodes: codes,
+		Prescription:   record.Prescription,
+	}
+}
+
+// currentDiagnoses 读取病历当前版本的编码诊断
+func currentDiagnoses(tx *gorm.DB, record model.MedicalRecord) []model.MedicalRecordDiagnosis {
+	var diagnoses []model.MedicalRecordDiagnosis
+	tx.Where("record_id = ? AND record_version = ?", record.ID, record.Version).Order("sequence asc").Find(&diagnoses)
+	return diagnoses
+}
+
+// writeRecordVersion 追加一条版本快照
+func writeRecordVersion(tx *gorm.DB, record model.MedicalRecord, version int, diagnoses []model.MedicalRecordDiagnosis, authorID uint, reason string) error {
+	content, err := json.Marshal(recordContent(record, diagnoses))
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.MedicalRecordVersion{
+		OrgID:     record.OrgID,
+		RecordID:  record.ID,
+		Version:   version,
+		AuthorID:  authorID,
+		Reason:    reason,
+		Content:   string(content),
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// signRecord 签署病历：写入第 1 版快照并把状态改为 Signed
+func signRecord(tx *gorm.DB, record *model.MedicalRecord, authorID uint) error {
+	if err := writeRecordVersion(tx, *record, record.Version, currentDiagnoses(tx, *record), authorID, "签署"); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := tx.Model(record).Updates(map[string]interface{}{"status": "Signed", "signed_at": now}).Error; err != nil {
+		return err
+	}
+	record.Status = "Signed"
+	record.SignedAt = &now
+	return nil
+}
+
+// loadOwnRecord 读取当前医生有权修改的病历
+// 作者本人可以修改；历史病历没有作者时，由挂号单上的接诊医生负责
+func loadOwnRecord(c *gin.Context, tx *gorm.DB) (model.MedicalRecord, bool) {
+	var record model.MedicalRecord
+	id, ok := paramID(c, "id")
+	if !ok {
+		return record, false
+	}
+	if err := tx.First(&record, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "病历不存在"})
+		return record, false
+	}
+
+	userID := c.GetUint("user_id")
+	owner := record.DoctorID
+	if owner == 0 {
+		var booking model.Booking
+		tx.First(&booking, record.BookingID)
+		owner = booking.DoctorID
+	}
+	if owner != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能修改本人书写的病历"})
+		return record, false
+	}
+	return record, true
+}
+
+// UpdateDraftRecord 修改草稿病历
+// PUT /doctor/medical_records/:id
+func UpdateDraftRecord(c *gin.Context) {
+	var req RecordUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	vitals, err := req.Vitals.Normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := database.Scoped(c).Begin()
+
+	record, ok := loadOwnRecord(c, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+	if record.Status != "Draft" {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "病历已签署，只能通过修订更正"})
+		return
+	}
+
+	diagnoses, err := buildDiagnoses(tx, req.DiagnosisCodes)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Diagnosis == "" {
+		req.Diagnosis = diagnosisText(diagnoses)
+	}
+
+	// 草稿阶段直接替换编码诊断
+	if err := tx.Where("record_id = ?", record.ID).Delete(&model.MedicalRecordDiagnosis{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存病历失败"})
+		return
+	}
+	for i := range diagnoses {
+		diagnoses[i].OrgID = record.OrgID
+		diagnoses[i].RecordID = record.ID
+		diagnoses[i].RecordVersion = record.Version
+	}
+	if len(diagnoses) > 0 {
+		if err := tx.Create(&diagnoses).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存病历失败"})
+			return
+		}
+	}
+
+	record.ChiefComplaint = req.ChiefComplaint
+	record.PresentIllness = req.PresentIllness
+	record.PastHistory = req.PastHistory
+	record.PhysicalExam = req.PhysicalExam
+	record.Vitals = vitals
+	record.Diagnosis = req.Diagnosis
+	if err := tx.Omit("Diagnoses").Save(&record).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存病历失败"})
+		return
+	}
+
+	tx.Commit()
+	record.Diagnoses = diagnoses
+	c.JSON(http.StatusOK, gin.H{"msg": "草稿已保存", "data": record})
+}
+
+// SignMedicalRecord 签署病历，签署后不可再直接修改
+// POST /doctor/medical_records/:id/sign
+func SignMedicalRecord(c *gin.Context) {
+	tx := database.Scoped(c).Begin()
+
+	record, ok := loadOwnRecord(c, tx)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+	if record.Status != "Draft" {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "病历已签署"})
+		return
+	}
+	// 历史病历没有作者，签署人即成为作者
+	if record.DoctorID == 0 {
+		record.DoctorID = c.GetUint("user_id")
+		tx.Model(&record).Update("doctor_id", record.DoctorID)
+	}
+
+	if err := signRecord(tx, &record, record.DoctorID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "签署失败"})
+		return
+	}
+
+	tx.Commit()
+	record.Diagnoses = currentDiagnoses(database.Scoped(c), record)
+	c.JSON(http.StatusOK, gin.H{"msg": "病历已签署", "data": record})
+}
+
+// AmendMedicalRecord 修订已签署病历：追加新版本，旧版本完整保留
+// POST /doctor/medical_records/:id/amendments
+func AmendMedicalRecord(c *gin.Context) {
+	var req AmendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：必须填写修订原因"})
+		return
+	}
+
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	tx := database.Scoped(c).Begin()
+
+	var record model.MedicalRecord
+	if err := tx.First(&record, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "病历不存在"})
+		return
+	}
+	if record.Status != "Signed" {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "草稿病历请直接修改"})
+		return
+	}
+	// 作者或接诊医生可以修订
+	var booking model.Booking
+	tx.First(&booking, record.BookingID)
+	if record.DoctorID != userID && booking.DoctorID != userID {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权修订该病历"})
+		return
+	}
+
+	// 1. 组装新版本内容
+	next := record
+	next.Version = record.Version + 1
+	if req.ChiefComplaint != nil {
+		next.ChiefComplaint = *req.ChiefComplaint
+	}
+	if req.PresentIllness != nil {
+		next.PresentIllness = *req.PresentIllness
+	}
+	if req.PastHistory != nil {
+		next.PastHistory = *req.PastHistory
+	}
+	if req.PhysicalExam != nil {
+		next.PhysicalExam = *req.PhysicalExam
+	}
+	if req.Vitals != nil {
+		vitals, err := req.Vitals.Normalize()
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		next.Vitals = vitals
+	}
+	if req.Diagnosis != nil {
+		next.Diagnosis = *req.Diagnosis
+	}
+
+	diagnoses := currentDiagnoses(tx, record)
+	if req.DiagnosisCodes != nil {
+		var err error
+		diagnoses, err = buildDiagnoses(tx, req.DiagnosisCodes)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Diagnosis == nil {
+			next.Diagnosis = diagnosisText(diagnoses)
+		}
+	}
+
+	// 2. 先写版本快照，再以新版本号追加诊断，最后更新病历 (顺序由数据库触发器保证)
+	if err := writeRecordVersion(tx, next, next.Version, diagnoses, userID, req.Reason); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存修订失败"})
+		return
+	}
+	newDiagnoses := make([]model.MedicalRecordDiagnosis, 0, len(diagnoses))
+	for _, d := range diagnoses {
+		newDiagnoses = append(newDiagnoses, model.MedicalRecordDiagnosis{
+			OrgID:         record.OrgID,
+			RecordID:      record.ID,
+			RecordVersion: next.Version,
+			Code:          d.Code,
+			Description:   d.Description,
+			IsPrimary:     d.IsPrimary,
+			Sequence:      d.Sequence,
+		})
+	}
+	if len(newDiagnoses) > 0 {
+		if err := tx.Create(&newDiagnoses).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存修订失败"})
+			return
+		}
+	}
+	err := tx.Model(&record).Updates(map[string]interface{}{
+		"version":            next.Version,
+		"chief_complaint":    next.ChiefComplaint,
+		"present_illness":    next.PresentIllness,
+		"past_history":       next.PastHistory,
+		"physical_exam":      next.PhysicalExam,
+		"vital_systolic_bp":  next.Vitals.SystolicBP,
+		"vital_diastolic_bp": next.Vitals.DiastolicBP,
+		"vital_heart_rate":   next.Vitals.HeartRate,
+		"vital_temperature":  next.Vitals.Temperature,
+		"vital_sp_o2":        next.Vitals.SpO2,
+		"vital_weight":       next.Vitals.Weight,
+		"diagnosis":          next.Diagnosis,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存修订失败"})
+		return
+	}
+
+	tx.Commit()
+	next.Diagnoses = newDiagnoses
+	c.JSON(http.StatusOK, gin.H{"msg": "修订已保存", "data": next})
+}
+
+// findVisibleRecord 按病历列表同样的角色规则检查当前用户能否查看某份病历
+func findVisibleRecord(c *gin.Context, id string) (model.MedicalRecord, bool) {
+	var record model.MedicalRecord
+	db := database.Scoped(c).Table("medical_records").
+		Select("medical_records.*").
+		Joins("JOIN bookings ON bookings.id = medical_records.booking_id").
+		Where("medical_records.id = ?", id)
+
+	db, ok := scopeMedicalRecords(c, db)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return record, false
+	}
+	if err := db.Take(&record).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "病历不存在"})
+		return record, false
+	}
+	return record, true
+}
+
+// GetRecordVersions 病历版本历史
+// GET /medical_record/:id/versions
+func GetRecordVersions(c *gin.Context) {
+	record, ok := findVisibleRecord(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var versions []model.MedicalRecordVersion
+	database.Scoped(c).Where("record_id = ?", record.ID).Order("version asc").Find(&versions)
+	c.JSON(http.StatusOK, gin.H{"data": versions})
+}
+
+// DiffRecordVersions 对比两个版本的差异
+// GET /medical_record/:id/diff?from=1&to=2 (默认对比最新版本与上一版本)
+func DiffRecordVersions(c *gin.Context) {
+	record, ok := findVisibleRecord(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	to, err := strconv.Atoi(c.DefaultQuery("to", strconv.Itoa(record.Version)))
+	if err != nil || to < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "版本号无效"})
+		return
+	}
+	from, err := strconv.Atoi(c.DefaultQuery("from", strconv.Itoa(to-1)))
+	if err != nil || from < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "版本号无效"})
+		return
+	}
+
+	load := func(version int) (model.RecordContent, bool) {
+		var content model.RecordContent
+		// 版本 0 为首次签署前的空白病历：只有第 1 版时，与它比较即列出全部内容
+		if version == 0 {
+			return content, true
+		}
+		var v model.MedicalRecordVersion
+		if err := database.Scoped(c).Where("record_id = ? AND version = ?", record.ID, version).First(&v).Error; err != nil {
+			return content, false
+		}
+		return content, json.Unmarshal([]byte(v.Content), &content) == nil
+	}
+	fromContent, ok1 := load(from)
+	toContent, ok2 := load(to)
+	if !ok1 || !ok2 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"changes": diffContent(fromContent, toContent),
+	})
+}
+
+// diffContent 逐字段比较两个版本
+func diffContent(a, b model.RecordContent) []RecordFieldChange {
+	fa, fb := flattenContent(a), flattenContent(b)
+	changes := []RecordFieldChange{}
+	for i := range fa {
+		if fa[i][1] != fb[i][1] {
+			changes = append(changes, RecordFieldChange{Field: fa[i][0], From: fa[i][1], To: fb[i][1]})
+		}
+	}
+	return changes
+}
+
+// flattenContent 把病历内容展开成有序的 [字段, 值] 列表
+func flattenContent(r model.RecordContent) [][2]string {
+	return [][2]string{
+		{"chief_complaint", r.ChiefComplaint},
+		{"present_illness", r.PresentIllness},
+		{"past_history", r.PastHistory},
+		{"physical_exam", r.PhysicalExam},
+		{"vitals.systolic_bp", strconv.Itoa(r.Vitals.SystolicBP)},
+		{"vitals.diastolic_bp", strconv.Itoa(r.Vitals.DiastolicBP)},
+		{"vitals.heart_rate", strconv.Itoa(r.Vitals.HeartRate)},
+		{"vitals.temperature", fmt.Sprintf("%.1f", r.Vitals.Temperature)},
+		{"vitals.spo2", strconv.Itoa(r.Vitals.SpO2)},
+		{"vitals.weight", fmt.Sprintf("%.1f", r.Vitals.Weight)},
+		{"diagnosis", r.Diagnosis},
+		{"diagnosis_codes", fmt.Sprint(r.DiagnosisCodes)},
+		{"prescription", r.Prescription},
+	}
+}
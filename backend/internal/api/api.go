@@ -1,18 +1,29 @@
 package api
 
 import (
-	"hospital-system/internal/api/middleware"
+	"errors"
+	"fmt"
 	"hospital-system/internal/database"
 	"hospital-system/internal/model"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
+// paramID 解析路径中的数字 ID，非法时返回 400
+// 不要把 c.Param 的字符串直接传给 First/Delete：GORM 会把字符串主键当作 SQL 条件原样拼接
+func paramID(c *gin.Context, key string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(key), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID 无效"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
 // --- 认证模块 ---
 
 type LoginRequest struct {
@@ -25,6 +36,7 @@ type RegisterRequest struct {
 	Password   string `json:"password" binding:"required"`
 	Role       string `json:"role" binding:"required"`
 	Department string `json:"department"`
+	OrgID      uint   `json:"org_id"` // 所属机构：自助注册时选择就诊的院区；管理员创建用户时仅跨机构视图下可指定
 }
 
 func LoginHandler(c *gin.Context) {
@@ -34,42 +46,67 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	var user model.User
-	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+	// 失败次数过多：按用户名和 IP 限流 / 锁定
+	now := time.Now()
+	if wait := loginRetryAfter(req.Username, c.ClientIP(), now); wait > 0 {
+		logSecurityEvent(c, "login_blocked", req.Username, 0, fmt.Sprintf("需等待 %d 秒", int(wait.Seconds())+1))
+		tooManyAttempts(c, wait)
 		return
 	}
 
-	log.Printf("【调试】正在比对用户: %s", user.Username)
-	log.Printf("【调试】用户输入明文: %s", req.Password)
-	log.Printf("【调试】数据库存储哈希: %s", user.Password)
+	// 按账号来源选择身份源 (本地 bcrypt / LDAP)，见 sso.go
+	provider := loginProviderFor(req.Username)
+	user, err := provider.Authenticate(c, req.Username, req.Password)
+	var bad badCredentials
+	switch {
+	case errors.As(err, &bad):
+		loginFailed(c, req.Username, user.ID, provider.Name()+": "+string(bad), now)
+		return
+	case errors.Is(err, errProviderUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errAccountConflict), errors.Is(err, errNoRoleMapping):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
 
-	if !user.CheckPassword(req.Password) {
-		log.Println("【结果】密码比对失败！")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "密码错误"})
+	// 已启用 / 角色要求两步验证：只返回临时令牌，失败计数等动态码通过后再清除
+	if mfaChallenge(c, user) {
 		return
 	}
 
-	log.Println("【结果】密码比对成功")
+	if resp, ok := finishLogin(c, user, ""); ok {
+		c.JSON(http.StatusOK, resp)
+	}
+}
 
-	// 签发 Token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"org_id":  user.OrgID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
+// finishLogin 身份验证全部通过：清除失败计数，建立会话并签发 Token (短期访问令牌 + 刷新令牌)
+func finishLogin(c *gin.Context, user model.User, detail string) (gin.H, bool) {
+	resetLoginFailures(user.Username)
 
-	tokenString, err := token.SignedString(middleware.JwtKey)
+	resp, err := startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
-		return
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
-		"user":  gin.H{"username": user.Username, "role": user.Role, "id": user.ID},
-	})
+	resp["user"] = gin.H{"username": user.Username, "role": user.Role, "id": user.ID}
+	resp["must_change_password"] = user.MustChangePassword
+	logSecurityEvent(c, "login_success", user.Username, user.ID, detail)
+	return resp, true
+}
+
+// loginFailed 记录失败并返回统一的错误信息，达到上限时锁定
+func loginFailed(c *gin.Context, username string, userID uint, reason string, now time.Time) {
+	logSecurityEvent(c, "login_failed", username, userID, reason)
+	for _, t := range recordLoginFailure(username, c.ClientIP(), now) {
+		logSecurityEvent(c, "account_locked", username, userID,
+			fmt.Sprintf("%s 锁定至 %s", t.Key, t.LockedUntil.Format("2006-01-02 15:04:05")))
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 }
 
 func RegisterHandler(c *gin.Context) {
@@ -80,19 +117,33 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
+	if err := checkPassword(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 院区未选择时归入默认机构
+	if req.OrgID == 0 {
+		req.OrgID = model.DefaultOrgID
+	} else if !orgExists(req.OrgID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errOrgNotFound.Error()})
+		return
+	}
+
 	// 2. 手动构建 model.User 对象
 	user := model.User{
 		Username: req.Username,
 		Password: req.Password,   // 此时 req.Password 是有值的！
 		Role:     "general_user", // 强制指定角色
-		OrgID:    1,              //默认主院区
+		OrgID:    req.OrgID,
 	}
 
-	// 3. 执行写入 (BeforeCreate 会自动加密 user.Password)
+	// 3. 执行写入 (BeforeSave 会自动加密 user.Password)
 	if err := database.DB.Create(&user).Error; err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "注册失败，用户名已存在"})
 		return
 	}
+	logSecurityEvent(c, "user_registered", user.Username, user.ID, "")
 
 	c.JSON(http.StatusOK, gin.H{"msg": "注册成功"})
 }
@@ -107,31 +158,34 @@ type BookingRequest struct {
 	Gender      string `json:"gender"`
 	Department  string `json:"department" binding:"required"`
 	DoctorID    uint   `json:"doctor_id"`
-	// Phone    string `json:"phone"` // 暂不存手机号，以免数据库报错，除非你在 model 里加了 Phone
+	Phone       string `json:"phone"`    // 存入患者档案，不存挂号单
+	IDCard      string `json:"id_card"`  // 身份证号，用于识别同名患者
+	Priority    string `json:"priority"` // 优先标志 (仅挂号员可指定): emergency, elderly, revisit
 }
 
 // GetBookings 获取挂号列表
 func GetBookings(c *gin.Context) {
 	// 1. 从中间件上下文中获取当前用户信息
 	// 注意：必须确保 AuthMiddleware 里正确设置了这些值
-	role := c.GetString("role")
 	userID := c.GetUint("user_id") // 假设中间件里 set 的是 uint
 
 	var bookings []model.Booking
-	tx := database.DB.Order("created_at desc")
+	tx := database.Scoped(c).Order("created_at desc")
 
 	// 2. 权限分流
-	if role == "general_user" {
+	var patientName string
+	if !can(c, "booking.read.all") {
 		// 【核心逻辑】如果是普通用户，必须先查出他的名字，然后只返回属于他的记录
 		var currentUser model.User
-		if err := database.DB.First(&currentUser, userID).Error; err != nil {
+		if err := database.Scoped(c).First(&currentUser, userID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "无法获取用户信息"})
 			return
 		}
 		// 强制加上 WHERE 条件
 		tx = tx.Where("patient_name = ?", currentUser.Username)
+		patientName = currentUser.Username
 	}
-	// 如果是 registration/admin，则不加 Where 条件，默认查所有
+	// 有 booking.read.all (挂号员/管理员) 则不加 Where 条件，默认查所有
 
 	// 3. 执行查询
 	if err := tx.Find(&bookings).Error; err != nil {
@@ -139,7 +193,7 @@ func GetBookings(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": bookings})
+	c.JSON(http.StatusOK, gin.H{"data": bookings, "follow_ups": upcomingFollowUps(database.Scoped(c), patientName)})
 }
 
 // CreateBooking
@@ -151,7 +205,6 @@ func CreateBooking(c *gin.Context) {
 	}
 
 	// 1. 获取当前用户身份
-	role := c.GetString("role")
 	userID := c.GetUint("user_id")
 
 	// 2. 构建对象
@@ -165,10 +218,10 @@ func CreateBooking(c *gin.Context) {
 	}
 
 	// 3. 【核心逻辑】姓名处理
-	if role == "general_user" {
+	if !can(c, "booking.manage") {
 		// 如果是患者，强制使用当前登录账号的用户名，忽略前端传来的 PatientName
 		var currentUser model.User
-		database.DB.First(&currentUser, userID)
+		database.Scoped(c).First(&currentUser, userID)
 		booking.PatientName = currentUser.Username
 	} else {
 		// 如果是挂号员，允许使用前端传来的名字（帮别人挂号）
@@ -177,6 +230,12 @@ func CreateBooking(c *gin.Context) {
 			return
 		}
 		booking.PatientName = req.PatientName
+
+		if !validPriorities[req.Priority] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "优先标志只能是 emergency、elderly、revisit 或空"})
+			return
+		}
+		booking.Priority = req.Priority
 	}
 
 	// 4. 兜底医生ID
@@ -185,19 +244,95 @@ func CreateBooking(c *gin.Context) {
 		booking.DoctorID = 1
 	}
 
-	if err := database.DB.Create(&booking).Error; err != nil {
+	// 5. 关联患者档案 (患者本人挂号时按登录账号关联)
+	info := model.PatientInfo{
+		Name:      booking.PatientName,
+		IDCard:    req.IDCard,
+		Phone:     req.Phone,
+		Gender:    req.Gender,
+		BirthYear: model.BirthYearOf(req.Age, time.Now()),
+	}
+	if !can(c, "booking.manage") {
+		info.UserID = userID
+	}
+	patient, err := model.FindOrCreatePatient(homeOrg(c), info)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "建立患者档案失败"})
+		return
+	}
+	booking.PatientID = patient.ID
+
+	// 6. 分配排队号并保存，顺带关联待预约的复诊
+	if err := createQueuedBooking(homeOrg(c), &booking, true, func(tx *gorm.DB) error {
+		return linkFollowUp(tx, booking)
+	}); err != nil {
+		if errors.Is(err, errNoCapacity) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "挂号失败"})
 		return
 	}
 
+	publishQueue("booking.created", booking)
+	publishBookingADT(booking, "A04")
 	c.JSON(http.StatusOK, gin.H{"message": "挂号成功", "data": booking})
 }
 
+// CancelBooking 退号 (仅限候诊中的挂号单或未签到的复诊预约)
+// 对应路由: PUT /bookings/:id/cancel
+func CancelBooking(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var booking model.Booking
+	if err := database.Scoped(c).First(&booking, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "挂号单不存在"})
+		return
+	}
+
+	// 普通用户只能退自己的号
+	if !can(c, "booking.manage") {
+		var currentUser model.User
+		database.Scoped(c).First(&currentUser, c.GetUint("user_id"))
+		if booking.PatientName != currentUser.Username {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能取消本人的挂号"})
+			return
+		}
+	}
+	if booking.Status != "Pending" && booking.Status != "Scheduled" {
+		c.JSON(http.StatusConflict, gin.H{"error": "该挂号单已就诊或已取消"})
+		return
+	}
+
+	queued := booking.Status == "Pending"
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&booking).Update("status", "Cancelled").Error; err != nil {
+			return err
+		}
+		// 复诊挂号单退号后，复诊回到待预约状态
+		return tx.Model(&model.FollowUp{}).Where("booking_id = ? AND status = ?", booking.ID, "Booked").
+			Updates(map[string]interface{}{"booking_id": 0, "status": "Open"}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退号失败"})
+		return
+	}
+
+	booking.Status = "Cancelled"
+	if queued {
+		publishQueue("booking.cancelled", booking)
+	}
+	publishBookingADT(booking, "A11")
+	c.JSON(http.StatusOK, gin.H{"msg": "已退号"})
+}
+
 // GetDoctorList 专门用于下拉框的医生列表接口 (公开给登录用户)
 func GetDoctorList(c *gin.Context) {
 	var doctors []model.User
 	// GORM 默认 select *，所以只要结构体里有 Department，就会查出来
-	database.DB.Where("role = ?", "doctor").Find(&doctors)
+	database.Scoped(c).Where("role = ?", "doctor").Find(&doctors)
 	c.JSON(http.StatusOK, gin.H{"data": doctors})
 }
 
@@ -214,14 +349,13 @@ type OrderDetail struct {
 
 // GetUnpaidOrders 获取待缴费订单
 func GetUnpaidOrders(c *gin.Context) {
-	role := c.GetString("role")
 	userID := c.GetUint("user_id")
 
 	var results []OrderDetail
 
 	// 2. 连表查询 (Orders + Bookings + Medicines)
 	// 使用 LEFT JOIN medicines，防止如果药品被删除了导致订单查不出来
-	db := database.DB.Table("orders").
+	db := database.Scoped(c).Table("orders").
 		Select("orders.*, bookings.patient_name, medicines.name as medicine_name, medicines.price as medicine_price").
 		Joins("JOIN bookings ON bookings.id = orders.booking_id").
 		Joins("LEFT JOIN medicines ON medicines.id = orders.medicine_id").
@@ -229,17 +363,17 @@ func GetUnpaidOrders(c *gin.Context) {
 		Order("orders.created_at desc")
 
 	// 权限判断
-	if role == "general_user" {
+	if !can(c, "payment.read.all") {
 		// 1. 如果是普通用户，只能查 Booking.PatientName == 当前用户名
 		var currentUser model.User
-		if err := database.DB.First(&currentUser, userID).Error; err != nil {
+		if err := database.Scoped(c).First(&currentUser, userID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
 			return
 		}
 		// 核心过滤：只看自己的名字
 		db = db.Where("bookings.patient_name = ?", currentUser.Username)
 	}
-	// 2. 如果是 registration/finance/admin，不加额外 Where 条件，即查询所有
+	// 2. 有 payment.read.all (收费/财务/管理员)，不加额外 Where 条件，即查询所有
 
 	if err := db.Scan(&results).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单失败"})
@@ -251,22 +385,21 @@ func GetUnpaidOrders(c *gin.Context) {
 
 // GetPaidOrders 获取历史记录
 func GetPaidOrders(c *gin.Context) {
-	role := c.GetString("role")
 	userID := c.GetUint("user_id")
 
 	var results []OrderDetail
 
 	// 同样的连表逻辑
-	db := database.DB.Table("orders").
+	db := database.Scoped(c).Table("orders").
 		Select("orders.*, bookings.patient_name, medicines.name as medicine_name, medicines.price as medicine_price").
 		Joins("JOIN bookings ON bookings.id = orders.booking_id").
 		Joins("LEFT JOIN medicines ON medicines.id = orders.medicine_id").
 		Where("orders.status = ?", "Paid").
 		Order("orders.updated_at desc") // 按支付时间倒序
 
-	if role == "general_user" {
+	if !can(c, "payment.read.all") {
 		var currentUser model.User
-		database.DB.First(&currentUser, userID)
+		database.Scoped(c).First(&currentUser, userID)
 		db = db.Where("bookings.patient_name = ?", currentUser.Username)
 	}
 
@@ -279,7 +412,8 @@ func GetPaidOrders(c *gin.Context) {
 }
 
 type PaymentRequest struct {
-	OrderID uint `json:"order_id"`
+	OrderID   uint   `json:"order_id"`
+	PayMethod string `json:"pay_method"` // 为 deposit 时从患者预交金扣款
 }
 
 func ConfirmPayment(c *gin.Context) {
@@ -289,7 +423,13 @@ func ConfirmPayment(c *gin.Context) {
 		return
 	}
 
-	tx := database.DB.Begin() // 开启事务
+	// 预交金扣款串行执行，保证余额在并发缴费下一致
+	if req.PayMethod == "deposit" {
+		ledgerMu.Lock()
+		defer ledgerMu.Unlock()
+	}
+
+	tx := database.Scoped(c).Begin() // 开启事务
 
 	// 1. 查找订单
 	var order model.Order
@@ -305,16 +445,45 @@ func ConfirmPayment(c *gin.Context) {
 		return
 	}
 
-	// 2. 更新订单状态
-	if err := tx.Model(&order).Update("status", "Paid").Error; err != nil {
+	// 没有收费权限的 (患者自助缴费) 只能支付本人的订单
+	if !can(c, "payment.collect") {
+		var currentUser model.User
+		var booking model.Booking
+		if tx.First(&currentUser, c.GetUint("user_id")).Error != nil ||
+			tx.First(&booking, order.BookingID).Error != nil || booking.PatientName != currentUser.Username {
+			tx.Rollback()
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能支付本人的订单"})
+			return
+		}
+	}
+
+	// 2. 更新订单状态 (条件更新，防止同一订单被重复支付)
+	res := tx.Model(&order).Where("status = ?", "Unpaid").Update("status", "Paid")
+	if res.Error != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
 		return
 	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已支付"})
+		return
+	}
+
+	// 2.1 预交金扣款
+	var entry model.DepositEntry
+	if req.PayMethod == "deposit" {
+		var err error
+		if entry, err = payFromDeposit(tx, order, c.GetUint("user_id")); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// 3. 扣减库存 (如果订单关联了药品)
+	var med model.InventoryItem
 	if order.MedicineID != 0 {
-		var med model.InventoryItem
 		if err := tx.First(&med, order.MedicineID).Error; err == nil {
 			if med.Stock >= order.Quantity {
 				tx.Model(&med).Update("stock", med.Stock-order.Quantity)
@@ -327,6 +496,17 @@ func ConfirmPayment(c *gin.Context) {
 	}
 
 	tx.Commit()
+
+	order.Status = "Paid"
+	publishOrderPaid(order)
+	if med.ID != 0 {
+		publishStockLow(med)
+	}
+	if entry.ID != 0 {
+		checkLowBalance(entry)
+		c.JSON(http.StatusOK, gin.H{"msg": "支付成功，已从预交金扣款", "balance": entry.BalanceAfter})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"msg": "支付成功，库存已更新"})
 }
 
@@ -337,17 +517,17 @@ func ConfirmPayment(c *gin.Context) {
 func GetFinanceStats(c *gin.Context) {
 	// A. 总收入
 	var totalIncome float64
-	database.DB.Model(&model.Order{}).Where("status = ?", "Paid").Select("sum(total_amount)").Row().Scan(&totalIncome)
+	database.Scoped(c).Model(&model.Order{}).Where("status = ?", "Paid").Select("sum(total_amount)").Row().Scan(&totalIncome)
 
 	// B. 今日收入 (SQLite date函数写法)
 	var todayIncome float64
-	database.DB.Model(&model.Order{}).
+	database.Scoped(c).Model(&model.Order{}).
 		Where("status = ? AND date(created_at) = date('now')", "Paid").
 		Select("sum(total_amount)").Row().Scan(&todayIncome)
 
 	// C. 订单总数
 	var orderCount int64
-	database.DB.Model(&model.Order{}).Where("status = ?", "Paid").Count(&orderCount)
+	database.Scoped(c).Model(&model.Order{}).Where("status = ?", "Paid").Count(&orderCount)
 
 	c.JSON(http.StatusOK, gin.H{
 		"total_income": totalIncome,
@@ -372,7 +552,7 @@ type DeptRevenue struct {
 func GetDeptRevenue(c *gin.Context) {
 	var results []DeptRevenue
 	// SQL: SELECT b.department, SUM(o.total_amount) as total FROM orders o JOIN bookings b ON o.booking_id = b.id WHERE o.status='Paid' GROUP BY b.department
-	database.DB.Table("orders").
+	database.Scoped(c).Table("orders").
 		Select("bookings.department, sum(orders.total_amount) as total").
 		Joins("JOIN bookings ON bookings.id = orders.booking_id").
 		Where("orders.status = ?", "Paid").
@@ -389,25 +569,24 @@ func GetDeptRevenue(c *gin.Context) {
 // GetPendingPatients 获取候诊列表
 func GetPendingPatients(c *gin.Context) {
 	userID := c.GetUint("user_id") // 从 Token 中获取当前医生 ID
-	role := c.GetString("role")    // 获取角色
 
 	var bookings []model.Booking
 
-	// 1. 基础查询：状态必须是 Pending，按时间排序
-	tx := database.DB.Where("status = ?", "Pending").Order("created_at asc")
+	// 1. 基础查询：状态必须是 Pending，按优先级和排队号排序
+	tx := database.Scoped(c).Where("status = ?", "Pending").Order(queueOrder)
 
 	// 2. 权限分流
-	if role == "doctor" {
-		// 核心逻辑：医生只能看分配给自己的患者
+	if !can(c, "patient.all") {
+		// 核心逻辑：医生只能看分配给自己的患者 (以及本科室候诊池里未指定医生的转诊患者)
 		// 这样既实现了“科室隔离”（因为你不能被分配到别科的单子），也实现了“人维度隔离”
-		tx = tx.Where("doctor_id = ?", userID)
+		tx = doctorQueueScope(tx, userID)
 
 		// 扩展思路：如果你希望同一个科室的医生能看到彼此的病人（科室池模式），
 		// 可以改成先查出医生的 Department，然后 tx.Where("department = ?", doc.Department)
 		// 但基于“先选医生”的设计，按 doctor_id 过滤是最严谨的。
 	}
 
-	// 如果是 admin，则不加 doctor_id 限制，可以看到全院候诊情况
+	// 有 patient.all (管理员)，则不加 doctor_id 限制，可以看到全院候诊情况
 
 	// 3. 执行查询
 	if err := tx.Find(&bookings).Error; err != nil {
@@ -420,10 +599,18 @@ func GetPendingPatients(c *gin.Context) {
 
 // 这里的结构体定义可以保留在外面，也可以放里面，这里沿用你的定义
 type RecordRequest struct {
-	BookingID  uint   `json:"booking_id"`
-	Diagnosis  string `json:"diagnosis"`
-	MedicineID uint   `json:"medicine_id"` // 开什么药
-	Quantity   int    `json:"quantity"`    // 开多少
+	BookingID      uint           `json:"booking_id"`
+	ChiefComplaint string         `json:"chief_complaint"` // 主诉
+	PresentIllness string         `json:"present_illness"` // 现病史
+	PastHistory    string         `json:"past_history"`    // 既往史
+	PhysicalExam   string         `json:"physical_exam"`   // 体格检查
+	Vitals         *VitalsInput   `json:"vitals"`          // 生命体征 (可选)
+	Diagnosis      string         `json:"diagnosis"`
+	DiagnosisCodes []string       `json:"diagnosis_codes"` // ICD-10 编码，第一个为主诊断
+	MedicineID     uint           `json:"medicine_id"`     // 开什么药
+	Quantity       int            `json:"quantity"`        // 开多少
+	Sign           bool           `json:"sign"`            // 是否直接签署 (否则保存为草稿)
+	FollowUp       *FollowUpInput `json:"follow_up"`       // 复诊医嘱 (可选)，如 {"days": 14}
 }
 
 // SubmitMedicalRecord 提交诊断
@@ -434,22 +621,67 @@ func SubmitMedicalRecord(c *gin.Context) {
 		return
 	}
 
-	tx := database.DB.Begin() // 开启事务
+	vitals, err := req.Vitals.Normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// 1. 检查并锁定药品（获取价格）
+	var dueDate string
+	if req.FollowUp != nil {
+		if dueDate, err = req.FollowUp.DueDate(time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tx := database.Scoped(c).Begin() // 开启事务
+
+	// 病历、诊断、缴费单、复诊都归属挂号单的机构 (全局管理员跨机构视图下也不能记到自己的机构)
+	var booking model.Booking
+	if err := tx.First(&booking, req.BookingID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "挂号单不存在"})
+		return
+	}
+
+	// 1. 检查并锁定药品（获取价格），只能开本机构库房的药品
 	var med model.InventoryItem
-	if err := tx.First(&med, req.MedicineID).Error; err != nil {
+	if err := tx.Where("org_id = ?", booking.OrgID).First(&med, req.MedicineID).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "药品不存在，请检查药品ID"})
 		return
 	}
 
-	// 2. 保存病历
+	// 2. 校验 ICD-10 编码诊断
+	diagnoses, err := buildDiagnoses(tx, req.DiagnosisCodes)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Diagnosis == "" {
+		req.Diagnosis = diagnosisText(diagnoses)
+	}
+
+	// 3. 保存病历 (编码诊断随病历一起写入)
+	for i := range diagnoses {
+		diagnoses[i].OrgID = booking.OrgID
+	}
 	record := model.MedicalRecord{
-		BookingID:    req.BookingID,
-		Diagnosis:    req.Diagnosis,
-		Prescription: "Rx: " + med.Name + " x " + strconv.Itoa(req.Quantity), // 优化：把药名写进处方
-		CreatedAt:    time.Now(),
+		OrgID:          booking.OrgID,
+		BookingID:      req.BookingID,
+		DoctorID:       c.GetUint("user_id"), // 当前登录医生即病历作者
+		Status:         "Draft",
+		ChiefComplaint: req.ChiefComplaint,
+		PresentIllness: req.PresentIllness,
+		PastHistory:    req.PastHistory,
+		PhysicalExam:   req.PhysicalExam,
+		Vitals:         vitals,
+		Diagnosis:      req.Diagnosis,
+		Diagnoses:      diagnoses,
+		Prescription:   "Rx: " + med.Name + " x " + strconv.Itoa(req.Quantity), // 优化：把药名写进处方
+		CreatedAt:      time.Now(),
 	}
 	if err := tx.Create(&record).Error; err != nil {
 		tx.Rollback()
@@ -457,7 +689,15 @@ func SubmitMedicalRecord(c *gin.Context) {
 		return
 	}
 
-	// 3. 更新挂号状态 -> Completed (已就诊)
+	if req.Sign {
+		if err := signRecord(tx, &record, record.DoctorID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "签署病历失败"})
+			return
+		}
+	}
+
+	// 4. 更新挂号状态 -> Completed (已就诊)
 	// 修正：状态改成 "Completed" (大写C)
 	if err := tx.Model(&model.Booking{}).Where("id = ?", req.BookingID).Update("status", "Completed").Error; err != nil {
 		tx.Rollback()
@@ -465,8 +705,9 @@ func SubmitMedicalRecord(c *gin.Context) {
 		return
 	}
 
-	// 4. 生成缴费单 (Unpaid)
+	// 5. 生成缴费单 (Unpaid)
 	order := model.Order{
+		OrgID:       booking.OrgID,
 		BookingID:   req.BookingID,
 		TotalAmount: med.Price * float64(req.Quantity), // 自动计算总价
 		Status:      "Unpaid",                          // 待支付
@@ -480,8 +721,26 @@ func SubmitMedicalRecord(c *gin.Context) {
 		return
 	}
 
+	// 6. 复诊安排
+	resp := gin.H{"msg": "诊断完成，已生成缴费单", "order_id": order.ID}
+	if req.FollowUp != nil {
+		followUp, err := createFollowUp(tx, booking, record.ID, req.FollowUp, dueDate)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "安排复诊失败"})
+			return
+		}
+		if followUp.Mode != req.FollowUp.Mode {
+			resp["msg"] = "诊断完成，已生成缴费单；复诊日号源已满，已改为提醒患者自行预约"
+		}
+		resp["follow_up"] = followUp
+	}
+
 	tx.Commit()
-	c.JSON(http.StatusOK, gin.H{"msg": "诊断完成，已生成缴费单", "order_id": order.ID})
+
+	booking.Status = "Completed"
+	publishQueue("booking.completed", booking)
+	c.JSON(http.StatusOK, resp)
 }
 
 // --- 库房业务 (Storehouse) ---
@@ -493,7 +752,7 @@ func GetInventory(c *gin.Context) {
 	search := c.Query("search")
 
 	var items []model.InventoryItem
-	tx := database.DB.Model(&model.InventoryItem{})
+	tx := database.Scoped(c).Model(&model.InventoryItem{})
 
 	if category != "" && category != "全部" {
 		tx = tx.Where("category = ?", category)
@@ -514,29 +773,39 @@ func AddOrUpdateInventoryItem(c *gin.Context) {
 		return
 	}
 
+	// 入库到哪个机构的库房：跨机构视图下可以指定，否则为当前机构
+	orgID, err := targetOrg(c, req.OrgID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	db := database.ForOrg(orgID)
+
 	// 智能匹配：如果名字和分类相同，则认为是同一物品，直接增加库存
 	var existingItem model.InventoryItem
-	result := database.DB.Where("name = ? AND category = ?", req.Name, req.Category).First(&existingItem)
+	result := db.Where("name = ? AND category = ?", req.Name, req.Category).First(&existingItem)
 
 	if result.Error == nil {
 		// 找到了同名同类物品 -> 更新库存和价格
 		existingItem.Stock += req.Stock
 		existingItem.Price = req.Price // 更新为最新单价
 		existingItem.Description = req.Description
-		database.DB.Save(&existingItem)
+		db.Save(&existingItem)
 		c.JSON(http.StatusOK, gin.H{"msg": "已合并库存", "data": existingItem})
 	} else {
 		// 没找到 -> 创建新记录
-		// 确保 OrgID 从 Token 获取，这里简化处理
-		req.OrgID = 1
-		database.DB.Create(&req)
+		req.ID, req.OrgID = 0, orgID
+		db.Create(&req)
 		c.JSON(http.StatusOK, gin.H{"msg": "新物资入库成功", "data": req})
 	}
 }
 
 // UpdateInventoryItem 编辑物资 (改名字、分类等)
 func UpdateInventoryItem(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
 	var req model.InventoryItem
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
@@ -544,7 +813,7 @@ func UpdateInventoryItem(c *gin.Context) {
 	}
 
 	var item model.InventoryItem
-	if err := database.DB.First(&item, id).Error; err != nil {
+	if err := database.Scoped(c).First(&item, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "物资不存在"})
 		return
 	}
@@ -555,14 +824,18 @@ func UpdateInventoryItem(c *gin.Context) {
 	item.Stock = req.Stock
 	item.Description = req.Description
 
-	database.DB.Save(&item)
+	database.Scoped(c).Save(&item)
+	publishStockLow(item)
 	c.JSON(http.StatusOK, gin.H{"msg": "更新成功", "data": item})
 }
 
 // DeleteInventoryItem 删除物资
 func DeleteInventoryItem(c *gin.Context) {
-	id := c.Param("id")
-	database.DB.Delete(&model.InventoryItem{}, id)
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	database.Scoped(c).Delete(&model.InventoryItem{}, id)
 	c.JSON(http.StatusOK, gin.H{"msg": "删除成功"})
 }
 
@@ -576,45 +849,48 @@ type MedicalRecordDetail struct {
 	DoctorName  string `json:"doctor_name"`
 }
 
-// GetMedicalRecords 获取电子病历列表
-func GetMedicalRecords(c *gin.Context) {
-	role := c.GetString("role")
+// scopeMedicalRecords 按权限限制可见的病历范围 (db 必须已 JOIN bookings)
+// 病历列表、版本历史等所有病历读取接口共用这一套规则
+// record.read.all 不限制；否则 record.read.own (本人作为患者) 与 record.read.assigned (本人接诊) 取并集
+func scopeMedicalRecords(c *gin.Context, db *gorm.DB) (*gorm.DB, bool) {
+	if can(c, "record.read.all") {
+		return db, true
+	}
 	userID := c.GetUint("user_id")
 
+	scope := database.Scoped(c).Where("1 = 0")
+	if can(c, "record.read.own") {
+		// 只查 bookings.patient_name 等于当前用户名的记录
+		var currentUser model.User
+		if err := database.Scoped(c).First(&currentUser, userID).Error; err != nil {
+			return db, false
+		}
+		scope = scope.Or("bookings.patient_name = ?", currentUser.Username)
+	}
+	if can(c, "record.read.assigned") {
+		// 只看自己作为医生经手的 (依赖 bookings.doctor_id)
+		scope = scope.Or("bookings.doctor_id = ?", userID)
+	}
+	return db.Where(scope), true
+}
+
+// GetMedicalRecords 获取电子病历列表
+func GetMedicalRecords(c *gin.Context) {
 	var results []MedicalRecordDetail
 
 	// 1. 基础查询：关联 bookings 表以获取患者信息
-	// 假设你的 User 表里存了医生名字，这里也可以关联 users 表获取医生名
-	// 这里简化处理，先只关联 bookings
-	db := database.DB.Table("medical_records").
-		Select("medical_records.*, bookings.patient_name").
+	// 医生名取病历作者；历史病历没有作者时取挂号单上的接诊医生
+	db := database.Scoped(c).Table("medical_records").
+		Select("medical_records.*, bookings.patient_name, users.username as doctor_name").
 		Joins("JOIN bookings ON bookings.id = medical_records.booking_id").
+		Joins("LEFT JOIN users ON users.id = CASE WHEN medical_records.doctor_id > 0 THEN medical_records.doctor_id ELSE bookings.doctor_id END").
 		Order("medical_records.created_at desc")
 
 	// 2. 权限分流
-	switch role {
-	case "general_user":
-		// --- 情况 A: 普通患者 ---
-		// 只能看属于自己的病历
-		var currentUser model.User
-		if err := database.DB.First(&currentUser, userID).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
-			return
-		}
-		// 核心逻辑：只查 bookings.patient_name 等于当前用户名的记录
-		db = db.Where("bookings.patient_name = ?", currentUser.Username)
-
-	case "doctor":
-		// --- 情况 B: 医生 ---
-		// 医生通常可以看到自己开出的病历，或者整个科室的病历
-		// 这里演示：只看自己作为医生经手的 (依赖 bookings.doctor_id)
-		db = db.Where("bookings.doctor_id = ?", userID)
-
-		// 如果你希望医生能看全院病历以便会诊，这里可以留空，不做 where 限制
-
-	case "admin", "global_admin":
-		// --- 情况 C: 管理员 ---
-		// 查看所有，不做限制
+	db, ok := scopeMedicalRecords(c, db)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
 	}
 
 	// 3. 执行查询
@@ -622,6 +898,7 @@ func GetMedicalRecords(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取病历失败"})
 		return
 	}
+	attachDiagnoses(results)
 
 	c.JSON(http.StatusOK, gin.H{"data": results})
 }
@@ -632,7 +909,7 @@ func GetMedicalRecords(c *gin.Context) {
 func ManageUserStatus(c *gin.Context) {
 	// 简单实现：列出所有用户
 	var users []model.User
-	database.DB.Omit("password").Find(&users)
+	database.Scoped(c).Omit("password").Find(&users)
 	c.JSON(http.StatusOK, gin.H{"data": users})
 }
 
@@ -645,29 +922,72 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
-	// 检查当前操作者的权限（可选：防止 org_admin 创建 global_admin）
-	// currentRole := c.GetString("role")
-	// 这里做简单处理：直接信任中间件的拦截
+	if err := checkPassword(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 只能授予自己权限范围内的角色 (见 grant.go)
+	if !authorizeRole(c, req.Role) {
+		return
+	}
+	if err := checkDepartment(req.Department); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 院区管理员只能在本机构建账号
+	orgID, err := targetOrg(c, req.OrgID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	user := model.User{
 		Username:   req.Username,
-		Password:   req.Password, // BeforeCreate 会自动加密
-		Role:       req.Role,     // 关键：直接使用前端传来的角色 (doctor, finance...)
+		Password:   req.Password, // BeforeSave 会自动加密
+		Role:       req.Role,
 		Department: req.Department,
-		OrgID:      1, // mvp 默认机构1
+		OrgID:      orgID,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	// 管理员角色需审批：账号先建成无角色 (没有任何权限)，审批通过后才拥有该角色
+	approval := needsApproval(c, req.Role, user)
+	if approval {
+		user.Role = ""
+	}
+	var grant model.RoleGrant
+	err = database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if !approval {
+			return nil
+		}
+		var err error
+		grant, err = requestRoleGrant(c, tx, user, req.Role)
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "用户已存在"})
 		return
 	}
+	logSecurityEvent(c, "user_created", user.Username, user.ID, "角色: "+req.Role)
 
+	if approval {
+		logSecurityEvent(c, "role_grant_requested", user.Username, user.ID, fmt.Sprintf("申请 #%d, 新账号 -> %s", grant.ID, grant.ToRole))
+		c.JSON(http.StatusAccepted, gin.H{"msg": "用户已创建，管理员角色需另一位管理员审批后生效", "data": user, "grant": grant})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"msg": "用户创建成功", "data": user})
 }
 
 // 对应路由 PUT /api/v1/dashboard/users/:id
 func UpdateUser(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
 	var req struct {
 		Role       string `json:"role"`
 		Department string `json:"department"`
@@ -679,38 +999,143 @@ func UpdateUser(c *gin.Context) {
 	}
 
 	var user model.User
-	if err := database.DB.First(&user, id).Error; err != nil {
+	if err := database.Scoped(c).First(&user, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
 
+	if !canManageUser(c, user) {
+		return
+	}
+
 	// 更新字段
-	if req.Role != "" {
-		user.Role = req.Role
+	oldRole := user.Role
+	roleChanged := req.Role != "" && req.Role != user.Role
+	if roleChanged {
+		if user.ID == c.GetUint("user_id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "不能修改自己的角色"})
+			return
+		}
+		if !authorizeRole(c, req.Role) || !guardLastGlobalAdmin(c, user) {
+			return
+		}
+	}
+	// 允许把科室改为空字符串（例如转岗），所以不判断空；未改动的历史科室不重新校验
+	if req.Department != user.Department {
+		if err := checkDepartment(req.Department); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
-	// 允许把科室改为空字符串（例如转岗），所以不判断空
 	user.Department = req.Department
 
-	// 如果传了新密码，则修改（GORM Hook 会自动加密吗？不会！Update 不触发 BeforeCreate）
-	// 所以这里需要手动加密，或者把逻辑抽离。为简化，这里假设前端不传密码，只改科室。
-	// 如果要改密码，建议单独写 ResetPassword 接口。
+	// 授予管理员角色只登记申请，角色保持不变，其余字段照常保存
+	approval := roleChanged && needsApproval(c, req.Role, user)
+	if roleChanged && !approval {
+		user.Role = req.Role
+	} else {
+		roleChanged = false
+	}
+
+	// 传了新密码视为管理员重置：校验策略后统一走 SetPassword 加密，下次登录必须修改
+	revokeReason := ""
+	if roleChanged {
+		revokeReason = "role_changed" // 角色变了，旧 Token 里的 role 不能再用
+	}
+	if req.Password != "" {
+		if user.IsExternal() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "统一身份认证账号的密码由目录管理，不能在本系统修改"})
+			return
+		}
+		if err := checkPassword(req.Password, user.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := user.SetPassword(req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+			return
+		}
+		user.MustChangePassword = true
+		revokeReason = "password_reset"
+	}
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	var grant model.RoleGrant
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		if approval {
+			var err error
+			if grant, err = requestRoleGrant(c, tx, user, req.Role); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if roleChanged {
+			if err := expireRoleGrants(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		if revokeReason != "" {
+			return revokeSessions(tx, user.ID, revokeReason)
+		}
+		return nil
+	})
+	if errors.Is(err, errGrantPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
+	if roleChanged {
+		logSecurityEvent(c, "role_changed", user.Username, user.ID, oldRole+" -> "+user.Role)
+	}
+	if req.Password != "" {
+		logSecurityEvent(c, "password_reset", user.Username, user.ID, "管理员修改用户信息时设置")
+	}
 
+	if approval {
+		logSecurityEvent(c, "role_grant_requested", user.Username, user.ID, fmt.Sprintf("申请 #%d, %s -> %s", grant.ID, grant.FromRole, grant.ToRole))
+		c.JSON(http.StatusAccepted, gin.H{"msg": "角色变更已提交，需另一位管理员审批后生效", "data": user, "grant": grant})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"msg": "用户信息已更新", "data": user})
 }
 
 // 对应路由: DELETE /api/v1/dashboard/users/:id
 func DeleteUser(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
 	// 硬删除 (Unscoped) 或者软删除都可以，这里用软删除
-	if err := database.DB.Delete(&model.User{}, id).Error; err != nil {
+	var user model.User
+	if err := database.Scoped(c).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能删除自己的账号"})
+		return
+	}
+	if !canManageUser(c, user) || !guardLastGlobalAdmin(c, user) {
+		return
+	}
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := expireRoleGrants(tx, user.ID); err != nil {
+			return err
+		}
+		return revokeSessions(tx, user.ID, "user_deleted")
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
+	logSecurityEvent(c, "user_deleted", user.Username, user.ID, "角色: "+user.Role)
 	c.JSON(http.StatusOK, gin.H{"msg": "删除成功"})
 }
 
@@ -720,19 +1145,19 @@ func GetDashboardStats(c *gin.Context) {
 	// 1. 统计总收入 (只算 Paid 的)
 	var totalIncome float64
 	// SQL: SELECT SUM(total_amount) FROM orders WHERE status = 'Paid'
-	database.DB.Model(&model.Order{}).Where("status = ?", "Paid").Select("sum(total_amount)").Row().Scan(&totalIncome)
+	database.Scoped(c).Model(&model.Order{}).Where("status = ?", "Paid").Select("sum(total_amount)").Row().Scan(&totalIncome)
 
 	// 2. 统计总患者数/挂号单数
 	var patientCount int64
-	database.DB.Model(&model.Booking{}).Count(&patientCount)
+	database.Scoped(c).Model(&model.Booking{}).Count(&patientCount)
 
 	// 3. 统计医生数量
 	var doctorCount int64
-	database.DB.Model(&model.User{}).Where("role = ?", "doctor").Count(&doctorCount)
+	database.Scoped(c).Model(&model.User{}).Where("role = ?", "doctor").Count(&doctorCount)
 
 	// 4. 统计药品种类
 	var medCount int64
-	database.DB.Model(&model.InventoryItem{}).Count(&medCount)
+	database.Scoped(c).Model(&model.InventoryItem{}).Count(&medCount)
 
 	c.JSON(http.StatusOK, gin.H{
 		"income":   totalIncome,
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 路径参数中的 ID 必须是数字，不能作为 SQL 条件拼进查询
+func TestNonNumericIDRejected(t *testing.T) {
+	_, booking := branchFixture(t)
+	branch := database.Tenant{OrgID: branchOrg}
+
+	handlers := map[string]gin.HandlerFunc{
+		"CancelBooking":       CancelBooking,
+		"GetPatientTimeline":  GetPatientTimeline,
+		"GetReferral":         GetReferral,
+		"DeleteDisplayScreen": DeleteDisplayScreen,
+		"DeleteInventoryItem": DeleteInventoryItem,
+	}
+	for _, id := range []string{"0 OR 1=1", "1; DROP TABLE bookings", "-1", "abc", ""} {
+		for name, h := range handlers {
+			w := callHandler(h, authz.SuperRole, branch, `{}`, gin.Param{Key: "id", Value: id})
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s(%q) = %d %s, want 400", name, id, w.Code, w.Body)
+			}
+		}
+	}
+
+	var still model.Booking
+	if err := database.DB.First(&still, booking.ID).Error; err != nil || still.Status != "Pending" {
+		t.Errorf("booking changed: %+v %v", still, err)
+	}
+
+	// 预交金按患者 ID 查询
+	w := callHandler(GetDepositAccount, authz.SuperRole, branch, ``, gin.Param{Key: "patient_id", Value: "0 OR 1=1"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GetDepositAccount = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/storage"
+	"image"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	_ "image/png" // 注册 PNG 解码器
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 病历附件 (Attachments) ---
+// 对应页面：/medical_record 详情中的附件列表
+
+// allowedAttachmentTypes 允许上传的文件类型 (以服务端嗅探结果为准)
+var allowedAttachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+const thumbnailSize = 256 // 缩略图最长边像素
+
+// maxThumbnailPixels 超过该像素数的图片不生成缩略图：解码按声明的尺寸分配内存，
+// 几十 KB 的 PNG 就能声明 60000×60000 像素
+const maxThumbnailPixels = 30000000 // 3000 万像素
+
+// UploadAttachment 上传病历附件
+// POST /medical_record/:id/attachments  multipart: file
+func UploadAttachment(c *gin.Context) {
+	record, ok := findVisibleRecord(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	maxBytes := int64(config.AppConfig.Storage.MaxUploadMB) << 20
+	if maxBytes <= 0 {
+		maxBytes = 20 << 20
+	}
+
+	// 解析 multipart 时会把整个请求体落盘，先限制请求体大小 (多留 1MB 给表单其他部分)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件超过大小限制"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+		return
+	}
+	if fileHeader.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件超过大小限制"})
+		return
+	}
+
+	// 1. 落盘到临时文件，同时计算 SHA-256 并嗅探类型
+	tmp, sum, size, mimeType, err := spoolUpload(fileHeader, maxBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp)
+
+	if !allowedAttachmentTypes[mimeType] {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "不支持的文件类型: " + mimeType})
+		return
+	}
+
+	// 2. 同一病历重复上传相同内容，直接返回已有附件
+	var existing model.Attachment
+	if err := database.Scoped(c).Where("record_id = ? AND sha256 = ?", record.ID, sum).First(&existing).Error; err == nil {
+		c.JSON(http.StatusOK, gin.H{"msg": "附件已存在", "data": existing})
+		return
+	}
+
+	// 3. 按内容寻址存储，已存在的内容不重复写入
+	blobKey := sum[:2] + "/" + sum
+	if err := putBlobFromFile(blobKey, tmp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
+		return
+	}
+
+	attachment := model.Attachment{
+		OrgID:      record.OrgID,
+		RecordID:   record.ID,
+		FileName:   filepath.Base(fileHeader.Filename),
+		MimeType:   mimeType,
+		Size:       size,
+		SHA256:     sum,
+		BlobKey:    blobKey,
+		UploadedBy: c.GetUint("user_id"),
+		CreatedAt:  time.Now(),
+	}
+
+	// 4. 图片生成缩略图 (失败不影响上传)
+	if mimeType != "application/pdf" {
+		thumbKey := blobKey + ".thumb.jpg"
+		if err := makeThumbnail(tmp, thumbKey); err == nil {
+			attachment.ThumbnailKey = thumbKey
+			attachment.HasThumbnail = true
+		}
+	}
+
+	if err := database.Scoped(c).Create(&attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存附件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "上传成功", "data": attachment})
+}
+
+// GetAttachments 病历附件列表
+// GET /medical_record/:id/attachments
+func GetAttachments(c *gin.Context) {
+	record, ok := findVisibleRecord(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var attachments []model.Attachment
+	database.Scoped(c).Where("record_id = ?", record.ID).Order("created_at asc").Find(&attachments)
+	c.JSON(http.StatusOK, gin.H{"data": attachments})
+}
+
+// DownloadAttachment 下载附件原文件
+// GET /medical_record/:id/attachments/:aid
+func DownloadAttachment(c *gin.Context) {
+	serveAttachment(c, false)
+}
+
+// GetAttachmentThumbnail 下载图片缩略图
+// GET /medical_record/:id/attachments/:aid/thumbnail
+func GetAttachmentThumbnail(c *gin.Context) {
+	serveAttachment(c, true)
+}
+
+func serveAttachment(c *gin.Context, thumbnail bool) {
+	record, ok := findVisibleRecord(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var attachment model.Attachment
+	if err := database.Scoped(c).Where("id = ? AND record_id = ?", c.Param("aid"), record.ID).First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+
+	key, contentType := attachment.BlobKey, attachment.MimeType
+	if thumbnail {
+		if !attachment.HasThumbnail {
+			c.JSON(http.StatusNotFound, gin.H{"error": "该附件没有缩略图"})
+			return
+		}
+		key, contentType = attachment.ThumbnailKey, "image/jpeg"
+	}
+
+	r, err := storage.Blobs.Get(key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件已丢失"})
+		return
+	}
+	defer r.Close()
+
+	if !thumbnail {
+		c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+encodeFileName(attachment.FileName))
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, contentType, r, nil)
+}
+
+// spoolUpload 把上传内容写入临时文件，返回临时路径、SHA-256、大小和嗅探出的类型
+func spoolUpload(fileHeader *multipart.FileHeader, maxBytes int64) (string, string, int64, string, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return "", "", 0, "", errors.New("无法读取上传文件")
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return "", "", 0, "", errors.New("无法创建临时文件")
+	}
+	defer tmp.Close()
+
+	hash := sha256.New()
+	head := &headBuffer{limit: 512}
+	size, err := io.Copy(io.MultiWriter(tmp, hash, head), io.LimitReader(src, maxBytes+1))
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", 0, "", errors.New("上传中断")
+	}
+	if size > maxBytes {
+		os.Remove(tmp.Name())
+		return "", "", 0, "", errors.New("文件超过大小限制")
+	}
+	if size == 0 {
+		os.Remove(tmp.Name())
+		return "", "", 0, "", errors.New("文件为空")
+	}
+
+	return tmp.Name(), hex.EncodeToString(hash.Sum(nil)), size, http.DetectContentType(head.Bytes()), nil
+}
+
+// putBlobFromFile 内容不存在时才写入存储 (去重)
+func putBlobFromFile(key, path string) error {
+	exists, err := storage.Blobs.Exists(key)
+	if err != nil || exists {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return storage.Blobs.Put(key, f)
+}
+
+// makeThumbnail 生成 JPEG 缩略图 (最近邻缩放，够预览用)
+func makeThumbnail(path, key string) error {
+	if exists, err := storage.Blobs.Exists(key); err != nil || exists {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxThumbnailPixels {
+		return errors.New("图片尺寸过大，不生成缩略图")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailSize || h > thumbnailSize {
+		if w >= h {
+			h = h * thumbnailSize / w
+			w = thumbnailSize
+		} else {
+			w = w * thumbnailSize / h
+			h = thumbnailSize
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy := b.Min.Y + y*b.Dy()/h
+		for x := 0; x < w; x++ {
+			sx := b.Min.X + x*b.Dx()/w
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return err
+	}
+	return storage.Blobs.Put(key, &buf)
+}
+
+// headBuffer 只保留写入内容的前 limit 个字节，用于类型嗅探
+type headBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	if remain := h.limit - h.Len(); remain > 0 {
+		if len(p) > remain {
+			h.Buffer.Write(p[:remain])
+		} else {
+			h.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// encodeFileName 按 RFC 5987 编码下载文件名 (支持中文)
+func encodeFileName(name string) string {
+	return strings.ReplaceAll(url.QueryEscape(name), "+", "%20")
+}
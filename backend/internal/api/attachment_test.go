@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"hospital-system/config"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/storage"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pngWithSize 生成一张 1×1 的 PNG，再把 IHDR 里声明的宽高改成 w×h (像素数据不变，文件只有几十字节)
+func pngWithSize(t *testing.T, w, h uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// 8 字节签名 + 4 字节长度 + "IHDR" + 13 字节数据 + 4 字节 CRC
+	ihdr := data[12 : 12+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:8], w)
+	binary.BigEndian.PutUint32(ihdr[8:12], h)
+	binary.BigEndian.PutUint32(data[12+4+13:], crc32.ChecksumIEEE(ihdr))
+	return data
+}
+
+func useTempStorage(t *testing.T) {
+	t.Helper()
+	if err := storage.InitStorage(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThumbnailSkipsHugeImage(t *testing.T) {
+	useTempStorage(t)
+	dir := t.TempDir()
+
+	bomb := filepath.Join(dir, "bomb.png")
+	os.WriteFile(bomb, pngWithSize(t, 60000, 60000), 0644)
+	if err := makeThumbnail(bomb, "bomb.thumb.jpg"); err == nil {
+		t.Error("thumbnail generated for a 60000x60000 image")
+	}
+	if exists, _ := storage.Blobs.Exists("bomb.thumb.jpg"); exists {
+		t.Error("thumbnail stored for oversized image")
+	}
+
+	var small bytes.Buffer
+	png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+	path := filepath.Join(dir, "small.png")
+	os.WriteFile(path, small.Bytes(), 0644)
+	if err := makeThumbnail(path, "small.thumb.jpg"); err != nil {
+		t.Fatalf("normal image: %v", err)
+	}
+	if exists, _ := storage.Blobs.Exists("small.thumb.jpg"); !exists {
+		t.Error("thumbnail not stored for normal image")
+	}
+}
+
+func TestUploadRejectsOversizedBody(t *testing.T) {
+	useTempStorage(t)
+	config.AppConfig.Storage.MaxUploadMB = 1
+	defer func() { config.AppConfig.Storage.MaxUploadMB = 0 }()
+
+	db := database.ForOrg(model.DefaultOrgID)
+	booking := model.Booking{PatientName: "附件患者", Department: "内科", DoctorID: 1, Status: "Completed"}
+	db.Create(&booking)
+	record := model.MedicalRecord{BookingID: booking.ID, DoctorID: 1}
+	db.Create(&record)
+
+	upload := func(size int) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "scan.png")
+		part.Write(bytes.Repeat([]byte{0}, size))
+		mw.Close()
+
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", &body)
+		c.Request.Header.Set("Content-Type", mw.FormDataContentType())
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(record.ID))}}
+		c.Set("user_id", uint(1))
+		c.Set("role", authz.SuperRole)
+		c.Set(database.TenantKey, defaultOrg)
+		UploadAttachment(c)
+		return w
+	}
+
+	// 请求体超过上限：读到上限即中止，不会先把整个请求落盘
+	if w := upload(3 << 20); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("3MB upload: %d %s, want 413", w.Code, w.Body)
+	}
+	// 上限以内照常处理 (全零内容嗅探为 application/octet-stream，按类型拒绝)
+	if w := upload(1 << 10); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("1KB upload: %d %s, want 415", w.Code, w.Body)
+	}
+}
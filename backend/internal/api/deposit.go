@@ -0,0 +1,268 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 预交金 (Deposit) ---
+// 每个患者一个账户；缴存、退款、缴费扣款都以流水记账，余额与流水在同一事务中更新
+
+// ledgerMu 串行化记账，避免并发扣款时读到旧余额
+var ledgerMu sync.Mutex
+
+var errInsufficientDeposit = errors.New("预交金余额不足")
+
+var validDepositMethods = map[string]bool{"cash": true, "card": true, "wechat": true, "alipay": true}
+
+type DepositRequest struct {
+	Amount float64 `json:"amount" binding:"required"`
+	Method string  `json:"method"` // cash (默认), card, wechat, alipay
+	Note   string  `json:"note"`
+}
+
+// GetDepositAccount 查询患者预交金余额
+// GET /deposits/:patient_id
+func GetDepositAccount(c *gin.Context) {
+	id, ok := paramID(c, "patient_id")
+	if !ok {
+		return
+	}
+	var patient model.Patient
+	if err := database.Scoped(c).First(&patient, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者不存在"})
+		return
+	}
+
+	var account model.DepositAccount
+	database.Scoped(c).Where("patient_id = ?", patient.ID).First(&account)
+	account.PatientID = patient.ID
+	c.JSON(http.StatusOK, gin.H{
+		"data":        account,
+		"patient":     patient,
+		"low_balance": account.Balance < lowBalanceLine(),
+	})
+}
+
+// TakeDeposit 缴存预交金
+// POST /deposits/:patient_id/deposit
+func TakeDeposit(c *gin.Context) {
+	depositEntry(c, "deposit", 1)
+}
+
+// RefundDeposit 退还预交金 (不能超过余额)
+// POST /deposits/:patient_id/refund
+func RefundDeposit(c *gin.Context) {
+	depositEntry(c, "refund", -1)
+}
+
+func depositEntry(c *gin.Context, typ string, sign float64) {
+	var req DepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：金额必须大于 0"})
+		return
+	}
+	if req.Method == "" {
+		req.Method = "cash"
+	}
+	if !validDepositMethods[req.Method] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的支付方式: " + req.Method})
+		return
+	}
+
+	id, ok := paramID(c, "patient_id")
+	if !ok {
+		return
+	}
+	var patient model.Patient
+	if err := database.Scoped(c).First(&patient, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者不存在"})
+		return
+	}
+
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+
+	var entry model.DepositEntry
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = postDepositEntry(tx, patient.OrgID, patient.ID, typ, sign*req.Amount, 0, req.Method, req.Note, c.GetUint("user_id"))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errInsufficientDeposit) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "记账失败"})
+		return
+	}
+
+	checkLowBalance(entry)
+	c.JSON(http.StatusOK, gin.H{"msg": "记账成功", "data": entry})
+}
+
+// GetDepositStatement 预交金对账单
+// GET /deposits/:patient_id/statement?from=2026-01-01&to=2026-01-31
+func GetDepositStatement(c *gin.Context) {
+	var account model.DepositAccount
+	if err := database.Scoped(c).Where("patient_id = ?", c.Param("patient_id")).First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该患者没有预交金账户"})
+		return
+	}
+
+	tx := database.Scoped(c).Where("account_id = ?", account.ID)
+	from, to := c.Query("from"), c.Query("to")
+	if from != "" {
+		tx = tx.Where("date(created_at) >= ?", from)
+	}
+	if to != "" {
+		tx = tx.Where("date(created_at) <= ?", to)
+	}
+	var entries []model.DepositEntry
+	tx.Order("id asc").Find(&entries)
+
+	// 期初余额 = 第一笔流水发生前的余额
+	opening, closing := account.Balance, account.Balance
+	var totalIn, totalOut float64
+	if len(entries) > 0 {
+		opening = roundMoney(entries[0].BalanceAfter - entries[0].Amount)
+		closing = entries[len(entries)-1].BalanceAfter
+	} else if from != "" {
+		var last model.DepositEntry
+		if database.Scoped(c).Where("account_id = ? AND date(created_at) < ?", account.ID, from).Order("id desc").First(&last).Error == nil {
+			opening, closing = last.BalanceAfter, last.BalanceAfter
+		} else {
+			opening, closing = 0, 0
+		}
+	}
+	for _, e := range entries {
+		if e.Amount > 0 {
+			totalIn += e.Amount
+		} else {
+			totalOut -= e.Amount
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":            entries,
+		"account":         account,
+		"opening_balance": opening,
+		"closing_balance": closing,
+		"total_in":        roundMoney(totalIn),
+		"total_out":       roundMoney(totalOut),
+	})
+}
+
+// GetLowBalanceAccounts 余额不足的预交金账户 (提醒续缴)
+// GET /deposits/low
+func GetLowBalanceAccounts(c *gin.Context) {
+	var accounts []struct {
+		model.DepositAccount
+		PatientName string `json:"patient_name"`
+		Phone       string `json:"phone"`
+	}
+	database.Scoped(c).Table("deposit_accounts").
+		Select("deposit_accounts.*, patients.name as patient_name, patients.phone").
+		Joins("LEFT JOIN patients ON patients.id = deposit_accounts.patient_id").
+		Where("deposit_accounts.balance < ?", lowBalanceLine()).
+		Order("deposit_accounts.balance asc").
+		Scan(&accounts)
+	c.JSON(http.StatusOK, gin.H{"data": accounts, "threshold": lowBalanceLine()})
+}
+
+// payFromDeposit 缴费时从订单所属患者的预交金扣款 (在 ConfirmPayment 的事务中调用)
+func payFromDeposit(tx *gorm.DB, order model.Order, operatorID uint) (model.DepositEntry, error) {
+	var patientID uint
+	if order.AdmissionID != 0 {
+		var admission model.Admission
+		tx.First(&admission, order.AdmissionID)
+		patientID = admission.PatientID
+	} else {
+		var booking model.Booking
+		tx.First(&booking, order.BookingID)
+		patientID = booking.PatientID
+	}
+	if patientID == 0 {
+		return model.DepositEntry{}, errors.New("订单未关联患者，无法使用预交金")
+	}
+
+	return postDepositEntry(tx, order.OrgID, patientID, "payment", -order.TotalAmount, order.ID, "deposit", "", operatorID)
+}
+
+// postDepositEntry 记一笔流水并更新余额；调用方需持有 ledgerMu
+// 余额用条件更新扣减，不足时返回 errInsufficientDeposit
+// 账户和流水归属患者所在机构 orgID (全局管理员跨机构视图下代缴时不能记到自己的机构)
+func postDepositEntry(tx *gorm.DB, orgID, patientID uint, typ string, amount float64, orderID uint, method, note string, operatorID uint) (model.DepositEntry, error) {
+	amount = roundMoney(amount)
+
+	var account model.DepositAccount
+	if err := tx.Where("patient_id = ?", patientID).First(&account).Error; err != nil {
+		if amount < 0 {
+			return model.DepositEntry{}, errInsufficientDeposit
+		}
+		account = model.DepositAccount{OrgID: orgID, PatientID: patientID}
+		if err := tx.Create(&account).Error; err != nil {
+			return model.DepositEntry{}, err
+		}
+	}
+
+	res := tx.Model(&model.DepositAccount{}).
+		Where("id = ? AND ROUND(balance + ?, 2) >= 0", account.ID, amount).
+		Updates(map[string]interface{}{"balance": gorm.Expr("ROUND(balance + ?, 2)", amount), "updated_at": time.Now()})
+	if res.Error != nil {
+		return model.DepositEntry{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return model.DepositEntry{}, errInsufficientDeposit
+	}
+	if err := tx.First(&account, account.ID).Error; err != nil {
+		return model.DepositEntry{}, err
+	}
+
+	entry := model.DepositEntry{
+		OrgID:        account.OrgID,
+		AccountID:    account.ID,
+		PatientID:    patientID,
+		Type:         typ,
+		Amount:       amount,
+		BalanceAfter: account.Balance,
+		OrderID:      orderID,
+		Method:       method,
+		Note:         note,
+		OperatorID:   operatorID,
+		CreatedAt:    time.Now(),
+	}
+	return entry, tx.Create(&entry).Error
+}
+
+// checkLowBalance 余额低于提醒线时推送 deposit.low
+func checkLowBalance(entry model.DepositEntry) {
+	if entry.Amount >= 0 || entry.BalanceAfter >= lowBalanceLine() {
+		return
+	}
+	events.Publish(events.Event{
+		Type:        "deposit.low",
+		OrgID:       entry.OrgID,
+		Permissions: []string{"deposit.read", "inpatient.read"},
+		Data:        entry,
+	})
+}
+
+func lowBalanceLine() float64 {
+	return config.AppConfig.Deposit.LowBalance
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
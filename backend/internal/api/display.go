@@ -0,0 +1,265 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 候诊区叫号屏 (Display) ---
+// 管理员登记屏幕并配置显示的科室；屏幕凭 Token 访问公开接口
+// 对外只输出号码、诊室和脱敏姓名，不输出任何其他患者信息
+
+// DisplayTicket 大屏上的一个号码
+type DisplayTicket struct {
+	Ticket   string     `json:"ticket"`         // 例如 内科 012
+	Name     string     `json:"name,omitempty"` // 脱敏姓名，屏幕配置为只显示号码时为空
+	Room     string     `json:"room,omitempty"`
+	CalledAt *time.Time `json:"called_at,omitempty"`
+}
+
+// DisplayDepartment 一个科室的叫号情况
+type DisplayDepartment struct {
+	Department string          `json:"department"`
+	Calling    []DisplayTicket `json:"calling"`
+	Waiting    []DisplayTicket `json:"waiting"`
+}
+
+// GetDisplayScreens 叫号屏列表
+func GetDisplayScreens(c *gin.Context) {
+	var screens []model.DisplayScreen
+	database.Scoped(c).Order("id asc").Find(&screens)
+	c.JSON(http.StatusOK, gin.H{"data": screens})
+}
+
+// CreateDisplayScreen 登记叫号屏，生成访问令牌
+func CreateDisplayScreen(c *gin.Context) {
+	var req model.DisplayScreen
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || req.Departments == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：名称和科室必填"})
+		return
+	}
+
+	screen := model.DisplayScreen{
+		Name:        req.Name,
+		Token:       newDisplayToken(),
+		Departments: normalizeDepartments(req.Departments),
+		ShowName:    req.ShowName,
+		WaitingSize: req.WaitingSize,
+		Active:      true,
+	}
+	if err := database.Scoped(c).Create(&screen).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "叫号屏已创建", "data": screen})
+}
+
+// UpdateDisplayScreen 修改叫号屏配置 (?reset_token=1 重新生成令牌)
+func UpdateDisplayScreen(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name"`
+		Departments string `json:"departments"`
+		ShowName    *bool  `json:"show_name"`
+		WaitingSize *int   `json:"waiting_size"`
+		Active      *bool  `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var screen model.DisplayScreen
+	if err := database.Scoped(c).First(&screen, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "叫号屏不存在"})
+		return
+	}
+
+	if req.Name != "" {
+		screen.Name = req.Name
+	}
+	if req.Departments != "" {
+		screen.Departments = normalizeDepartments(req.Departments)
+	}
+	if req.ShowName != nil {
+		screen.ShowName = *req.ShowName
+	}
+	if req.WaitingSize != nil {
+		screen.WaitingSize = *req.WaitingSize
+	}
+	if req.Active != nil {
+		screen.Active = *req.Active
+	}
+	if c.Query("reset_token") == "1" {
+		screen.Token = newDisplayToken()
+	}
+
+	database.Scoped(c).Save(&screen)
+	c.JSON(http.StatusOK, gin.H{"msg": "更新成功", "data": screen})
+}
+
+// DeleteDisplayScreen 删除叫号屏
+func DeleteDisplayScreen(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	database.Scoped(c).Delete(&model.DisplayScreen{}, id)
+	c.JSON(http.StatusOK, gin.H{"msg": "删除成功"})
+}
+
+// GetDisplayBoard 叫号屏当前画面 (公开接口，凭令牌访问)
+// GET /display/:token
+func GetDisplayBoard(c *gin.Context) {
+	screen, ok := findDisplayScreen(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": screen.Name, "data": displayBoard(screen)})
+}
+
+// displayHeartbeat 叫号屏推送的心跳间隔，每次心跳都重新检查屏幕是否仍然有效
+var displayHeartbeat = 20 * time.Second
+
+// StreamDisplayBoard 叫号屏推送 (SSE)
+// 队列变化时推送整屏画面；叫号时附带 announce 供语音播报
+// GET /display/:token/stream
+func StreamDisplayBoard(c *gin.Context) {
+	screen, ok := findDisplayScreen(c)
+	if !ok {
+		return
+	}
+
+	departments := map[string]bool{}
+	for _, d := range strings.Split(screen.Departments, ",") {
+		departments[d] = true
+	}
+	sub := events.Subscribe(func(e events.Event) bool {
+		return queueEventTypes[e.Type] && e.OrgID == screen.OrgID && departments[e.Department]
+	})
+	defer events.Unsubscribe(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(displayHeartbeat)
+	defer heartbeat.Stop()
+
+	// 连接后先推一次当前画面
+	c.SSEvent("display", gin.H{"data": displayBoard(screen)})
+	c.Writer.Flush()
+
+	// 重新读取配置：屏幕停用或令牌重置后断开
+	reload := func() bool {
+		return database.DB.Where("id = ? AND token = ? AND active = ?", screen.ID, screen.Token, true).First(&screen).Error == nil
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-sub.C:
+			if !ok || !reload() {
+				return false
+			}
+			payload := gin.H{"data": displayBoard(screen)}
+			if booking, ok := e.Data.(model.Booking); ok && e.Type == "patient.called" {
+				payload["announce"] = displayTicket(screen, booking)
+			}
+			c.SSEvent("display", payload)
+			return true
+		case <-heartbeat.C:
+			// 没有叫号的时段也要按时检查，否则停用的屏幕会一直保持连接
+			if !reload() {
+				return false
+			}
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func findDisplayScreen(c *gin.Context) (model.DisplayScreen, bool) {
+	var screen model.DisplayScreen
+	if err := database.DB.Where("token = ? AND active = ?", c.Param("token"), true).First(&screen).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "叫号屏不存在或已停用"})
+		return screen, false
+	}
+	return screen, true
+}
+
+// displayBoard 按屏幕配置的科室汇总当日叫号情况
+func displayBoard(screen model.DisplayScreen) []DisplayDepartment {
+	waitingSize := screen.WaitingSize
+	if waitingSize <= 0 {
+		waitingSize = 5
+	}
+	today := time.Now().Format("2006-01-02")
+
+	board := []DisplayDepartment{}
+	for _, dept := range strings.Split(screen.Departments, ",") {
+		var bookings []model.Booking
+		database.ForOrg(screen.OrgID).Where("department = ? AND status = ? AND queue_date = ? AND queue_state <> ?", dept, "Pending", today, "Skipped").
+			Order(queueOrder).Find(&bookings)
+
+		item := DisplayDepartment{Department: dept, Calling: []DisplayTicket{}, Waiting: []DisplayTicket{}}
+		for _, b := range bookings {
+			if b.QueueState == "Called" {
+				item.Calling = append(item.Calling, displayTicket(screen, b))
+			} else if len(item.Waiting) < waitingSize {
+				item.Waiting = append(item.Waiting, displayTicket(screen, b))
+			}
+		}
+		board = append(board, item)
+	}
+	return board
+}
+
+func displayTicket(screen model.DisplayScreen, b model.Booking) DisplayTicket {
+	t := DisplayTicket{Ticket: fmt.Sprintf("%s %03d", b.Department, b.TicketNo), Room: b.Room, CalledAt: b.CalledAt}
+	if screen.ShowName {
+		t.Name = maskName(b.PatientName)
+	}
+	return t
+}
+
+// maskName 姓名脱敏：两个字显示姓，三个字及以上保留首尾
+func maskName(name string) string {
+	r := []rune(name)
+	switch len(r) {
+	case 0:
+		return ""
+	case 1, 2:
+		return string(r[0]) + "*"
+	}
+	return string(r[0]) + strings.Repeat("*", len(r)-2) + string(r[len(r)-1])
+}
+
+func normalizeDepartments(s string) string {
+	var depts []string
+	for _, d := range strings.Split(strings.ReplaceAll(s, "，", ","), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			depts = append(depts, d)
+		}
+	}
+	return strings.Join(depts, ",")
+}
+
+func newDisplayToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bufio"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 没有叫号事件时，叫号屏停用或令牌重置后也要在下一次心跳时断开推送
+func TestDisplayStreamClosesOnHeartbeat(t *testing.T) {
+	saved := displayHeartbeat
+	displayHeartbeat = 50 * time.Millisecond
+	defer func() { displayHeartbeat = saved }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/display/:token/stream", StreamDisplayBoard)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for name, change := range map[string]map[string]interface{}{
+		"deactivated": {"active": false},
+		"token reset": {"token": newDisplayToken()},
+	} {
+		screen := model.DisplayScreen{Name: "心跳-" + name, Token: newDisplayToken(), Departments: "无人科室", Active: true}
+		if err := database.ForOrg(model.DefaultOrgID).Create(&screen).Error; err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Get(srv.URL + "/display/" + screen.Token + "/stream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := make(chan string)
+		go func() {
+			defer close(lines)
+			sc := bufio.NewScanner(resp.Body)
+			for sc.Scan() {
+				lines <- sc.Text()
+			}
+		}()
+
+		// 先收到至少一次心跳，说明连接保持中
+		waitFor(t, lines, "event:ping")
+		database.DB.Model(&screen).Updates(change)
+
+		deadline := time.After(2 * time.Second)
+	drain:
+		for {
+			select {
+			case _, ok := <-lines:
+				if !ok {
+					break drain
+				}
+			case <-deadline:
+				t.Errorf("%s: stream still open after heartbeat", name)
+				break drain
+			}
+		}
+		resp.Body.Close()
+	}
+}
+
+func waitFor(t *testing.T, lines <-chan string, prefix string) {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream closed before %q", prefix)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("no %q within 2s", prefix)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- 结构化病历 (EMR) ---
+// 生命体征、ICD-10 编码诊断
+
+// VitalsInput 前端提交的生命体征，允许带单位，入库前统一换算为标准单位
+type VitalsInput struct {
+	SystolicBP  float64 `json:"systolic_bp"`
+	DiastolicBP float64 `json:"diastolic_bp"`
+	BPUnit      string  `json:"bp_unit"` // mmHg (默认) / kPa
+	HeartRate   int     `json:"heart_rate"`
+	Temperature float64 `json:"temperature"`
+	TempUnit    string  `json:"temperature_unit"` // C (默认) / F
+	SpO2        int     `json:"spo2"`
+	Weight      float64 `json:"weight"`
+	WeightUnit  string  `json:"weight_unit"` // kg (默认) / lb
+}
+
+// Normalize 校验单位与取值范围，并换算为 model.Vitals
+// 未填写的项 (0) 视为未测量，不做范围校验
+func (v *VitalsInput) Normalize() (model.Vitals, error) {
+	var out model.Vitals
+	if v == nil {
+		return out, nil
+	}
+
+	sbp, dbp := v.SystolicBP, v.DiastolicBP
+	switch strings.ToLower(v.BPUnit) {
+	case "", "mmhg":
+	case "kpa":
+		sbp, dbp = sbp*7.50062, dbp*7.50062
+	default:
+		return out, fmt.Errorf("不支持的血压单位: %s", v.BPUnit)
+	}
+	if sbp != 0 || dbp != 0 {
+		if sbp < 50 || sbp > 300 || dbp < 20 || dbp > 200 {
+			return out, errors.New("血压超出合理范围")
+		}
+		if dbp >= sbp {
+			return out, errors.New("舒张压必须低于收缩压")
+		}
+	}
+	out.SystolicBP = int(sbp + 0.5)
+	out.DiastolicBP = int(dbp + 0.5)
+
+	if v.HeartRate != 0 && (v.HeartRate < 20 || v.HeartRate > 300) {
+		return out, errors.New("心率超出合理范围")
+	}
+	out.HeartRate = v.HeartRate
+
+	temp := v.Temperature
+	switch strings.ToUpper(v.TempUnit) {
+	case "", "C":
+	case "F":
+		if temp != 0 {
+			temp = (temp - 32) * 5 / 9
+		}
+	default:
+		return out, fmt.Errorf("不支持的体温单位: %s", v.TempUnit)
+	}
+	if temp != 0 && (temp < 30 || temp > 45) {
+		return out, errors.New("体温超出合理范围")
+	}
+	out.Temperature = float64(int(temp*10+0.5)) / 10
+
+	if v.SpO2 != 0 && (v.SpO2 < 50 || v.SpO2 > 100) {
+		return out, errors.New("血氧饱和度超出合理范围")
+	}
+	out.SpO2 = v.SpO2
+
+	weight := v.Weight
+	switch strings.ToLower(v.WeightUnit) {
+	case "", "kg":
+	case "lb":
+		weight = weight * 0.45359237
+	default:
+		return out, fmt.Errorf("不支持的体重单位: %s", v.WeightUnit)
+	}
+	if weight != 0 && (weight < 0.5 || weight > 500) {
+		return out, errors.New("体重超出合理范围")
+	}
+	out.Weight = float64(int(weight*10+0.5)) / 10
+
+	return out, nil
+}
+
+// buildDiagnoses 根据 ICD-10 编码列表生成诊断明细，第一个编码为主诊断
+func buildDiagnoses(tx *gorm.DB, codes []string) ([]model.MedicalRecordDiagnosis, error) {
+	var diagnoses []model.MedicalRecordDiagnosis
+	seen := map[string]bool{}
+	for _, raw := range codes {
+		code := strings.ToUpper(strings.TrimSpace(raw))
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		var icd model.ICD10Code
+		if err := tx.First(&icd, "code = ?", code).Error; err != nil {
+			return nil, fmt.Errorf("无效的诊断编码: %s", code)
+		}
+		diagnoses = append(diagnoses, model.MedicalRecordDiagnosis{
+			Code:        icd.Code,
+			Description: icd.Description,
+			IsPrimary:   len(diagnoses) == 0,
+			Sequence:    len(diagnoses) + 1,
+		})
+	}
+	return diagnoses, nil
+}
+
+// diagnosisText 没有填写自由文本诊断时，用编码诊断拼出一份
+func diagnosisText(diagnoses []model.MedicalRecordDiagnosis) string {
+	names := make([]string, 0, len(diagnoses))
+	for _, d := range diagnoses {
+		names = append(names, d.Description+"("+d.Code+")")
+	}
+	return strings.Join(names, "; ")
+}
+
+// attachDiagnoses 为病历列表批量补充编码诊断 (Scan 不会加载关联)
+func attachDiagnoses(records []MedicalRecordDetail) {
+	if len(records) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+
+	var diagnoses []model.MedicalRecordDiagnosis
+	database.DB.Where("record_id IN ?", ids).Order("sequence asc").Find(&diagnoses)
+
+	// 修订后旧版本的诊断行仍保留，这里只取病历当前版本的诊断
+	versions := map[uint]int{}
+	for _, r := range records {
+		versions[r.ID] = r.Version
+	}
+	byRecord := map[uint][]model.MedicalRecordDiagnosis{}
+	for _, d := range diagnoses {
+		if d.RecordVersion == versions[d.RecordID] {
+			byRecord[d.RecordID] = append(byRecord[d.RecordID], d)
+		}
+	}
+	for i := range records {
+		records[i].Diagnoses = byRecord[records[i].ID]
+		if records[i].Diagnoses == nil {
+			records[i].Diagnoses = []model.MedicalRecordDiagnosis{}
+		}
+	}
+}
+
+// SearchICD10 诊断编码搜索 / 自动补全
+// GET /icd10?q=J06&limit=20 ：编码前缀匹配 或 名称模糊匹配
+func SearchICD10(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	var codes []model.ICD10Code
+	tx := database.Scoped(c).Model(&model.ICD10Code{})
+	if q != "" {
+		tx = tx.Where("code LIKE ? OR description LIKE ?", strings.ToUpper(q)+"%", "%"+q+"%")
+	}
+	if err := tx.Order("code asc").Limit(limit).Find(&codes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询诊断编码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": codes})
+}
+
+// ImportICD10 导入 ICD-10 字典 (CSV 文件，每行: 编码,名称；已存在的编码会被更新)
+// POST /icd10/import  multipart: file
+func ImportICD10(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传 CSV 文件"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法读取文件"})
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var batch []model.ICD10Code
+	line := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("第 %d 行格式错误", line)})
+			return
+		}
+		if len(row) < 2 {
+			continue
+		}
+		code := strings.ToUpper(strings.TrimSpace(row[0]))
+		desc := strings.TrimSpace(row[1])
+		// 跳过表头
+		if line == 1 && strings.EqualFold(code, "code") {
+			continue
+		}
+		if code == "" || desc == "" {
+			continue
+		}
+		batch = append(batch, model.ICD10Code{Code: code, Description: desc})
+	}
+
+	if len(batch) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件中没有有效的编码"})
+		return
+	}
+
+	err = database.Scoped(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description"}),
+	}).CreateInBatches(&batch, 500).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "导入成功", "count": len(batch)})
+}
+
+// DiagnosisRevenue 按主诊断编码统计营收
+type DiagnosisRevenue struct {
+	Code        string  `json:"code"`
+	Description string  `json:"description"`
+	OrderCount  int64   `json:"order_count"`
+	Total       float64 `json:"total"`
+}
+
+// GetDiagnosisRevenue 财务报表：按主诊断编码分组
+func GetDiagnosisRevenue(c *gin.Context) {
+	var results []DiagnosisRevenue
+	err := database.Scoped(c).Table("orders").
+		Select("medical_record_diagnoses.code, max(medical_record_diagnoses.description) as description, count(orders.id) as order_count, sum(orders.total_amount) as total").
+		Joins("JOIN medical_records ON medical_records.booking_id = orders.booking_id").
+		Joins("JOIN medical_record_diagnoses ON medical_record_diagnoses.record_id = medical_records.id AND medical_record_diagnoses.record_version = medical_records.version AND medical_record_diagnoses.is_primary = ?", true).
+		Where("orders.status = ?", "Paid").
+		Group("medical_record_diagnoses.code").
+		Order("total desc").
+		Scan(&results).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
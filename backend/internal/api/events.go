@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"hospital-system/internal/api/middleware"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 实时事件推送 ---
+// GET /dashboard/events     SSE
+// GET /dashboard/events/ws  WebSocket (可选)
+// 两者都可以用 ?types=booking.created,order.paid 只订阅部分事件
+
+const lowStockThreshold = 10 // 库存低于该值时推送 stock.low
+
+// dashboardFilter 按当前登录用户的角色、机构过滤事件
+func dashboardFilter(c *gin.Context) func(events.Event) bool {
+	role, userID, orgID := c.GetString("role"), c.GetUint("user_id"), c.GetUint("org_id")
+
+	var types map[string]bool
+	if q := c.Query("types"); q != "" {
+		types = map[string]bool{}
+		for _, t := range strings.Split(q, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	return func(e events.Event) bool {
+		if types != nil && !types[e.Type] {
+			return false
+		}
+		return e.VisibleTo(role, userID, orgID)
+	}
+}
+
+// CreateStreamTicket 换取推送通道的一次性票据，URL 中不再出现 JWT
+// POST /dashboard/events/ticket
+func CreateStreamTicket(c *gin.Context) {
+	ticket, err := middleware.IssueStreamTicket(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成票据失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": int(middleware.StreamTicketTTL.Seconds())})
+}
+
+// streamSessionActive 长连接建立后会话仍然有效 (退出登录、强制下线、角色变更都会注销会话)
+func streamSessionActive(c *gin.Context) bool {
+	return middleware.SessionActive(c.GetUint("session_id"), c.GetUint("user_id"))
+}
+
+// StreamEvents 首页及各业务页面的事件推送 (SSE)
+func StreamEvents(c *gin.Context) {
+	streamEvents(c, events.Subscribe(dashboardFilter(c)))
+}
+
+// EventsWebSocket 同样的事件流，走 WebSocket
+func EventsWebSocket(c *gin.Context) {
+	filter := dashboardFilter(c)
+	ws, err := events.UpgradeWebSocket(c.Writer, c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer ws.Close()
+
+	sub := events.Subscribe(filter)
+	defer events.Unsubscribe(sub)
+
+	heartbeat := time.NewTicker(20 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			if ws.WriteText(data) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if !streamSessionActive(c) {
+				ws.WriteText([]byte(`{"type":"session.revoked"}`))
+				return
+			}
+			if ws.WriteText([]byte(`{"type":"ping"}`)) != nil {
+				return
+			}
+		case <-ws.Closed():
+			return
+		}
+	}
+}
+
+// streamEvents 把订阅到的事件以 SSE 写给客户端，定时发送心跳防止代理断开；心跳时会话已失效则断开
+func streamEvents(c *gin.Context, sub *events.Subscription) {
+	defer events.Unsubscribe(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(20 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			c.SSEvent(e.Type, e)
+			return true
+		case <-heartbeat.C:
+			if !streamSessionActive(c) {
+				c.SSEvent("session.revoked", "")
+				return false
+			}
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// publishOrderPaid 缴费完成 (收费、财务、管理员可见)
+func publishOrderPaid(order model.Order) {
+	events.Publish(events.Event{
+		Type:        "order.paid",
+		OrgID:       order.OrgID,
+		Permissions: []string{"payment.read.all"},
+		Data:        order,
+	})
+}
+
+// publishStockLow 库存不足提醒 (库管、管理员可见)
+func publishStockLow(item model.InventoryItem) {
+	if item.Stock >= lowStockThreshold {
+		return
+	}
+	events.Publish(events.Event{
+		Type:        "stock.low",
+		OrgID:       item.OrgID,
+		Permissions: []string{"inventory.adjust"},
+		Data:        item,
+	})
+}
+
+// publishLabResult 检验结果发布 (开单医生、检验科、管理员可见)
+func publishLabResult(labOrder model.LabOrder) {
+	events.Publish(events.Event{
+		Type:        "lab.resulted",
+		OrgID:       labOrder.OrgID,
+		Permissions: []string{"lab.order", "lab.process"},
+		DoctorID:    labOrder.DoctorID,
+		Data:        labOrder,
+	})
+}
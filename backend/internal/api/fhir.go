@@ -0,0 +1,433 @@
+package api
+
+import (
+	"encoding/json"
+	"hospital-system/internal/database"
+	"hospital-system/internal/fhir"
+	"hospital-system/internal/model"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- FHIR R4 接口 ---
+// 只读检索 + 患者 Bundle 导出 + 患者批量导入
+// 数据可见范围与病历接口一致 (scopeMedicalRecords)
+
+const fhirBase = "/fhir/r4"
+
+// fhirBooking 挂号单 + 医生名，是大部分资源的来源
+type fhirBooking struct {
+	model.Booking
+	DoctorName string
+}
+
+// fhirItem 资源及其检索用的时间
+type fhirItem struct {
+	resource fhir.Resource
+	at       time.Time
+}
+
+func fhirJSON(c *gin.Context, status int, body interface{}) {
+	data, _ := json.Marshal(body)
+	c.Data(status, fhir.ContentType, data)
+}
+
+func fhirError(c *gin.Context, status int, code, msg string) {
+	fhirJSON(c, status, fhir.NewOutcome("error", code, msg))
+}
+
+// visibleBookings 当前用户可见的挂号单，可按患者过滤
+func visibleBookings(c *gin.Context, patientID string) ([]fhirBooking, bool) {
+	db := database.Scoped(c).Table("bookings").
+		Select("bookings.*, users.username as doctor_name").
+		Joins("LEFT JOIN users ON users.id = bookings.doctor_id").
+		Order("bookings.created_at asc")
+	if patientID != "" {
+		db = db.Where("bookings.patient_id = ?", strings.TrimPrefix(patientID, "Patient/"))
+	}
+	db, ok := scopeMedicalRecords(c, db)
+	if !ok {
+		fhirError(c, http.StatusUnauthorized, "login", "用户身份异常")
+		return nil, false
+	}
+	var bookings []fhirBooking
+	if err := db.Scan(&bookings).Error; err != nil {
+		fhirError(c, http.StatusInternalServerError, "exception", "查询失败")
+		return nil, false
+	}
+	return bookings, true
+}
+
+// buildResources 根据可见挂号单组装指定类型的资源
+func buildResources(resourceType string, bookings []fhirBooking) []fhirItem {
+	var items []fhirItem
+	if len(bookings) == 0 {
+		return items
+	}
+	byID := map[uint]model.Booking{}
+	ids := make([]uint, 0, len(bookings))
+	for _, b := range bookings {
+		byID[b.ID] = b.Booking
+		ids = append(ids, b.ID)
+	}
+	add := func(t, id string, body interface{}, at time.Time) {
+		items = append(items, fhirItem{resource: fhir.Resource{Type: t, ID: id, Body: body}, at: at})
+	}
+
+	switch resourceType {
+	case "Encounter":
+		for _, b := range bookings {
+			add("Encounter", strconv.FormatUint(uint64(b.ID), 10), fhir.FromBooking(b.Booking, b.DoctorName), b.CreatedAt)
+		}
+
+	case "Condition", "Observation":
+		var records []model.MedicalRecord
+		database.DB.Where("booking_id IN ?", ids).Find(&records)
+		recordByID := map[uint]model.MedicalRecord{}
+		recordIDs := make([]uint, 0, len(records))
+		for _, r := range records {
+			recordByID[r.ID] = r
+			recordIDs = append(recordIDs, r.ID)
+		}
+
+		if resourceType == "Condition" && len(recordIDs) > 0 {
+			var diagnoses []model.MedicalRecordDiagnosis
+			database.DB.Where("record_id IN ?", recordIDs).Order("record_id asc, sequence asc").Find(&diagnoses)
+			for _, d := range diagnoses {
+				r := recordByID[d.RecordID]
+				if d.RecordVersion != r.Version {
+					continue
+				}
+				add("Condition", strconv.FormatUint(uint64(d.ID), 10), fhir.FromDiagnosis(d, r, byID[r.BookingID]), r.CreatedAt)
+			}
+		}
+
+		if resourceType == "Observation" {
+			for _, r := range records {
+				for _, o := range fhir.VitalObservations(r, byID[r.BookingID]) {
+					add("Observation", o.ID, o, r.CreatedAt)
+				}
+			}
+			var labs []model.LabOrder
+			database.DB.Where("booking_id IN ? AND status = ?", ids, "Resulted").Find(&labs)
+			for _, l := range labs {
+				o := fhir.FromLabOrder(l, byID[l.BookingID])
+				add("Observation", o.ID, o, *l.ResultedAt)
+			}
+		}
+
+	case "MedicationRequest", "ChargeItem", "Invoice":
+		var orders []model.Order
+		tx := database.DB.Where("booking_id IN ?", ids)
+		if resourceType == "MedicationRequest" {
+			tx = tx.Where("medicine_id <> 0")
+		}
+		tx.Order("created_at asc").Find(&orders)
+
+		names := orderLabels(orders)
+		for _, o := range orders {
+			id := strconv.FormatUint(uint64(o.ID), 10)
+			switch resourceType {
+			case "MedicationRequest":
+				add(resourceType, id, fhir.FromMedicationOrder(o, byID[o.BookingID], names[o.ID]), o.CreatedAt)
+			case "ChargeItem":
+				add(resourceType, id, fhir.FromOrder(o, byID[o.BookingID], names[o.ID]), o.CreatedAt)
+			case "Invoice":
+				add(resourceType, id, fhir.InvoiceFromOrder(o, byID[o.BookingID]), o.CreatedAt)
+			}
+		}
+	}
+	return items
+}
+
+// orderLabels 订单对应的收费项目名称 (药品名或检验项目名)
+func orderLabels(orders []model.Order) map[uint]string {
+	labels := map[uint]string{}
+	for _, o := range orders {
+		switch {
+		case o.MedicineID != 0:
+			var med model.InventoryItem
+			if database.DB.Unscoped().First(&med, o.MedicineID).Error == nil {
+				labels[o.ID] = med.Name
+			}
+		case o.LabOrderID != 0:
+			var lab model.LabOrder
+			if database.DB.First(&lab, o.LabOrderID).Error == nil {
+				labels[o.ID] = lab.TestName
+			}
+		}
+	}
+	return labels
+}
+
+// matchDate 支持 FHIR date 检索前缀: eq(默认), ne, gt, lt, ge, le；精度到日
+func matchDate(at time.Time, params []string) bool {
+	day := at.Format("2006-01-02")
+	for _, p := range params {
+		prefix, value := "eq", p
+		if len(p) > 2 && p[0] >= 'a' && p[0] <= 'z' {
+			prefix, value = p[:2], p[2:]
+		}
+		if len(value) > 10 {
+			value = value[:10]
+		}
+		ok := true
+		switch prefix {
+		case "eq":
+			ok = day == value
+		case "ne":
+			ok = day != value
+		case "gt":
+			ok = day > value
+		case "lt":
+			ok = day < value
+		case "ge":
+			ok = day >= value
+		case "le":
+			ok = day <= value
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// fhirCount 解析 _count (默认 50，最多 500)
+func fhirCount(c *gin.Context) int {
+	n, err := strconv.Atoi(c.DefaultQuery("_count", "50"))
+	if err != nil || n < 0 {
+		return 50
+	}
+	if n > 500 {
+		return 500
+	}
+	return n
+}
+
+// FhirSearch 通用检索：Encounter / Condition / Observation / MedicationRequest / ChargeItem / Invoice
+// GET /fhir/r4/:type?patient=1&date=ge2026-01-01&_count=20
+func FhirSearch(resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bookings, ok := visibleBookings(c, c.Query("patient"))
+		if !ok {
+			return
+		}
+
+		dates := c.QueryArray("date")
+		category := c.Query("category")
+		var matched []fhir.Resource
+		for _, item := range buildResources(resourceType, bookings) {
+			if len(dates) > 0 && !matchDate(item.at, dates) {
+				continue
+			}
+			if category != "" {
+				if o, isObs := item.resource.Body.(fhir.Observation); isObs && (len(o.Category) == 0 || o.Category[0].Coding[0].Code != category) {
+					continue
+				}
+			}
+			matched = append(matched, item.resource)
+		}
+
+		bundle := fhir.NewBundle("searchset", fhirBase, truncate(matched, fhirCount(c)))
+		total := len(matched)
+		bundle.Total = &total
+		fhirJSON(c, http.StatusOK, bundle)
+	}
+}
+
+func truncate(resources []fhir.Resource, n int) []fhir.Resource {
+	if len(resources) > n {
+		return resources[:n]
+	}
+	return resources
+}
+
+// FhirReadPatient 读取单个患者
+// GET /fhir/r4/Patient/:id
+func FhirReadPatient(c *gin.Context) {
+	patient, gender, ok := fhirVisiblePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	fhirJSON(c, http.StatusOK, fhir.FromPatient(patient, gender))
+}
+
+// FhirSearchPatients 检索患者
+// GET /fhir/r4/Patient?identifier=xxx&name=张&_count=20
+func FhirSearchPatients(c *gin.Context) {
+	bookings, ok := visibleBookings(c, "")
+	if !ok {
+		return
+	}
+
+	tx := database.Scoped(c).Model(&model.Patient{}).Order("id asc")
+	// 医生/患者只能检索到自己有权查看的患者
+	if !can(c, "record.read.all") {
+		ids := []uint{0}
+		for _, b := range bookings {
+			ids = append(ids, b.PatientID)
+		}
+		tx = tx.Where("id IN ?", ids)
+	}
+	if identifier := c.Query("identifier"); identifier != "" {
+		if i := strings.LastIndex(identifier, "|"); i >= 0 {
+			identifier = identifier[i+1:]
+		}
+		tx = tx.Where("id_card = ?", identifier)
+	}
+	if name := c.Query("name"); name != "" {
+		tx = tx.Where("name LIKE ?", "%"+name+"%")
+	}
+
+	var total int64
+	tx.Count(&total)
+	var patients []model.Patient
+	tx.Limit(fhirCount(c)).Find(&patients)
+
+	genders := latestGenders(bookings)
+	resources := make([]fhir.Resource, 0, len(patients))
+	for _, p := range patients {
+		resources = append(resources, fhir.Resource{Type: "Patient", ID: strconv.FormatUint(uint64(p.ID), 10), Body: fhir.FromPatient(p, genders[p.ID])})
+	}
+	bundle := fhir.NewBundle("searchset", fhirBase, resources)
+	n := int(total)
+	bundle.Total = &n
+	fhirJSON(c, http.StatusOK, bundle)
+}
+
+// FhirPatientEverything 导出患者全部数据
+// GET /fhir/r4/Patient/:id/$everything
+func FhirPatientEverything(c *gin.Context) {
+	patient, gender, ok := fhirVisiblePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	bookings, ok := visibleBookings(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	resources := []fhir.Resource{{Type: "Patient", ID: strconv.FormatUint(uint64(patient.ID), 10), Body: fhir.FromPatient(patient, gender)}}
+	for _, t := range []string{"Encounter", "Condition", "Observation", "MedicationRequest", "ChargeItem", "Invoice"} {
+		for _, item := range buildResources(t, bookings) {
+			resources = append(resources, item.resource)
+		}
+	}
+	fhirJSON(c, http.StatusOK, fhir.NewBundle("collection", fhirBase, resources))
+}
+
+// fhirVisiblePatient 读取患者并检查可见性
+func fhirVisiblePatient(c *gin.Context, id string) (model.Patient, string, bool) {
+	var patient model.Patient
+	pid, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || pid == 0 {
+		fhirError(c, http.StatusBadRequest, "invalid", "Patient ID 无效")
+		return patient, "", false
+	}
+	if err := database.Scoped(c).First(&patient, uint(pid)).Error; err != nil {
+		fhirError(c, http.StatusNotFound, "not-found", "Patient/"+id+" 不存在")
+		return patient, "", false
+	}
+	bookings, ok := visibleBookings(c, id)
+	if !ok {
+		return patient, "", false
+	}
+	if len(bookings) == 0 && !can(c, "record.read.all") {
+		fhirError(c, http.StatusForbidden, "forbidden", "无权查看该患者")
+		return patient, "", false
+	}
+	return patient, latestGenders(bookings)[patient.ID], true
+}
+
+// latestGenders 患者档案没有性别，取最近一次挂号登记的性别
+func latestGenders(bookings []fhirBooking) map[uint]string {
+	genders := map[uint]string{}
+	for _, b := range bookings {
+		if b.Gender != "" {
+			genders[b.PatientID] = b.Gender
+		}
+	}
+	return genders
+}
+
+// FhirImportPatients 从 FHIR Bundle 批量导入/更新患者
+// POST /fhir/r4/import  body: Bundle JSON，或 multipart file
+// 按身份证号匹配已有档案，没有身份证号时按姓名匹配
+func FhirImportPatients(c *gin.Context) {
+	var reader io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			fhirError(c, http.StatusBadRequest, "invalid", "请上传 Bundle 文件")
+			return
+		}
+		f, err := fileHeader.Open()
+		if err != nil {
+			fhirError(c, http.StatusBadRequest, "invalid", "无法读取文件")
+			return
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	var bundle struct {
+		ResourceType string `json:"resourceType"`
+		Entry        []struct {
+			Resource json.RawMessage `json:"resource"`
+		} `json:"entry"`
+	}
+	if err := json.NewDecoder(reader).Decode(&bundle); err != nil || bundle.ResourceType != "Bundle" {
+		fhirError(c, http.StatusBadRequest, "invalid", "请求体必须是 FHIR Bundle")
+		return
+	}
+
+	created, updated, skipped := 0, 0, 0
+	tx := homeOrg(c).Begin() // 导入到当前机构，跨机构视图下也不匹配其他机构的患者
+	for _, entry := range bundle.Entry {
+		var p fhir.Patient
+		if err := json.Unmarshal(entry.Resource, &p); err != nil || p.ResourceType != "Patient" {
+			skipped++
+			continue
+		}
+		name, idCard, phone := fhir.PatientFields(p)
+		if name == "" {
+			skipped++
+			continue
+		}
+
+		// 与挂号同一套匹配规则：只有姓名的不归并到已有档案
+		info := model.PatientInfo{Name: name, IDCard: idCard, Phone: phone}
+		existing, _, err := model.MatchPatient(tx, info)
+		if err == nil {
+			existing.Name = name
+			if phone != "" {
+				existing.Phone = phone
+			}
+			if err := tx.Save(&existing).Error; err != nil {
+				tx.Rollback()
+				fhirError(c, http.StatusInternalServerError, "exception", "导入失败")
+				return
+			}
+			updated++
+			continue
+		}
+
+		if _, err := model.FindOrCreatePatient(tx, info); err != nil {
+			tx.Rollback()
+			fhirError(c, http.StatusInternalServerError, "exception", "导入失败")
+			return
+		}
+		created++
+	}
+	tx.Commit()
+
+	outcome := fhir.NewOutcome("information", "informational",
+		"created="+strconv.Itoa(created)+" updated="+strconv.Itoa(updated)+" skipped="+strconv.Itoa(skipped))
+	fhirJSON(c, http.StatusOK, outcome)
+}
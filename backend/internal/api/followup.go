@@ -0,0 +1,291 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/internal/database"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 复诊安排 (Follow-up) ---
+// 医生在提交病历时开具复诊：直接预约同一医生复诊日的号，或只提醒患者自行预约
+
+// followUpGraceDays 提醒类复诊过了复诊日多少天仍未挂号算爽约
+const followUpGraceDays = 7
+
+// FollowUpInput 病历里附带的复诊医嘱，Days 与 Date 二选一
+type FollowUpInput struct {
+	Days int    `json:"days"` // N 天后复诊
+	Date string `json:"date"` // 或指定复诊日期 2006-01-02
+	Mode string `json:"mode"` // booking (默认，直接预约) / reminder (提醒自行预约)
+	Note string `json:"note"`
+}
+
+// DueDate 计算并校验复诊日期 (必须在今天之后、一年以内)
+func (in *FollowUpInput) DueDate(now time.Time) (string, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var due time.Time
+	switch {
+	case in.Days > 0:
+		due = today.AddDate(0, 0, in.Days)
+	case in.Date != "":
+		d, err := time.ParseInLocation("2006-01-02", in.Date, now.Location())
+		if err != nil {
+			return "", errors.New("复诊日期格式应为 2006-01-02")
+		}
+		due = d
+	default:
+		return "", errors.New("复诊需要填写天数或日期")
+	}
+	if !due.After(today) || due.After(today.AddDate(1, 0, 0)) {
+		return "", errors.New("复诊日期必须在今天之后一年以内")
+	}
+	if in.Mode == "" {
+		in.Mode = "booking"
+	}
+	if in.Mode != "booking" && in.Mode != "reminder" {
+		return "", errors.New("复诊方式只能是 booking 或 reminder")
+	}
+	return due.Format("2006-01-02"), nil
+}
+
+// createFollowUp 在病历事务内登记复诊
+// booking 方式会为同一医生生成复诊日的预约挂号单 (Scheduled，不占当日排队号)；
+// 复诊日号源已满时退回为提醒方式，由调用方告知医生
+// 复诊和预约挂号单都归属原挂号单的机构 (全局管理员的跨机构视图下不能按当前机构写入)
+func createFollowUp(tx *gorm.DB, source model.Booking, recordID uint, in *FollowUpInput, due string) (model.FollowUp, error) {
+	followUp := model.FollowUp{
+		OrgID:           source.OrgID,
+		SourceBookingID: source.ID,
+		RecordID:        recordID,
+		PatientID:       source.PatientID,
+		PatientName:     source.PatientName,
+		DoctorID:        source.DoctorID,
+		Department:      source.Department,
+		DueDate:         due,
+		Mode:            in.Mode,
+		Note:            in.Note,
+		Status:          "Open",
+	}
+
+	if followUp.Mode == "booking" && doctorFull(tx, source.DoctorID, due) {
+		followUp.Mode = "reminder"
+	}
+	if followUp.Mode == "booking" {
+		booking := model.Booking{
+			OrgID:       source.OrgID,
+			PatientID:   source.PatientID,
+			PatientName: source.PatientName,
+			Age:         source.Age,
+			Gender:      source.Gender,
+			Department:  source.Department,
+			DoctorID:    source.DoctorID,
+			Status:      "Scheduled",
+			QueueDate:   due,
+			QueueState:  "Waiting",
+			CreatedAt:   time.Now(),
+		}
+		if err := tx.Create(&booking).Error; err != nil {
+			return followUp, err
+		}
+		followUp.BookingID = booking.ID
+		followUp.Status = "Booked"
+	}
+
+	err := tx.Create(&followUp).Error
+	return followUp, err
+}
+
+// linkFollowUp 患者自行挂号时，关联同科室待预约的复诊
+func linkFollowUp(tx *gorm.DB, booking model.Booking) error {
+	var followUp model.FollowUp
+	err := tx.Where("patient_id = ? AND department = ? AND status = ?", booking.PatientID, booking.Department, "Open").
+		Order("due_date asc").First(&followUp).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return tx.Model(&followUp).Updates(map[string]interface{}{"booking_id": booking.ID, "status": "Booked"}).Error
+}
+
+// CheckInBooking 复诊预约到院签到：Scheduled -> Pending，分配当日排队号
+// POST /bookings/:id/checkin
+func CheckInBooking(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var booking model.Booking
+	if err := database.Scoped(c).First(&booking, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "挂号单不存在"})
+		return
+	}
+
+	// 普通用户只能签到自己的预约
+	if !can(c, "booking.manage") {
+		var currentUser model.User
+		database.Scoped(c).First(&currentUser, c.GetUint("user_id"))
+		if booking.PatientName != currentUser.Username {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能签到本人的预约"})
+			return
+		}
+	}
+	if booking.Status != "Scheduled" {
+		c.JSON(http.StatusConflict, gin.H{"error": "该挂号单不是待签到的复诊预约"})
+		return
+	}
+	if booking.QueueDate != time.Now().Format("2006-01-02") {
+		c.JSON(http.StatusConflict, gin.H{"error": "只能在预约当天签到，预约日期: " + booking.QueueDate})
+		return
+	}
+
+	// 按挂号单所属机构编排排队号
+	ticketMu.Lock()
+	err := database.ForOrg(booking.OrgID).Transaction(func(tx *gorm.DB) error {
+		if err := assignTicket(tx, &booking); err != nil {
+			return err
+		}
+		booking.Status = "Pending"
+		result := tx.Model(&model.Booking{}).Where("id = ? AND status = ?", booking.ID, "Scheduled").
+			Updates(map[string]interface{}{
+				"status":      booking.Status,
+				"queue_date":  booking.QueueDate,
+				"queue_state": booking.QueueState,
+				"ticket_no":   booking.TicketNo,
+				"priority":    booking.Priority,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该预约已签到或已取消")
+		}
+		return nil
+	})
+	ticketMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "签到失败: " + err.Error()})
+		return
+	}
+
+	publishQueue("booking.created", booking)
+	publishBookingADT(booking, "A04")
+	c.JSON(http.StatusOK, gin.H{"msg": "签到成功", "data": booking})
+}
+
+// upcomingFollowUps 尚未到期的复诊 (待预约 / 已预约)，patientName 为空时返回全部
+func upcomingFollowUps(db *gorm.DB, patientName string) []model.FollowUp {
+	var followUps []model.FollowUp
+	tx := db.Where("status IN ? AND due_date >= ?", []string{"Open", "Booked"}, time.Now().AddDate(0, 0, -followUpGraceDays).Format("2006-01-02")).
+		Order("due_date asc")
+	if patientName != "" {
+		tx = tx.Where("patient_name = ?", patientName)
+	}
+	tx.Find(&followUps)
+	return followUps
+}
+
+// GetFollowUps 复诊列表 / 爽约报表 (医生只看自己开具的)
+// GET /doctor/follow_ups?status=Missed&from=2024-01-01&to=2024-01-31
+func GetFollowUps(c *gin.Context) {
+	tx := database.Scoped(c).Model(&model.FollowUp{})
+	if !can(c, "patient.all") {
+		tx = tx.Where("doctor_id = ?", c.GetUint("user_id"))
+	}
+	if from := c.Query("from"); from != "" {
+		tx = tx.Where("due_date >= ?", from)
+	}
+	if to := c.Query("to"); to != "" {
+		tx = tx.Where("due_date <= ?", to)
+	}
+
+	// 按状态汇总 (不受 status 过滤影响)，便于计算爽约率
+	type statusCount struct {
+		Status string `json:"status"`
+		Count  int64  `json:"count"`
+	}
+	var stats []statusCount
+	tx.Session(&gorm.Session{}).Select("status, COUNT(*) as count").Group("status").Scan(&stats)
+
+	if status := c.Query("status"); status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	var followUps []model.FollowUp
+	if err := tx.Order("due_date desc").Find(&followUps).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询复诊记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": followUps, "stats": stats})
+}
+
+// refreshFollowUps 按挂号单状态推进复诊状态：
+//   - 复诊挂号单已就诊 (或转诊) -> Completed
+//   - 预约日已过仍未签到 -> Missed (挂号单同时置为 Missed)
+//   - 提醒类复诊超过宽限期仍未挂号 -> Missed
+//
+// 爽约时提醒开具复诊的医生
+func refreshFollowUps(now time.Time) {
+	today := now.Format("2006-01-02")
+	database.DB.Model(&model.FollowUp{}).
+		Where("status = ? AND booking_id IN (?)", "Booked",
+			database.DB.Model(&model.Booking{}).Select("id").Where("status IN ?", []string{"Completed", "Referred"})).
+		Update("status", "Completed")
+
+	var missed []model.FollowUp
+	database.DB.Where("status = ? AND booking_id IN (?)", "Booked",
+		database.DB.Model(&model.Booking{}).Select("id").Where("status = ? AND queue_date < ?", "Scheduled", today)).
+		Find(&missed)
+	var reminders []model.FollowUp
+	database.DB.Where("status = ? AND due_date < ?", "Open", now.AddDate(0, 0, -followUpGraceDays).Format("2006-01-02")).
+		Find(&reminders)
+	missed = append(missed, reminders...)
+
+	for _, f := range missed {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&model.FollowUp{}).Where("id = ? AND status = ?", f.ID, f.Status).Update("status", "Missed")
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			if f.BookingID != 0 {
+				if err := tx.Model(&model.Booking{}).Where("id = ? AND status = ?", f.BookingID, "Scheduled").
+					Update("status", "Missed").Error; err != nil {
+					return err
+				}
+			}
+			f.Status = "Missed"
+			return nil
+		})
+		if err != nil {
+			log.Printf("复诊 %d 标记爽约失败: %v", f.ID, err)
+			continue
+		}
+		if f.Status == "Missed" {
+			events.Publish(events.Event{
+				Type:        "followup.missed",
+				OrgID:       f.OrgID,
+				Permissions: []string{"followup.read"},
+				Department:  f.Department,
+				DoctorID:    f.DoctorID,
+				Data:        f,
+			})
+		}
+	}
+}
+
+// RunFollowUpMonitor 定时推进复诊状态 (启动时先执行一次)
+// 查询接口不再顺带刷新：挂号列表每个请求都会读复诊，刷新是全表扫描加写入，会和挂号、缴费抢写锁
+func RunFollowUpMonitor(interval time.Duration) {
+	for {
+		refreshFollowUps(time.Now())
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 角色授予规则 (防止提权) ---
+// 1. 角色必须已定义，且只能授予不超出自己权限的角色 (见 authz.CanGrant)
+// 2. 只能管理 (改角色、删除、重置密码等) 自己有权授予其角色的用户，院区管理员不能动全局管理员和同级管理员
+// 3. 不能修改自己的角色、删除自己；不能降级或删除最后一位全局管理员
+// 4. 授予管理员角色需另一位有权授予该角色的管理员审批 (users.admin_grant_approval)
+
+// authorizeRole 校验当前操作者能否授予该角色
+func authorizeRole(c *gin.Context, role string) bool {
+	if !authz.Exists(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色不存在: " + role})
+		return false
+	}
+	if !authz.CanGrant(c.GetString("role"), role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权授予该角色: " + role})
+		return false
+	}
+	return true
+}
+
+// canManageUser 只能管理自己有权授予其角色的用户
+// 有待审批申请的用户按申请的角色判断：否则院区管理员可以在审批前重置待任命全局管理员的密码，审批后直接接管该账号
+func canManageUser(c *gin.Context, user model.User) bool {
+	if user.ID == c.GetUint("user_id") {
+		return true
+	}
+	actorRole := c.GetString("role")
+	allowed := user.Role == "" || authz.CanGrant(actorRole, user.Role)
+	if allowed {
+		var pending []model.RoleGrant
+		database.DB.Where("user_id = ? AND status = ?", user.ID, "Pending").Find(&pending)
+		for _, g := range pending {
+			if !authz.CanGrant(actorRole, g.ToRole) {
+				allowed = false
+			}
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该用户"})
+	}
+	return allowed
+}
+
+// guardLastGlobalAdmin 系统中至少保留一位全局管理员
+func guardLastGlobalAdmin(c *gin.Context, user model.User) bool {
+	if user.Role != authz.SuperRole {
+		return true
+	}
+	var count int64
+	database.DB.Model(&model.User{}).Where("role = ?", authz.SuperRole).Count(&count)
+	if count <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "不能降级或删除最后一位全局管理员"})
+		return false
+	}
+	return true
+}
+
+// checkDepartment 科室为空或在配置的科室列表中
+func checkDepartment(department string) error {
+	allowed := config.AppConfig.Users.Departments
+	if department == "" || len(allowed) == 0 {
+		return nil
+	}
+	for _, d := range allowed {
+		if d == department {
+			return nil
+		}
+	}
+	return fmt.Errorf("科室不存在: %s", department)
+}
+
+// needsApproval 授予管理员角色是否需要审批
+// 没有其他可审批的管理员 (例如只有一位全局管理员) 时直接生效，否则会永远无法任命第二位管理员
+func needsApproval(c *gin.Context, role string, user model.User) bool {
+	if !config.AppConfig.Users.AdminGrantApproval || !authz.Privileged(role) {
+		return false
+	}
+	return countApprovers(role, user.OrgID, c.GetUint("user_id"), user.ID) > 0
+}
+
+// countApprovers 能审批该角色授予的其他管理员人数：有 user.manage 且有权授予该角色，
+// 跨机构角色 (org.all) 不限机构，其余须与目标用户同一机构
+func countApprovers(role string, orgID uint, exclude ...uint) int64 {
+	var roles []model.Role
+	database.DB.Find(&roles)
+	var crossOrg, local []string
+	for _, r := range roles {
+		if !authz.Has(r.Name, "user.manage") || !authz.CanGrant(r.Name, role) {
+			continue
+		}
+		if authz.Has(r.Name, "org.all") {
+			crossOrg = append(crossOrg, r.Name)
+		} else {
+			local = append(local, r.Name)
+		}
+	}
+	tx := database.DB.Model(&model.User{}).Where("id NOT IN ?", exclude)
+	switch {
+	case len(crossOrg) == 0 && len(local) == 0:
+		return 0
+	case len(local) == 0:
+		tx = tx.Where("role IN ?", crossOrg)
+	case len(crossOrg) == 0:
+		tx = tx.Where("role IN ? AND org_id = ?", local, orgID)
+	default:
+		tx = tx.Where("role IN ? OR (role IN ? AND org_id = ?)", crossOrg, local, orgID)
+	}
+	var count int64
+	tx.Count(&count)
+	return count
+}
+
+var errGrantPending = errors.New("该用户已有待审批的角色变更")
+
+// requestRoleGrant 登记角色授予申请 (目标用户已有待审批申请时拒绝)
+func requestRoleGrant(c *gin.Context, tx *gorm.DB, user model.User, toRole string) (model.RoleGrant, error) {
+	var pending int64
+	tx.Model(&model.RoleGrant{}).Where("user_id = ? AND status = ?", user.ID, "Pending").Count(&pending)
+	if pending > 0 {
+		return model.RoleGrant{}, errGrantPending
+	}
+	grant := model.RoleGrant{
+		OrgID:         user.OrgID,
+		UserID:        user.ID,
+		Username:      user.Username,
+		FromRole:      user.Role,
+		ToRole:        toRole,
+		Status:        "Pending",
+		RequestedBy:   c.GetUint("user_id"),
+		RequesterName: actorName(c),
+	}
+	return grant, tx.Create(&grant).Error
+}
+
+// expireRoleGrants 用户角色被直接修改或账号被删除后，之前的申请作废
+func expireRoleGrants(tx *gorm.DB, userID uint) error {
+	return tx.Model(&model.RoleGrant{}).
+		Where("user_id = ? AND status = ?", userID, "Pending").
+		Update("status", "Expired").Error
+}
+
+func actorName(c *gin.Context) string {
+	var actor model.User
+	database.DB.Unscoped().Select("username").First(&actor, c.GetUint("user_id"))
+	return actor.Username
+}
+
+// GetRoleGrants 角色授予申请列表，默认只看待审批的
+// GET /dashboard/users/role_grants?status=Pending
+func GetRoleGrants(c *gin.Context) {
+	status := c.DefaultQuery("status", "Pending")
+	var grants []model.RoleGrant
+	tx := database.Scoped(c).Order("id desc")
+	if status != "all" {
+		tx = tx.Where("status = ?", status)
+	}
+	tx.Limit(200).Find(&grants)
+	c.JSON(http.StatusOK, gin.H{"data": grants})
+}
+
+// findPendingGrant 按 ID 查找待审批的申请
+func findPendingGrant(c *gin.Context) (model.RoleGrant, bool) {
+	var grant model.RoleGrant
+	id, ok := paramID(c, "id")
+	if !ok {
+		return grant, false
+	}
+	if err := database.Scoped(c).First(&grant, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "申请不存在"})
+		return grant, false
+	}
+	if grant.Status != "Pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "申请已处理"})
+		return grant, false
+	}
+	return grant, true
+}
+
+// ApproveRoleGrant 审批通过：审批人不能是申请人或目标用户本人，且自己也有权授予该角色
+// POST /dashboard/users/role_grants/:id/approve
+func ApproveRoleGrant(c *gin.Context) {
+	grant, ok := findPendingGrant(c)
+	if !ok {
+		return
+	}
+	actorID := c.GetUint("user_id")
+	if actorID == grant.RequestedBy || actorID == grant.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "需由申请人以外的另一位管理员审批"})
+		return
+	}
+	if !authz.CanGrant(c.GetString("role"), grant.ToRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权审批该角色"})
+		return
+	}
+
+	var user model.User
+	if err := database.Scoped(c).First(&user, grant.UserID).Error; err != nil || user.Role != grant.FromRole {
+		// 申请之后用户被删除或角色已被修改，按申请时的前提审批可能越权
+		expireRoleGrants(database.Scoped(c), grant.UserID)
+		c.JSON(http.StatusConflict, gin.H{"error": "用户已删除或角色已变化，申请已失效"})
+		return
+	}
+	if !guardLastGlobalAdmin(c, user) {
+		return
+	}
+
+	now := time.Now()
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("role", grant.ToRole).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&grant).Updates(map[string]interface{}{
+			"status": "Approved", "decided_by": actorID, "decider_name": actorName(c), "decided_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, user.ID, "role_changed")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "审批失败"})
+		return
+	}
+	user.Role = grant.ToRole
+	logSecurityEvent(c, "role_grant_approved", user.Username, user.ID, fmt.Sprintf("申请 #%d, 申请人: %s", grant.ID, grant.RequesterName))
+	logSecurityEvent(c, "role_changed", user.Username, user.ID, grant.FromRole+" -> "+grant.ToRole)
+
+	c.JSON(http.StatusOK, gin.H{"msg": "已审批通过，角色已生效", "data": user})
+}
+
+// RejectRoleGrant 驳回申请 (申请人也可以用它撤回)
+// POST /dashboard/users/role_grants/:id/reject
+func RejectRoleGrant(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	c.ShouldBindJSON(&req)
+
+	grant, ok := findPendingGrant(c)
+	if !ok {
+		return
+	}
+	actorID := c.GetUint("user_id")
+	if actorID != grant.RequestedBy && !authz.CanGrant(c.GetString("role"), grant.ToRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权审批该角色"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.Scoped(c).Model(&grant).Updates(map[string]interface{}{
+		"status": "Rejected", "decided_by": actorID, "decider_name": actorName(c), "decided_at": now, "reason": req.Reason,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	logSecurityEvent(c, "role_grant_rejected", grant.Username, grant.UserID, fmt.Sprintf("申请 #%d, %s -> %s, 原因: %s", grant.ID, grant.FromRole, grant.ToRole, req.Reason))
+
+	c.JSON(http.StatusOK, gin.H{"msg": "申请已驳回"})
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/hl7"
+	"hospital-system/internal/model"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- HL7 v2 接口 ---
+// 入站: ADT^A04/A08 登记/更新患者，ORU^R01 检验结果
+// 出站: 挂号 ADT^A04，退号 ADT^A11
+
+// HandleHL7Message MLLP 服务的消息处理入口，返回 ACK/NAK
+func HandleHL7Message(msg *hl7.Message) *hl7.Message {
+	msgType, trigger := msg.Type()
+	var err error
+	switch {
+	case msgType == "ADT" && (trigger == "A04" || trigger == "A08"):
+		err = handleADT(msg, trigger)
+	case msgType == "ORU" && trigger == "R01":
+		err = handleORU(msg)
+	default:
+		return hl7.ACK(msg, "AR", "不支持的消息类型 "+msgType+"^"+trigger)
+	}
+
+	if err != nil {
+		log.Printf("HL7 消息 %s 处理失败: %v", msg.ControlID(), err)
+		return hl7.ACK(msg, "AE", err.Error())
+	}
+	return hl7.ACK(msg, "AA", "")
+}
+
+// hl7Patient 从 PID 段取出患者信息
+type hl7Patient struct {
+	Name, IDCard, Phone, Gender string
+	Age                         int
+}
+
+func parsePID(msg *hl7.Message) (hl7Patient, error) {
+	var p hl7Patient
+	pid, ok := msg.Segment("PID")
+	if !ok {
+		return p, fmt.Errorf("缺少 PID 段")
+	}
+	// 中文姓名：姓 + 名 直接拼接
+	p.Name = hl7.Unescape(pid.Component(5, 1) + pid.Component(5, 2))
+	if p.Name == "" {
+		return p, fmt.Errorf("PID-5 患者姓名为空")
+	}
+	p.IDCard = pid.Component(3, 1)
+	p.Phone = pid.Component(13, 1)
+	switch pid.Field(8) {
+	case "M":
+		p.Gender = "男"
+	case "F":
+		p.Gender = "女"
+	}
+	if birth, ok := hl7.ParseTime(pid.Field(7)); ok {
+		p.Age = int(time.Since(birth).Hours() / 24 / 365.25)
+	}
+	return p, nil
+}
+
+// hl7DB 入站消息没有登录身份，限定在配置的机构内读写
+func hl7DB() *gorm.DB {
+	orgID := config.AppConfig.HL7.OrgID
+	if orgID == 0 {
+		orgID = model.DefaultOrgID
+	}
+	return database.ForOrg(orgID)
+}
+
+// handleADT A04 登记患者并生成挂号单；A08 更新患者信息
+func handleADT(msg *hl7.Message, trigger string) error {
+	info, err := parsePID(msg)
+	if err != nil {
+		return err
+	}
+
+	// 取号与保存放在同一把锁里，和挂号台共用号码序列
+	// 与 createQueuedBooking 一致先加锁再开事务：反过来会在持有 SQLite 写锁时等锁，另一方只能等到 busy_timeout
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+
+	tx := hl7DB().Begin()
+	defer tx.Rollback()
+
+	patient, err := model.FindOrCreatePatient(tx, model.PatientInfo{
+		Name:      info.Name,
+		IDCard:    info.IDCard,
+		Phone:     info.Phone,
+		Gender:    info.Gender,
+		BirthYear: model.BirthYearOf(info.Age, time.Now()),
+	})
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"name": info.Name}
+	if info.Phone != "" {
+		updates["phone"] = info.Phone
+	}
+	if err := tx.Model(&patient).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	var joined *model.Booking
+	pv1, hasVisit := msg.Segment("PV1")
+	switch trigger {
+	case "A04":
+		if !hasVisit {
+			break
+		}
+		booking := model.Booking{
+			PatientID:   patient.ID,
+			PatientName: info.Name,
+			Age:         info.Age,
+			Gender:      info.Gender,
+			Department:  hl7.Unescape(pv1.Component(3, 1)),
+			DoctorID:    hl7Doctor(pv1),
+			Status:      "Pending",
+			CreatedAt:   time.Now(),
+		}
+		if booking.Department == "" {
+			return fmt.Errorf("PV1-3 科室为空")
+		}
+		if err := assignTicket(tx, &booking); err != nil {
+			return err
+		}
+		if err := tx.Create(&booking).Error; err != nil {
+			return err
+		}
+		joined = &booking
+
+	case "A08":
+		// PV1-19 就诊号即本系统挂号单号，带上时一并更新挂号信息
+		if !hasVisit || pv1.Component(19, 1) == "" {
+			break
+		}
+		updates := map[string]interface{}{"patient_name": info.Name}
+		if dept := hl7.Unescape(pv1.Component(3, 1)); dept != "" {
+			updates["department"] = dept
+		}
+		if doctorID := hl7Doctor(pv1); doctorID != 0 {
+			updates["doctor_id"] = doctorID
+		}
+		if info.Gender != "" {
+			updates["gender"] = info.Gender
+		}
+		res := tx.Model(&model.Booking{}).Where("id = ? AND patient_id = ?", pv1.Component(19, 1), patient.ID).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("就诊号 %s 不存在", pv1.Component(19, 1))
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	if joined != nil {
+		publishQueue("booking.created", *joined)
+	}
+	return nil
+}
+
+// hl7Doctor PV1-7 主治医生：先按 ID 匹配，再按用户名匹配
+func hl7Doctor(pv1 hl7.Segment) uint {
+	var doctor model.User
+	if id, err := strconv.Atoi(pv1.Component(7, 1)); err == nil {
+		if hl7DB().Where("id = ? AND role = ?", id, "doctor").First(&doctor).Error == nil {
+			return doctor.ID
+		}
+	}
+	name := pv1.Component(7, 2) + pv1.Component(7, 3)
+	if name != "" && hl7DB().Where("username = ? AND role = ?", name, "doctor").First(&doctor).Error == nil {
+		return doctor.ID
+	}
+	return 0
+}
+
+// handleORU 检验结果：OBR-2 (placer order) 即本系统检验单号
+func handleORU(msg *hl7.Message) error {
+	type group struct {
+		obr hl7.Segment
+		obx []hl7.Segment
+	}
+	var groups []*group
+	for _, s := range msg.Segments {
+		switch s.Name() {
+		case "OBR":
+			groups = append(groups, &group{obr: s})
+		case "OBX":
+			if len(groups) > 0 {
+				groups[len(groups)-1].obx = append(groups[len(groups)-1].obx, s)
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return fmt.Errorf("缺少 OBR 段")
+	}
+
+	tx := hl7DB().Begin()
+	defer tx.Rollback()
+
+	for _, g := range groups {
+		placer := g.obr.Component(2, 1)
+		// 来自未认证的 MLLP 连接：First(&x, 字符串) 会把非数字串当作 SQL 条件拼接，必须先解析成数字
+		id, err := strconv.ParseUint(placer, 10, 64)
+		if err != nil {
+			return fmt.Errorf("OBR-2 检验单号无效: %q", placer)
+		}
+		var labOrder model.LabOrder
+		if err := tx.Where("id = ?", id).First(&labOrder).Error; err != nil {
+			return fmt.Errorf("检验单 %s 不存在", placer)
+		}
+		if labOrder.Status == "Cancelled" {
+			return fmt.Errorf("检验单 %s 已取消", placer)
+		}
+		if len(g.obx) == 0 {
+			return fmt.Errorf("检验单 %s 没有 OBX 结果", placer)
+		}
+
+		// 取与项目编码一致的 OBX，没有就取第一条
+		obx := g.obx[0]
+		for _, o := range g.obx {
+			if strings.EqualFold(o.Component(3, 1), labOrder.TestCode) {
+				obx = o
+				break
+			}
+		}
+
+		// 仪器直接上传结果时，补登采样信息
+		if labOrder.CollectedAt == nil {
+			collected := time.Now()
+			if t, ok := hl7.ParseTime(g.obr.Field(7)); ok {
+				collected = t
+			}
+			labOrder.CollectedAt = &collected
+			labOrder.SpecimenNo = g.obr.Component(3, 1)
+		}
+
+		if err := recordLabResult(tx, &labOrder, hl7.Unescape(obx.Field(5)), "", 0); err != nil {
+			return err
+		}
+		// 本系统没有配置参考范围时，采用仪器给出的异常标志
+		if flag := obx.Field(8); labOrder.RefRange == "" && flag != "" {
+			if err := tx.Model(&labOrder).Update("flag", flag).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// publishBookingADT 挂号/退号时向 HIS 推送 ADT 消息
+func publishBookingADT(booking model.Booking, trigger string) {
+	if hl7.Outbound == nil {
+		return
+	}
+
+	var patient model.Patient
+	database.DB.First(&patient, booking.PatientID)
+	var doctor model.User
+	database.DB.First(&doctor, booking.DoctorID)
+
+	identifier := patient.IDCard
+	if identifier == "" {
+		identifier = "P" + strconv.FormatUint(uint64(patient.ID), 10)
+	}
+	sex := "U"
+	switch booking.Gender {
+	case "男":
+		sex = "M"
+	case "女":
+		sex = "F"
+	}
+
+	msg := hl7.New("hospital-system", config.AppConfig.HL7.Facility, "ADT", trigger)
+	msg.Add("EVN", trigger, hl7.Timestamp(time.Now()))
+	msg.Add("PID", "1", "", identifier, "", hl7.Escape(booking.PatientName), "", "", sex,
+		"", "", "", "", hl7.Escape(patient.Phone))
+	// PV1-2 门诊, PV1-3 科室, PV1-7 医生, PV1-19 就诊号 (挂号单号)
+	pv1 := make([]string, 19)
+	pv1[0] = "1"
+	pv1[1] = "O"
+	pv1[2] = hl7.Escape(booking.Department)
+	pv1[6] = strconv.FormatUint(uint64(doctor.ID), 10) + "^" + hl7.Escape(doctor.Username)
+	pv1[18] = strconv.FormatUint(uint64(booking.ID), 10)
+	msg.Add("PV1", pv1...)
+
+	hl7.Publish(msg)
+}
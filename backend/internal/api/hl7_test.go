@@ -0,0 +1,194 @@
+package api
+
+import (
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/hl7"
+	"hospital-system/internal/model"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// 用 internal/hl7/testdata 中采集的样例消息，经 MLLP 发送到 hl7.Server (与 cmd/mllp-send 相同的客户端)，
+// 校验 ACK 以及落库的挂号单和检验结果
+
+var hl7Addr string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "hl7-test")
+	if err != nil {
+		panic(err)
+	}
+	config.AppConfig = &config.Config{}
+	database.InitDB(filepath.Join(dir, "test.db"))
+	database.DB.Logger = logger.Default.LogMode(logger.Silent)
+	if err := authz.Init(database.DB); err != nil {
+		panic(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	hl7Addr = ln.Addr().String()
+	go (&hl7.Server{Handler: HandleHL7Message}).Serve(ln)
+
+	code := m.Run()
+	ln.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// sendSample 读取样例文件 (按行保存)，按 replace 改写其中的单号后发送，返回 ACK
+func sendSample(t *testing.T, name string, replace ...string) *hl7.Message {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "hl7", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := strings.ReplaceAll(strings.TrimSpace(string(data)), "\r\n", "\n")
+	text = strings.NewReplacer(replace...).Replace(text)
+	msg, err := hl7.Parse(strings.ReplaceAll(text, "\n", "\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack, err := hl7.Send(hl7Addr, msg, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ack.Get("MSA-2"); got != msg.ControlID() {
+		t.Errorf("ACK MSA-2 = %q, want %q", got, msg.ControlID())
+	}
+	return ack
+}
+
+func expectACK(t *testing.T, ack *hl7.Message, code string) {
+	t.Helper()
+	if got := ack.Get("MSA-1"); got != code {
+		t.Fatalf("ACK code = %s (%s), want %s", got, ack.Get("MSA-3"), code)
+	}
+}
+
+// registerSample 发送 ADT^A04 样例，返回生成的挂号单
+func registerSample(t *testing.T) model.Booking {
+	t.Helper()
+	var before int64
+	database.DB.Model(&model.Booking{}).Count(&before)
+
+	expectACK(t, sendSample(t, "adt_a04.hl7"), "AA")
+
+	var booking model.Booking
+	if err := database.DB.Order("id desc").First(&booking).Error; err != nil {
+		t.Fatal(err)
+	}
+	if booking.ID == 0 || int64(booking.ID) <= before {
+		t.Fatal("ADT^A04 did not create a booking")
+	}
+	return booking
+}
+
+func TestHL7RegisterPatient(t *testing.T) {
+	booking := registerSample(t)
+	if booking.PatientName != "李四" || booking.Department != "内科" || booking.Gender != "男" {
+		t.Errorf("booking = %+v", booking)
+	}
+	if booking.Status != "Pending" || booking.QueueState != "Waiting" || booking.TicketNo == 0 {
+		t.Errorf("booking not queued: status=%s state=%s ticket=%d", booking.Status, booking.QueueState, booking.TicketNo)
+	}
+	if booking.OrgID != model.DefaultOrgID {
+		t.Errorf("booking org_id = %d, want default org", booking.OrgID)
+	}
+
+	var patient model.Patient
+	if err := database.DB.First(&patient, booking.PatientID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if patient.IDCard != "110101199001011234" || patient.Phone != "13800000000" {
+		t.Errorf("patient = %+v", patient)
+	}
+}
+
+func TestHL7UpdateVisit(t *testing.T) {
+	booking := registerSample(t)
+
+	// 样例中 PV1-19 就诊号为 2，改为刚生成的挂号单
+	ack := sendSample(t, "adt_a08.hl7", "||||2", fmt.Sprintf("||||%d", booking.ID))
+	expectACK(t, ack, "AA")
+
+	var updated model.Booking
+	database.DB.First(&updated, booking.ID)
+	if updated.Department != "外科" {
+		t.Errorf("department = %s, want 外科", updated.Department)
+	}
+	var patient model.Patient
+	database.DB.First(&patient, booking.PatientID)
+	if patient.Phone != "13900000000" {
+		t.Errorf("patient phone = %s, want 13900000000", patient.Phone)
+	}
+
+	// 不存在的就诊号
+	expectACK(t, sendSample(t, "adt_a08.hl7", "||||2", "||||999999"), "AE")
+}
+
+// createLabOrder 给样例患者开一张血糖检验单
+func createLabOrder(t *testing.T) model.LabOrder {
+	t.Helper()
+	booking := registerSample(t)
+	low, high := 3.9, 6.1
+	test := model.LabTest{Code: "GLU", Name: "血糖", Unit: "mmol/L", RefLow: &low, RefHigh: &high}
+	if err := database.DB.Where(model.LabTest{Code: "GLU"}).FirstOrCreate(&test).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := model.LabOrder{OrgID: model.DefaultOrgID, BookingID: booking.ID, TestID: test.ID, TestCode: "GLU", TestName: "血糖", Status: "Ordered"}
+	if err := database.DB.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestHL7LabResult(t *testing.T) {
+	order := createLabOrder(t)
+
+	// 样例中 OBR-2 检验单号为 1
+	expectACK(t, sendSample(t, "oru_r01.hl7", "OBR|1|1|", fmt.Sprintf("OBR|1|%d|", order.ID)), "AA")
+
+	var stored model.LabOrder
+	database.DB.First(&stored, order.ID)
+	if stored.Status != "Resulted" || stored.ResultValue != "6.8" || stored.Flag != "H" {
+		t.Errorf("lab order status=%s value=%s flag=%s", stored.Status, stored.ResultValue, stored.Flag)
+	}
+	if stored.SpecimenNo != "S261019000001" || stored.CollectedAt == nil || stored.ResultedAt == nil {
+		t.Errorf("lab order specimen=%s collected=%v resulted=%v", stored.SpecimenNo, stored.CollectedAt, stored.ResultedAt)
+	}
+}
+
+// OBR-2 来自未认证连接，非数字单号 (可能是注入的 SQL 条件) 必须拒绝，且不能改动任何检验单
+func TestHL7LabResultRejectsBadOrderID(t *testing.T) {
+	createLabOrder(t)
+	var before int64
+	database.DB.Model(&model.LabOrder{}).Where("status = ?", "Resulted").Count(&before)
+
+	for _, placer := range []string{"999999", "1 OR 1=1", "status = 'Ordered'", ""} {
+		ack := sendSample(t, "oru_r01.hl7", "OBR|1|1|", "OBR|1|"+placer+"|")
+		expectACK(t, ack, "AE")
+	}
+
+	var after int64
+	database.DB.Model(&model.LabOrder{}).Where("status = ?", "Resulted").Count(&after)
+	if after != before {
+		t.Errorf("rejected messages resulted %d lab orders", after-before)
+	}
+}
+
+func TestHL7UnsupportedMessage(t *testing.T) {
+	ack := sendSample(t, "adt_a04.hl7", "ADT^A04", "ADT^A99")
+	expectACK(t, ack, "AR")
+}
@@ -0,0 +1,659 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 住院管理 (Inpatient) ---
+// 入院占床 -> 转床 / 药品医嘱 / 每日床位费累计到住院账户 -> 出院小结 + 生成结算订单 (走原有缴费流程)
+
+const dateLayout = "2006-01-02"
+
+var errBedUnavailable = errors.New("床位已被占用或不可用")
+
+// errNotAdmitted 事务内重新读取时患者已出院 (并发的出院、转床、医嘱、计费以事务内的状态为准)
+var errNotAdmitted = errors.New("患者已出院")
+
+// errChargeConflict 计费日期已被并发的计费推进，本次回滚
+var errChargeConflict = errors.New("床位费已被其他操作计入")
+
+// WardDetail 病区 + 床位占用统计
+type WardDetail struct {
+	model.Ward
+	Total     int `json:"total"`
+	Occupied  int `json:"occupied"`
+	Available int `json:"available"`
+}
+
+// GetWards 病区及床位占用情况
+// GET /inpatient/wards
+func GetWards(c *gin.Context) {
+	var wards []model.Ward
+	database.Scoped(c).Preload("Beds", func(db *gorm.DB) *gorm.DB { return db.Order("number asc") }).
+		Order("id asc").Find(&wards)
+
+	result := make([]WardDetail, 0, len(wards))
+	for _, w := range wards {
+		d := WardDetail{Ward: w, Total: len(w.Beds)}
+		for _, b := range w.Beds {
+			switch b.Status {
+			case "Occupied":
+				d.Occupied++
+			case "Available":
+				d.Available++
+			}
+		}
+		result = append(result, d)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// SaveWard 新增/修改病区 (按名称匹配)
+// POST /inpatient/wards
+func SaveWard(c *gin.Context) {
+	var req model.Ward
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：病区名称必填"})
+		return
+	}
+
+	// 按名称匹配所属机构的病区，不信任请求体里的 id；跨机构视图下可以指定机构
+	orgID, err := targetOrg(c, req.OrgID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	db := database.ForOrg(orgID)
+	req.ID, req.OrgID = 0, orgID
+	var ward model.Ward
+	if db.Where("name = ?", req.Name).First(&ward).Error == nil {
+		req.ID = ward.ID
+		req.CreatedAt = ward.CreatedAt
+	}
+	req.Beds = nil
+	if err := db.Save(&req).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "保存成功", "data": req})
+}
+
+// AddBeds 批量添加床位
+// POST /inpatient/wards/:id/beds  {"numbers": ["01", "02"], "daily_rate": 0}
+func AddBeds(c *gin.Context) {
+	var req struct {
+		Numbers   []string `json:"numbers" binding:"required"`
+		DailyRate float64  `json:"daily_rate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Numbers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请填写床号"})
+		return
+	}
+
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var ward model.Ward
+	if err := database.Scoped(c).First(&ward, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "病区不存在"})
+		return
+	}
+
+	beds := make([]model.Bed, 0, len(req.Numbers))
+	for _, n := range req.Numbers {
+		beds = append(beds, model.Bed{OrgID: ward.OrgID, WardID: ward.ID, Number: n, DailyRate: req.DailyRate, Status: "Available"})
+	}
+	if err := database.Scoped(c).Create(&beds).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "床号重复"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "床位已添加", "data": beds})
+}
+
+// SetBedStatus 床位状态维护 (清洁完成、维修)，占用中的床位不能修改
+// PUT /inpatient/beds/:id/status  {"status": "Available"}
+func SetBedStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil ||
+		(req.Status != "Available" && req.Status != "Cleaning" && req.Status != "Maintenance") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "状态只能是 Available、Cleaning 或 Maintenance"})
+		return
+	}
+
+	res := database.Scoped(c).Model(&model.Bed{}).Where("id = ? AND status <> ?", c.Param("id"), "Occupied").Update("status", req.Status)
+	if res.Error != nil || res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "床位不存在或正在使用"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "床位状态已更新"})
+}
+
+type AdmissionRequest struct {
+	BookingID uint   `json:"booking_id"` // 由门诊收住院时填写
+	PatientID uint   `json:"patient_id"` // 直接入院时填写
+	DoctorID  uint   `json:"doctor_id"`  // 主治医生，默认为门诊医生
+	BedID     uint   `json:"bed_id" binding:"required"`
+	Diagnosis string `json:"diagnosis"`
+}
+
+// AdmitPatient 办理入院并占床
+// POST /inpatient/admissions
+func AdmitPatient(c *gin.Context) {
+	var req AdmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.BookingID == 0 && req.PatientID == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请指定挂号单或患者，以及床位"})
+		return
+	}
+
+	admission := model.Admission{
+		DoctorID:       req.DoctorID,
+		AdmitDiagnosis: req.Diagnosis,
+		Status:         "Admitted",
+		AdmittedAt:     time.Now(),
+		CreatedAt:      time.Now(),
+	}
+
+	// 1. 患者：来自门诊挂号单或患者档案
+	if req.BookingID != 0 {
+		var booking model.Booking
+		if err := database.Scoped(c).First(&booking, req.BookingID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "挂号单不存在"})
+			return
+		}
+		admission.BookingID = booking.ID
+		admission.PatientID = booking.PatientID
+		admission.Department = booking.Department
+		if admission.DoctorID == 0 {
+			admission.DoctorID = booking.DoctorID
+		}
+	} else {
+		admission.PatientID = req.PatientID
+	}
+
+	var patient model.Patient
+	if err := database.Scoped(c).First(&patient, admission.PatientID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者不存在"})
+		return
+	}
+	admission.OrgID = patient.OrgID
+	admission.PatientName = patient.Name
+	if admission.DoctorID == 0 && !can(c, "patient.all") {
+		admission.DoctorID = c.GetUint("user_id")
+	}
+
+	var active int64
+	database.Scoped(c).Model(&model.Admission{}).Where("patient_id = ? AND status = ?", patient.ID, "Admitted").Count(&active)
+	if active > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "该患者已在院"})
+		return
+	}
+
+	// 2. 占床 + 建立住院记录 (只能住患者所在机构的床位)
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		var bed model.Bed
+		if err := tx.Where("org_id = ?", admission.OrgID).First(&bed, req.BedID).Error; err != nil {
+			return errBedUnavailable
+		}
+		admission.BedID = bed.ID
+		admission.WardID = bed.WardID
+		if admission.Department == "" {
+			var ward model.Ward
+			tx.First(&ward, bed.WardID)
+			admission.Department = ward.Department
+		}
+
+		if err := tx.Create(&admission).Error; err != nil {
+			return err
+		}
+		return occupyBed(tx, bed.ID, admission.ID)
+	})
+	if err != nil {
+		if errors.Is(err, errBedUnavailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "办理入院失败"})
+		return
+	}
+
+	publishAdmission("admission.created", admission)
+	c.JSON(http.StatusOK, gin.H{"msg": "入院成功", "data": admission})
+}
+
+// GetAdmissions 住院患者列表 (医生只看自己主治的)
+// GET /inpatient/admissions?status=Admitted
+func GetAdmissions(c *gin.Context) {
+	var admissions []model.Admission
+	tx := database.Scoped(c).Where("status = ?", c.DefaultQuery("status", "Admitted")).Order("admitted_at desc")
+	if !can(c, "patient.all") {
+		tx = tx.Where("doctor_id = ?", c.GetUint("user_id"))
+	}
+	tx.Find(&admissions)
+	c.JSON(http.StatusOK, gin.H{"data": admissions})
+}
+
+// GetAdmission 住院详情：床位、费用明细、转床记录、账户余额
+// GET /inpatient/admissions/:id
+func GetAdmission(c *gin.Context) {
+	admission, ok := findAdmission(c)
+	if !ok {
+		return
+	}
+
+	var bed model.Bed
+	database.Scoped(c).First(&bed, admission.BedID)
+	var ward model.Ward
+	database.Scoped(c).First(&ward, admission.WardID)
+	var charges []model.InpatientCharge
+	database.Scoped(c).Where("admission_id = ?", admission.ID).Order("id asc").Find(&charges)
+	var transfers []model.BedTransfer
+	database.Scoped(c).Where("admission_id = ?", admission.ID).Order("id asc").Find(&transfers)
+
+	var total float64
+	for _, ch := range charges {
+		total += ch.Amount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      admission,
+		"ward":      ward,
+		"bed":       bed,
+		"charges":   charges,
+		"transfers": transfers,
+		"total":     total,
+	})
+}
+
+// TransferBed 转床 (可跨病区)；转出前先按原床位结算床位费
+// POST /inpatient/admissions/:id/transfer  {"bed_id": 3, "reason": "..."}
+func TransferBed(c *gin.Context) {
+	var req struct {
+		BedID  uint   `json:"bed_id" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请选择床位"})
+		return
+	}
+
+	admission, ok := findAdmission(c)
+	if !ok {
+		return
+	}
+	if admission.Status != "Admitted" {
+		c.JSON(http.StatusConflict, gin.H{"error": "患者已出院"})
+		return
+	}
+	if admission.BedID == req.BedID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目标床位与当前床位相同"})
+		return
+	}
+
+	transfer := model.BedTransfer{
+		OrgID:         admission.OrgID,
+		AdmissionID:   admission.ID,
+		FromBedID:     admission.BedID,
+		ToBedID:       req.BedID,
+		Reason:        req.Reason,
+		TransferredBy: c.GetUint("user_id"),
+		CreatedAt:     time.Now(),
+	}
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		if err := reloadAdmitted(tx, &admission); err != nil {
+			return err
+		}
+		transfer.FromBedID = admission.BedID
+		if err := accrueBedCharges(tx, &admission, time.Now().Format(dateLayout)); err != nil {
+			return err
+		}
+
+		var bed model.Bed
+		if err := tx.Where("org_id = ?", admission.OrgID).First(&bed, req.BedID).Error; err != nil {
+			return errBedUnavailable
+		}
+		if err := occupyBed(tx, bed.ID, admission.ID); err != nil {
+			return err
+		}
+		if err := releaseBed(tx, admission.BedID); err != nil {
+			return err
+		}
+
+		admission.BedID = bed.ID
+		admission.WardID = bed.WardID
+		if err := tx.Model(&admission).Updates(map[string]interface{}{"bed_id": bed.ID, "ward_id": bed.WardID}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&transfer).Error
+	})
+	if err != nil {
+		if errors.Is(err, errBedUnavailable) || errors.Is(err, errNotAdmitted) || errors.Is(err, errChargeConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转床失败"})
+		return
+	}
+
+	publishAdmission("admission.transferred", admission)
+	c.JSON(http.StatusOK, gin.H{"msg": "转床成功", "data": transfer})
+}
+
+// AddDrugOrder 住院药品医嘱：发药即扣库存，费用计入住院账户
+// POST /inpatient/admissions/:id/drug_orders  {"medicine_id": 1, "quantity": 2}
+func AddDrugOrder(c *gin.Context) {
+	var req struct {
+		MedicineID uint `json:"medicine_id" binding:"required"`
+		Quantity   int  `json:"quantity" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	admission, ok := findAdmission(c)
+	if !ok {
+		return
+	}
+	if admission.Status != "Admitted" {
+		c.JSON(http.StatusConflict, gin.H{"error": "患者已出院"})
+		return
+	}
+
+	var med model.InventoryItem
+	if err := database.Scoped(c).Where("org_id = ?", admission.OrgID).First(&med, req.MedicineID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "药品不存在"})
+		return
+	}
+
+	charge := model.InpatientCharge{
+		OrgID:       admission.OrgID,
+		AdmissionID: admission.ID,
+		Type:        "drug",
+		Description: med.Name,
+		ChargeDate:  time.Now().Format(dateLayout),
+		MedicineID:  med.ID,
+		Quantity:    req.Quantity,
+		UnitPrice:   med.Price,
+		Amount:      med.Price * float64(req.Quantity),
+		OrderedBy:   c.GetUint("user_id"),
+		CreatedAt:   time.Now(),
+	}
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		// 与出院结算互斥：出院已提交时不能再计入 (否则费用落在已汇总的结算单之外)
+		if err := reloadAdmitted(tx, &admission); err != nil {
+			return err
+		}
+		// 条件扣减，避免并发发药把库存扣成负数
+		res := tx.Model(&model.InventoryItem{}).Where("id = ? AND stock >= ?", med.ID, req.Quantity).
+			Update("stock", gorm.Expr("stock - ?", req.Quantity))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("库存不足")
+		}
+		return tx.Create(&charge).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	med.Stock -= req.Quantity
+	publishStockLow(med)
+	c.JSON(http.StatusOK, gin.H{"msg": "医嘱已执行", "data": charge})
+}
+
+// DischargePatient 出院：计清床位费，写出院小结，住院账户汇总为一张待缴费订单
+// POST /inpatient/admissions/:id/discharge  {"diagnosis": "...", "summary": "..."}
+func DischargePatient(c *gin.Context) {
+	var req struct {
+		Diagnosis string `json:"diagnosis"`
+		Summary   string `json:"summary" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写出院小结"})
+		return
+	}
+
+	admission, ok := findAdmission(c)
+	if !ok {
+		return
+	}
+	if admission.Status != "Admitted" {
+		c.JSON(http.StatusConflict, gin.H{"error": "患者已出院"})
+		return
+	}
+
+	now := time.Now()
+	var order model.Order
+	err := database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		// 0. 以事务内的住院状态为准，并发出院只有一个能生成结算单
+		if err := reloadAdmitted(tx, &admission); err != nil {
+			return err
+		}
+
+		// 1. 床位费“算入不算出”：计到出院前一天，当天入当天出按一天计
+		today := now.Format(dateLayout)
+		if err := accrueBedCharges(tx, &admission, today); err != nil {
+			return err
+		}
+		var bedDays int64
+		tx.Model(&model.InpatientCharge{}).Where("admission_id = ? AND type = ?", admission.ID, "bed").Count(&bedDays)
+		if bedDays == 0 {
+			if err := addBedCharge(tx, &admission, today); err != nil {
+				return err
+			}
+		}
+
+		// 2. 汇总住院账户
+		var total float64
+		tx.Model(&model.InpatientCharge{}).Where("admission_id = ?", admission.ID).
+			Select("COALESCE(SUM(amount), 0)").Scan(&total)
+
+		order = model.Order{
+			OrgID:       admission.OrgID,
+			BookingID:   admission.BookingID,
+			TotalAmount: total,
+			Status:      "Unpaid",
+			AdmissionID: admission.ID,
+			Quantity:    1,
+			CreatedAt:   now,
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+
+		// 3. 出院并释放床位 (待清洁)
+		admission.Status = "Discharged"
+		admission.DischargedAt = &now
+		admission.DischargeDiagnosis = req.Diagnosis
+		admission.DischargeSummary = req.Summary
+		admission.OrderID = order.ID
+		res := tx.Model(&model.Admission{}).Where("id = ? AND status = ?", admission.ID, "Admitted").Updates(map[string]interface{}{
+			"status":              admission.Status,
+			"discharged_at":       now,
+			"discharge_diagnosis": req.Diagnosis,
+			"discharge_summary":   req.Summary,
+			"order_id":            order.ID,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errNotAdmitted
+		}
+		return releaseBed(tx, admission.BedID)
+	})
+	if err != nil {
+		if errors.Is(err, errNotAdmitted) || errors.Is(err, errChargeConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "办理出院失败"})
+		return
+	}
+
+	publishAdmission("admission.discharged", admission)
+	c.JSON(http.StatusOK, gin.H{"msg": "出院成功，已生成结算单", "data": admission, "order": order})
+}
+
+// RunBedChargeAccrual 定时把在院患者的床位费计到前一天
+// 列表只用来确定要处理哪些住院记录，计费以事务内重新读取的状态和计费日期为准 (期间可能已出院或转床)
+func RunBedChargeAccrual(interval time.Duration) {
+	for {
+		var admissions []model.Admission
+		database.DB.Where("status = ?", "Admitted").Find(&admissions)
+		today := time.Now().Format(dateLayout)
+		for i := range admissions {
+			err := database.ForOrg(admissions[i].OrgID).Transaction(func(tx *gorm.DB) error {
+				if err := reloadAdmitted(tx, &admissions[i]); err != nil {
+					return err
+				}
+				return accrueBedCharges(tx, &admissions[i], today)
+			})
+			if err != nil && !errors.Is(err, errNotAdmitted) && !errors.Is(err, errChargeConflict) {
+				log.Printf("住院 %d 床位费计费失败: %v", admissions[i].ID, err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// accrueBedCharges 按当前床位价格补记床位费，计到 until 的前一天
+func accrueBedCharges(tx *gorm.DB, admission *model.Admission, until string) error {
+	start := admission.AdmittedAt.In(time.Local).Format(dateLayout)
+	if admission.ChargedThrough != "" {
+		last, err := time.ParseInLocation(dateLayout, admission.ChargedThrough, time.Local)
+		if err != nil {
+			return err
+		}
+		start = last.AddDate(0, 0, 1).Format(dateLayout)
+	}
+
+	day, err := time.ParseInLocation(dateLayout, start, time.Local)
+	if err != nil {
+		return err
+	}
+	for d := day.Format(dateLayout); d < until; d = day.Format(dateLayout) {
+		if err := addBedCharge(tx, admission, d); err != nil {
+			return err
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return nil
+}
+
+// addBedCharge 记一天床位费并推进计费日期
+func addBedCharge(tx *gorm.DB, admission *model.Admission, date string) error {
+	var bed model.Bed
+	if err := tx.First(&bed, admission.BedID).Error; err != nil {
+		return err
+	}
+	var ward model.Ward
+	tx.First(&ward, bed.WardID)
+
+	rate := bed.DailyRate
+	if rate == 0 {
+		rate = ward.DailyRate
+	}
+	charge := model.InpatientCharge{
+		OrgID:       admission.OrgID,
+		AdmissionID: admission.ID,
+		Type:        "bed",
+		Description: fmt.Sprintf("床位费 %s %s床", ward.Name, bed.Number),
+		ChargeDate:  date,
+		Quantity:    1,
+		UnitPrice:   rate,
+		Amount:      rate,
+		CreatedAt:   time.Now(),
+	}
+	// 以读到的计费日期为条件推进，被并发计费抢先时整笔回滚 (同一天的床位费另有唯一索引兜底)
+	res := tx.Model(&model.Admission{}).
+		Where("id = ? AND COALESCE(charged_through, '') = ?", admission.ID, admission.ChargedThrough).
+		Update("charged_through", date)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errChargeConflict
+	}
+	admission.ChargedThrough = date
+	return tx.Create(&charge).Error
+}
+
+// reloadAdmitted 在事务内锁定并重新读取住院记录，已出院时返回 errNotAdmitted
+// 先用条件更新取得写锁 (相当于 SELECT ... FOR UPDATE)：只读不写的事务在 SQLite 中读到的是开始时的快照，
+// 并发的出院提交后再写入只会报错，而不会等待后读到最新状态
+func reloadAdmitted(tx *gorm.DB, admission *model.Admission) error {
+	res := tx.Model(&model.Admission{}).Where("id = ? AND status = ?", admission.ID, "Admitted").Update("status", "Admitted")
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errNotAdmitted
+	}
+	return tx.First(admission, admission.ID).Error
+}
+
+// occupyBed 条件更新占床，防止同一张床被并发分配
+func occupyBed(tx *gorm.DB, bedID, admissionID uint) error {
+	res := tx.Model(&model.Bed{}).Where("id = ? AND status = ?", bedID, "Available").
+		Updates(map[string]interface{}{"status": "Occupied", "admission_id": admissionID})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errBedUnavailable
+	}
+	return nil
+}
+
+// releaseBed 患者离开后床位进入待清洁
+func releaseBed(tx *gorm.DB, bedID uint) error {
+	return tx.Model(&model.Bed{}).Where("id = ?", bedID).
+		Updates(map[string]interface{}{"status": "Cleaning", "admission_id": 0}).Error
+}
+
+// findAdmission 取住院记录，医生只能操作自己主治的患者
+func findAdmission(c *gin.Context) (model.Admission, bool) {
+	var admission model.Admission
+	id, ok := paramID(c, "id")
+	if !ok {
+		return admission, false
+	}
+	if err := database.Scoped(c).First(&admission, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "住院记录不存在"})
+		return admission, false
+	}
+	if !can(c, "patient.all") && admission.DoctorID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能操作本人主治的患者"})
+		return admission, false
+	}
+	return admission, true
+}
+
+// publishAdmission 入院/转床/出院 (病房相关人员可见)
+func publishAdmission(typ string, admission model.Admission) {
+	events.Publish(events.Event{
+		Type:        typ,
+		OrgID:       admission.OrgID,
+		Permissions: []string{"inpatient.read"},
+		Department:  admission.Department,
+		DoctorID:    admission.DoctorID,
+		Data:        admission,
+	})
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 出院、计费、医嘱并发时，住院账户只结算一次、床位费不重复、结算单包含全部费用
+
+// admitFixture 三天前入院的一位患者 (床位费 100 元/天)
+func admitFixture(t *testing.T, name string) model.Admission {
+	t.Helper()
+	db := database.ForOrg(model.DefaultOrgID)
+	ward := model.Ward{Name: "病区-" + name, Department: "内科", DailyRate: 100}
+	if err := db.Create(&ward).Error; err != nil {
+		t.Fatal(err)
+	}
+	bed := model.Bed{WardID: ward.ID, Number: "01", Status: "Occupied"}
+	if err := db.Create(&bed).Error; err != nil {
+		t.Fatal(err)
+	}
+	patient := model.Patient{Name: name}
+	if err := db.Create(&patient).Error; err != nil {
+		t.Fatal(err)
+	}
+	admission := model.Admission{
+		PatientID: patient.ID, PatientName: name, DoctorID: 1, Department: "内科",
+		WardID: ward.ID, BedID: bed.ID, Status: "Admitted", AdmittedAt: time.Now().AddDate(0, 0, -3),
+	}
+	if err := db.Create(&admission).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&bed).Update("admission_id", admission.ID)
+	return admission
+}
+
+func admissionParam(a model.Admission) gin.Param {
+	return gin.Param{Key: "id", Value: strconv.Itoa(int(a.ID))}
+}
+
+var defaultOrg = database.Tenant{OrgID: model.DefaultOrgID}
+
+func TestConcurrentDischargeSettlesOnce(t *testing.T) {
+	admission := admitFixture(t, "并发出院")
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := callHandler(DischargePatient, authz.SuperRole, defaultOrg, `{"summary": "好转出院"}`, admissionParam(admission))
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			ok++
+		}
+	}
+	if ok != 1 {
+		t.Errorf("discharge responses %v, want exactly one 200", codes)
+	}
+	var orders int64
+	database.DB.Model(&model.Order{}).Where("admission_id = ?", admission.ID).Count(&orders)
+	if orders != 1 {
+		t.Errorf("%d settlement orders, want 1", orders)
+	}
+	var bedDays int64
+	database.DB.Model(&model.InpatientCharge{}).Where("admission_id = ? AND type = ?", admission.ID, "bed").Count(&bedDays)
+	if bedDays != 3 {
+		t.Errorf("%d bed charges, want 3", bedDays)
+	}
+}
+
+func TestStaleAccrualDoesNotRebill(t *testing.T) {
+	admission := admitFixture(t, "计费快照")
+	stale := admission // 计费任务在循环前取到的快照
+	today := time.Now().Format(dateLayout)
+
+	db := database.ForOrg(model.DefaultOrgID)
+	if err := db.Transaction(func(tx *gorm.DB) error { return accrueBedCharges(tx, &admission, today) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// 用旧的计费日期再计一次：推进计费日期的条件更新失败，整笔回滚
+	err := db.Transaction(func(tx *gorm.DB) error { return accrueBedCharges(tx, &stale, today) })
+	if !errors.Is(err, errChargeConflict) {
+		t.Errorf("stale accrual err = %v, want errChargeConflict", err)
+	}
+	var bedDays int64
+	database.DB.Model(&model.InpatientCharge{}).Where("admission_id = ? AND type = ?", admission.ID, "bed").Count(&bedDays)
+	if bedDays != 3 {
+		t.Errorf("%d bed charges after stale accrual, want 3", bedDays)
+	}
+
+	// 唯一索引兜底：同一天的床位费不能写两条，药品费不受限制
+	day := model.InpatientCharge{AdmissionID: admission.ID, Type: "bed", ChargeDate: admission.ChargedThrough, Amount: 100}
+	if err := db.Create(&day).Error; err == nil {
+		t.Error("duplicate bed charge for the same day was inserted")
+	}
+	for i := 0; i < 2; i++ {
+		drug := model.InpatientCharge{AdmissionID: admission.ID, Type: "drug", ChargeDate: today, Amount: 5}
+		if err := db.Create(&drug).Error; err != nil {
+			t.Errorf("drug charge %d: %v", i, err)
+		}
+	}
+}
+
+func TestDrugOrderRacingDischarge(t *testing.T) {
+	admission := admitFixture(t, "医嘱出院")
+	med := model.InventoryItem{Name: "阿莫西林-" + strconv.Itoa(int(admission.ID)), Price: 10, Stock: 100}
+	if err := database.ForOrg(model.DefaultOrgID).Create(&med).Error; err != nil {
+		t.Fatal(err)
+	}
+	body := `{"medicine_id": ` + strconv.Itoa(int(med.ID)) + `, "quantity": 1}`
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 4 {
+				callHandler(DischargePatient, authz.SuperRole, defaultOrg, `{"summary": "出院"}`, admissionParam(admission))
+				return
+			}
+			callHandler(AddDrugOrder, authz.SuperRole, defaultOrg, body, admissionParam(admission))
+		}(i)
+	}
+	wg.Wait()
+
+	// 结算单金额等于住院账户的全部费用：没有在汇总之后再计入的医嘱
+	var order model.Order
+	if err := database.DB.Where("admission_id = ?", admission.ID).First(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	var total float64
+	database.DB.Model(&model.InpatientCharge{}).Where("admission_id = ?", admission.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&total)
+	if order.TotalAmount != total {
+		t.Errorf("settlement %.2f, charges %.2f", order.TotalAmount, total)
+	}
+}
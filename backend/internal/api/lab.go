@@ -0,0 +1,347 @@
+package api
+
+import (
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 检验科 (Lab) ---
+// 医生开单 -> 生成收费行 -> 检验科采样、录入结果 -> 结果回到病历和医生工作台
+
+// GetLabTests 检验项目目录
+func GetLabTests(c *gin.Context) {
+	var tests []model.LabTest
+	tx := database.Scoped(c).Order("code asc")
+	if c.Query("all") != "1" {
+		tx = tx.Where("active = ?", true)
+	}
+	tx.Find(&tests)
+	c.JSON(http.StatusOK, gin.H{"data": tests})
+}
+
+// SaveLabTest 新增/修改检验项目 (按编码匹配)
+func SaveLabTest(c *gin.Context) {
+	var req struct {
+		model.LabTest
+		Active *bool `json:"active"` // 不传时：新项目默认启用，已有项目保持原状态
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：编码和名称必填"})
+		return
+	}
+
+	// 只按编码匹配，忽略请求体里的 id (否则会覆盖另一个项目)
+	test := req.LabTest
+	test.ID, test.CreatedAt = 0, time.Time{}
+	test.Code = strings.ToUpper(strings.TrimSpace(test.Code))
+	test.Active = true
+
+	var existing model.LabTest
+	if err := database.Scoped(c).Where("code = ?", test.Code).First(&existing).Error; err == nil {
+		test.ID = existing.ID
+		test.CreatedAt = existing.CreatedAt
+		test.Active = existing.Active
+	}
+	if req.Active != nil {
+		test.Active = *req.Active
+	}
+	if err := database.Scoped(c).Save(&test).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "保存成功", "data": test})
+}
+
+type LabOrderRequest struct {
+	BookingID uint   `json:"booking_id" binding:"required"`
+	TestIDs   []uint `json:"test_ids" binding:"required"`
+}
+
+// CreateLabOrders 医生开检验单，每个项目生成一条待缴费订单
+// POST /doctor/lab_orders
+func CreateLabOrders(c *gin.Context) {
+	var req LabOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.TestIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	tx := database.Scoped(c).Begin()
+
+	var booking model.Booking
+	if err := tx.First(&booking, req.BookingID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "挂号单不存在"})
+		return
+	}
+	if !can(c, "patient.all") && booking.DoctorID != userID {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能为本人接诊的患者开单"})
+		return
+	}
+
+	var created []model.LabOrder
+	for _, testID := range req.TestIDs {
+		var test model.LabTest
+		if err := tx.Where("id = ? AND active = ?", testID, true).First(&test).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("检验项目不存在: %d", testID)})
+			return
+		}
+
+		labOrder := model.LabOrder{
+			OrgID:     booking.OrgID,
+			BookingID: booking.ID,
+			TestID:    test.ID,
+			TestCode:  test.Code,
+			TestName:  test.Name,
+			DoctorID:  userID,
+			Status:    "Ordered",
+			Unit:      test.Unit,
+			RefRange:  refRangeText(test),
+		}
+		if err := tx.Create(&labOrder).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "开单失败"})
+			return
+		}
+
+		// 收费行：与药品订单走同一个缴费流程
+		order := model.Order{
+			OrgID:       booking.OrgID,
+			BookingID:   booking.ID,
+			TotalAmount: test.Price,
+			Status:      "Unpaid",
+			LabOrderID:  labOrder.ID,
+			Quantity:    1,
+			CreatedAt:   time.Now(),
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成订单失败"})
+			return
+		}
+		labOrder.OrderID = order.ID
+		tx.Model(&labOrder).Update("order_id", order.ID)
+
+		created = append(created, labOrder)
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"msg": "检验单已开具", "data": created})
+}
+
+// GetLabWorklist 检验科工作列表
+// GET /lab/orders?status=Ordered
+func GetLabWorklist(c *gin.Context) {
+	status := c.DefaultQuery("status", "Ordered")
+
+	var orders []LabOrderDetail
+	database.Scoped(c).Table("lab_orders").
+		Select("lab_orders.*, bookings.patient_name, bookings.department").
+		Joins("JOIN bookings ON bookings.id = lab_orders.booking_id").
+		Where("lab_orders.status = ?", status).
+		Order("lab_orders.created_at asc").
+		Scan(&orders)
+	c.JSON(http.StatusOK, gin.H{"data": orders})
+}
+
+// LabOrderDetail 检验单 + 患者信息
+type LabOrderDetail struct {
+	model.LabOrder
+	PatientName string `json:"patient_name"`
+	Department  string `json:"department"`
+}
+
+// CollectSpecimen 登记标本采集
+// POST /lab/orders/:id/collect
+func CollectSpecimen(c *gin.Context) {
+	var req struct {
+		SpecimenNo string `json:"specimen_no"`
+	}
+	c.ShouldBindJSON(&req)
+
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var labOrder model.LabOrder
+	if err := database.Scoped(c).First(&labOrder, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "检验单不存在"})
+		return
+	}
+	if labOrder.Status != "Ordered" {
+		c.JSON(http.StatusConflict, gin.H{"error": "该检验单已采样"})
+		return
+	}
+
+	if req.SpecimenNo == "" {
+		req.SpecimenNo = fmt.Sprintf("S%s%06d", time.Now().Format("060102"), labOrder.ID)
+	}
+	now := time.Now()
+	labOrder.Status = "Collected"
+	labOrder.SpecimenNo = req.SpecimenNo
+	labOrder.CollectedAt = &now
+	labOrder.CollectedBy = c.GetUint("user_id")
+	database.Scoped(c).Save(&labOrder)
+
+	c.JSON(http.StatusOK, gin.H{"msg": "采样完成", "data": labOrder})
+}
+
+type LabResultRequest struct {
+	Value string `json:"value" binding:"required"`
+	Note  string `json:"note"`
+}
+
+// SubmitLabResult 录入检验结果
+// POST /lab/orders/:id/result
+func SubmitLabResult(c *gin.Context) {
+	var req LabResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：结果必填"})
+		return
+	}
+
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var labOrder model.LabOrder
+	if err := database.Scoped(c).First(&labOrder, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "检验单不存在"})
+		return
+	}
+	if labOrder.Status != "Collected" {
+		c.JSON(http.StatusConflict, gin.H{"error": "请先登记采样"})
+		return
+	}
+
+	if err := recordLabResult(database.Scoped(c), &labOrder, req.Value, req.Note, c.GetUint("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存结果失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "结果已发布", "data": labOrder})
+}
+
+// recordLabResult 写入结果并按参考范围判定异常标志
+// 结果发布后重置“已查看”，出现在开单医生的工作台上
+func recordLabResult(db *gorm.DB, labOrder *model.LabOrder, value, note string, userID uint) error {
+	var test model.LabTest
+	db.First(&test, labOrder.TestID)
+
+	now := time.Now()
+	labOrder.Status = "Resulted"
+	labOrder.ResultValue = strings.TrimSpace(value)
+	labOrder.ResultNote = note
+	labOrder.Flag = labFlag(test, labOrder.ResultValue)
+	labOrder.RefRange = refRangeText(test)
+	labOrder.ResultedAt = &now
+	labOrder.ResultedBy = userID
+	labOrder.Acknowledged = false
+	labOrder.AcknowledgedAt = nil
+	if err := db.Save(labOrder).Error; err != nil {
+		return err
+	}
+
+	publishLabResult(*labOrder)
+	return nil
+}
+
+// labFlag 根据参考范围与危急值判定结果标志
+func labFlag(test model.LabTest, value string) string {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		// 定性结果：与正常值不一致即为异常
+		if test.RefText != "" && value != test.RefText {
+			return "A"
+		}
+		return "N"
+	}
+	switch {
+	case test.CriticalLow != nil && v < *test.CriticalLow:
+		return "LL"
+	case test.CriticalHigh != nil && v > *test.CriticalHigh:
+		return "HH"
+	case test.RefLow != nil && v < *test.RefLow:
+		return "L"
+	case test.RefHigh != nil && v > *test.RefHigh:
+		return "H"
+	}
+	return "N"
+}
+
+func refRangeText(test model.LabTest) string {
+	switch {
+	case test.RefLow != nil && test.RefHigh != nil:
+		return strconv.FormatFloat(*test.RefLow, 'f', -1, 64) + "-" + strconv.FormatFloat(*test.RefHigh, 'f', -1, 64)
+	case test.RefLow != nil:
+		return ">=" + strconv.FormatFloat(*test.RefLow, 'f', -1, 64)
+	case test.RefHigh != nil:
+		return "<=" + strconv.FormatFloat(*test.RefHigh, 'f', -1, 64)
+	}
+	return test.RefText
+}
+
+// GetDoctorLabResults 医生工作台：本人开单、已出结果的检验
+// GET /doctor/lab_results?unread=1
+func GetDoctorLabResults(c *gin.Context) {
+	var results []LabOrderDetail
+	tx := database.Scoped(c).Table("lab_orders").
+		Select("lab_orders.*, bookings.patient_name, bookings.department").
+		Joins("JOIN bookings ON bookings.id = lab_orders.booking_id").
+		Where("lab_orders.status = ?", "Resulted").
+		Order("lab_orders.resulted_at desc")
+
+	if !can(c, "patient.all") {
+		tx = tx.Where("lab_orders.doctor_id = ?", c.GetUint("user_id"))
+	}
+	if c.Query("unread") == "1" {
+		tx = tx.Where("lab_orders.acknowledged = ?", false)
+	}
+	tx.Scan(&results)
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
+
+// AcknowledgeLabResult 医生确认已查看结果
+// POST /doctor/lab_results/:id/ack
+func AcknowledgeLabResult(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var labOrder model.LabOrder
+	if err := database.Scoped(c).First(&labOrder, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "检验单不存在"})
+		return
+	}
+	if !can(c, "patient.all") && labOrder.DoctorID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能确认本人开具的检验"})
+		return
+	}
+
+	now := time.Now()
+	database.Scoped(c).Model(&labOrder).Updates(map[string]interface{}{"acknowledged": true, "acknowledged_at": now})
+	c.JSON(http.StatusOK, gin.H{"msg": "已确认"})
+}
+
+// GetRecordLabResults 病历关联的检验结果 (与病历同一套查看权限)
+// GET /medical_record/:id/lab_results
+func GetRecordLabResults(c *gin.Context) {
+	record, ok := findVisibleRecord(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var orders []model.LabOrder
+	database.Scoped(c).Where("booking_id = ?", record.BookingID).Order("created_at asc").Find(&orders)
+	c.JSON(http.StatusOK, gin.H{"data": orders})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// 检验项目按编码保存：请求体里的 id 不能覆盖其他项目，停用状态原样保存
+func TestSaveLabTest(t *testing.T) {
+	save := func(body string) model.LabTest {
+		t.Helper()
+		w := callHandler(SaveLabTest, authz.SuperRole, defaultOrg, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("save %s: %d %s", body, w.Code, w.Body)
+		}
+		var resp struct {
+			Data model.LabTest `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Data
+	}
+	load := func(id uint) model.LabTest {
+		var test model.LabTest
+		database.DB.First(&test, id)
+		return test
+	}
+
+	// 新建时停用
+	off := save(`{"code": "tst-off", "name": "停用项目", "active": false}`)
+	if load(off.ID).Active {
+		t.Error("new lab test saved with active=false is active")
+	}
+	// 不传 active：新项目默认启用，已有项目保持原状态
+	on := save(`{"code": "tst-on", "name": "启用项目"}`)
+	if !load(on.ID).Active {
+		t.Error("new lab test without active is inactive")
+	}
+	save(`{"code": "TST-OFF", "name": "停用项目 (改名)"}`)
+	if got := load(off.ID); got.Active || got.Name != "停用项目 (改名)" {
+		t.Errorf("update without active: %+v", got)
+	}
+
+	// 带着别的项目的 id 新建：按编码新增，不覆盖 id 对应的项目
+	other := save(`{"id": ` + strconv.Itoa(int(on.ID)) + `, "code": "tst-new", "name": "新项目"}`)
+	if other.ID == on.ID {
+		t.Fatal("lab test with a foreign id overwrote another test")
+	}
+	if got := load(on.ID); got.Code != "TST-ON" || got.Name != "启用项目" {
+		t.Errorf("lab test %d changed to %+v", on.ID, got)
+	}
+
+	// 停用已有项目
+	save(`{"code": "tst-on", "name": "启用项目", "active": false}`)
+	if load(on.ID).Active {
+		t.Error("deactivating an existing lab test had no effect")
+	}
+}
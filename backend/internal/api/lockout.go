@@ -0,0 +1,242 @@
+package api
+
+import (
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- 登录防暴力破解 ---
+// 按用户名和 IP 分别计数：同一用户名每次失败后等待时间指数增长，用户名 / IP 连续失败达到上限后临时锁定
+
+// loginMu 保护失败计数的读-改-写
+var loginMu sync.Mutex
+
+const (
+	maxLoginBackoff = 5 * time.Minute
+	maxLockout      = 24 * time.Hour
+)
+
+// dummyUser 用户名不存在时也做一次 bcrypt 比对，避免通过响应时间判断用户是否存在
+var dummyUser = func() model.User {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	return model.User{Password: string(hash)}
+}()
+
+// loginLimits 读取配置，未配置时使用默认值
+func loginLimits() (userMax, ipMax int, lockout, backoffBase, window time.Duration) {
+	cfg := config.AppConfig.Login
+	userMax, ipMax = cfg.MaxFailures, cfg.IPMaxFailures
+	if userMax <= 0 {
+		userMax = 5
+	}
+	if ipMax <= 0 {
+		ipMax = 20
+	}
+	lockout = time.Duration(cfg.LockoutMinutes) * time.Minute
+	if lockout <= 0 {
+		lockout = 15 * time.Minute
+	}
+	backoffBase = time.Duration(cfg.BackoffBaseSeconds) * time.Second
+	if backoffBase <= 0 {
+		backoffBase = time.Second
+	}
+	window = time.Duration(cfg.WindowMinutes) * time.Minute
+	if window <= 0 {
+		window = 30 * time.Minute
+	}
+	return
+}
+
+func userThrottleKey(username string) string { return "user:" + strings.ToLower(username) }
+func ipThrottleKey(ip string) string         { return "ip:" + ip }
+
+// loginBackoff 第 n 次失败后需要等待的时间
+func loginBackoff(base time.Duration, failures int) time.Duration {
+	d := base
+	for i := 1; i < failures && d < maxLoginBackoff; i++ {
+		d *= 2
+	}
+	if d > maxLoginBackoff {
+		d = maxLoginBackoff
+	}
+	return d
+}
+
+// loginRetryAfter 还要等多久才能再次尝试登录，0 表示现在就可以
+func loginRetryAfter(username, ip string, now time.Time) time.Duration {
+	_, _, _, backoffBase, window := loginLimits()
+
+	var throttles []model.LoginThrottle
+	database.DB.Where("key IN ?", []string{userThrottleKey(username), ipThrottleKey(ip)}).Find(&throttles)
+
+	var wait time.Duration
+	for _, t := range throttles {
+		var until time.Time
+		if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+			until = *t.LockedUntil
+		} else if strings.HasPrefix(t.Key, "user:") && t.Failures > 0 && now.Sub(t.LastFailureAt) < window {
+			// 退避只针对用户名；同一出口 IP 可能有很多正常用户，IP 只在达到上限后锁定
+			until = t.LastFailureAt.Add(loginBackoff(backoffBase, t.Failures))
+		}
+		if d := until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// recordLoginFailure 记一次失败，返回因此被锁定的计数项
+func recordLoginFailure(username, ip string, now time.Time) []model.LoginThrottle {
+	userMax, ipMax, lockout, _, window := loginLimits()
+
+	loginMu.Lock()
+	defer loginMu.Unlock()
+
+	var locked []model.LoginThrottle
+	limits := map[string]int{userThrottleKey(username): userMax, ipThrottleKey(ip): ipMax}
+	for key, limit := range limits {
+		var t model.LoginThrottle
+		database.DB.Where("key = ?", key).FirstOrInit(&t, model.LoginThrottle{Key: key})
+
+		if now.Sub(t.LastFailureAt) > window {
+			t.Failures = 0
+		}
+		if now.Sub(t.LastFailureAt) > maxLockout {
+			t.LockCount = 0
+		}
+		t.Failures++
+		t.LastFailureAt = now
+
+		if t.Failures >= limit {
+			t.LockCount++
+			d := lockout
+			for i := 1; i < t.LockCount && d < maxLockout; i++ {
+				d *= 2
+			}
+			if d > maxLockout {
+				d = maxLockout
+			}
+			until := now.Add(d)
+			t.LockedUntil = &until
+			t.Failures = 0
+			locked = append(locked, t)
+		}
+		database.DB.Save(&t)
+	}
+	return locked
+}
+
+// resetLoginFailures 登录成功后清除该用户名的失败计数 (IP 计数保留，防止用自己的账号为撞库 IP 解锁)
+func resetLoginFailures(username string) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	database.DB.Where("key = ?", userThrottleKey(username)).Delete(&model.LoginThrottle{})
+}
+
+// tooManyAttempts 统一的限流响应，不区分用户名是否存在
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(wait.Seconds()) + 1
+	c.Header("Retry-After", fmt.Sprint(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("登录尝试过于频繁，请 %d 秒后再试", seconds)})
+}
+
+// GetLoginLockouts 当前被锁定或正在累计失败的用户名 / IP
+// 只列出本机构用户的用户名计数；IP 不属于任何机构，只有全局管理员 (org.all) 可见
+// GET /dashboard/users/lockouts
+func GetLoginLockouts(c *gin.Context) {
+	_, _, _, _, window := loginLimits()
+	now := time.Now()
+
+	usernames := database.Scoped(c).Model(&model.User{}).Select("'user:' || LOWER(username)")
+	tx := database.DB.Where("locked_until > ? OR (failures > 0 AND last_failure_at > ?)", now, now.Add(-window))
+	if can(c, "org.all") {
+		tx = tx.Where("key IN (?) OR key LIKE ?", usernames, "ip:%")
+	} else {
+		tx = tx.Where("key IN (?)", usernames)
+	}
+
+	var throttles []model.LoginThrottle
+	tx.Order("last_failure_at desc").Find(&throttles)
+	c.JSON(http.StatusOK, gin.H{"data": throttles})
+}
+
+// ClearLoginLockout 解除某个用户名或 IP 的锁定
+// IP 锁定只有全局管理员可以解除；用户名锁定与 UnlockUser 一样要求有权管理该用户
+// DELETE /dashboard/users/lockouts?key=ip:1.2.3.4
+func ClearLoginLockout(c *gin.Context) {
+	key := c.Query("key")
+	switch {
+	case strings.HasPrefix(key, "ip:"):
+		if !can(c, "org.all") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有全局管理员可以解除 IP 锁定"})
+			return
+		}
+		unlockKey(c, key, 0)
+	case strings.HasPrefix(key, "user:"):
+		var user model.User
+		err := database.Scoped(c).Where("LOWER(username) = ?", strings.TrimPrefix(key, "user:")).First(&user).Error
+		if err != nil {
+			// 不存在的用户名 (撞库产生的计数) 不属于任何机构，同 IP 一样只有全局管理员可以清除
+			if !can(c, "org.all") {
+				c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+				return
+			}
+			unlockKey(c, key, 0)
+			return
+		}
+		if !canManageUser(c, user) {
+			return
+		}
+		unlockKey(c, userThrottleKey(user.Username), user.ID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key 应为 user:<用户名> 或 ip:<地址>"})
+	}
+}
+
+// UnlockUser 解除账号锁定
+// POST /dashboard/users/:id/unlock
+func UnlockUser(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var user model.User
+	if err := database.Scoped(c).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	unlockKey(c, userThrottleKey(user.Username), user.ID)
+}
+
+func unlockKey(c *gin.Context, key string, userID uint) {
+	loginMu.Lock()
+	result := database.DB.Where("key = ?", key).Delete(&model.LoginThrottle{})
+	loginMu.Unlock()
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusOK, gin.H{"msg": "未被锁定"})
+		return
+	}
+
+	username := ""
+	if strings.HasPrefix(key, "user:") {
+		username = strings.TrimPrefix(key, "user:")
+	}
+	logSecurityEvent(c, "account_unlocked", username, userID, fmt.Sprintf("%s 由管理员 %d 解锁", key, c.GetUint("user_id")))
+	c.JSON(http.StatusOK, gin.H{"msg": "已解锁"})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 院区管理员只能查看和解除本机构用户的登录锁定，IP 锁定只有全局管理员可以处理
+
+func lockoutFixture(t *testing.T) (main, branch model.User) {
+	t.Helper()
+	branchFixture(t)
+	main = model.User{Username: "Lock_Main", Password: "Passw0rd!x", Role: "doctor"}
+	branch = model.User{Username: "lock_branch", Password: "Passw0rd!x", Role: "doctor"}
+	if err := database.ForOrg(model.DefaultOrgID).Create(&main).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ForOrg(branchOrg).Create(&branch).Error; err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Hour)
+	for _, key := range []string{userThrottleKey(main.Username), userThrottleKey(branch.Username), "ip:10.9.9.9"} {
+		database.DB.Create(&model.LoginThrottle{Key: key, LastFailureAt: time.Now(), LockedUntil: &until})
+	}
+	return main, branch
+}
+
+func clearLockout(role, key string) *http.Response {
+	w := callHandler(func(c *gin.Context) {
+		c.Request.URL.RawQuery = "key=" + url.QueryEscape(key)
+		ClearLoginLockout(c)
+	}, role, defaultOrg, ``)
+	return w.Result()
+}
+
+func lockoutKeys(t *testing.T, role string) map[string]bool {
+	t.Helper()
+	w := callHandler(GetLoginLockouts, role, defaultOrg, ``)
+	var resp struct {
+		Data []model.LoginThrottle `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	keys := map[string]bool{}
+	for _, th := range resp.Data {
+		keys[th.Key] = true
+	}
+	return keys
+}
+
+func TestLockoutsScopedToOrg(t *testing.T) {
+	main, branch := lockoutFixture(t)
+	mainKey, branchKey := userThrottleKey(main.Username), userThrottleKey(branch.Username)
+
+	keys := lockoutKeys(t, "org_admin")
+	if !keys[mainKey] || keys[branchKey] || keys["ip:10.9.9.9"] {
+		t.Errorf("org admin sees %v", keys)
+	}
+	if keys := lockoutKeys(t, authz.SuperRole); !keys["ip:10.9.9.9"] {
+		t.Errorf("global admin does not see ip lockouts: %v", keys)
+	}
+
+	// 其他机构的用户、IP、不存在的用户名：院区管理员都不能解除
+	for key, want := range map[string]int{
+		branchKey:        http.StatusNotFound,
+		"ip:10.9.9.9":    http.StatusForbidden,
+		"user:no-such-1": http.StatusNotFound,
+	} {
+		if resp := clearLockout("org_admin", key); resp.StatusCode != want {
+			t.Errorf("org admin clear %s = %d, want %d", key, resp.StatusCode, want)
+		}
+	}
+	var remaining int64
+	database.DB.Model(&model.LoginThrottle{}).Where("key IN ?", []string{branchKey, "ip:10.9.9.9"}).Count(&remaining)
+	if remaining != 2 {
+		t.Errorf("%d of 2 lockouts left after rejected clears", remaining)
+	}
+
+	// 本机构用户 (键里的用户名是小写)
+	if resp := clearLockout("org_admin", mainKey); resp.StatusCode != http.StatusOK {
+		t.Errorf("org admin clear own user = %d", resp.StatusCode)
+	}
+	if resp := clearLockout(authz.SuperRole, "ip:10.9.9.9"); resp.StatusCode != http.StatusOK {
+		t.Errorf("global admin clear ip = %d", resp.StatusCode)
+	}
+	database.DB.Model(&model.LoginThrottle{}).Where("key IN ?", []string{mainKey, "ip:10.9.9.9"}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d lockouts left after clearing", remaining)
+	}
+}
@@ -0,0 +1,466 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/token"
+	"hospital-system/internal/totp"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// --- 两步验证 (TOTP) ---
+// 密码正确后，已启用两步验证的用户只拿到一个 5 分钟的临时令牌 (mfa_token)，
+// 提交动态码或恢复码后才建立会话；config.yaml 中 mfa.required_roles 的角色未绑定时先完成绑定
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// 临时令牌用途
+const (
+	mfaPurposeVerify = "verify" // 已启用：校验动态码
+	mfaPurposeSetup  = "setup"  // 角色要求但未绑定：先绑定再登录
+)
+
+// mfaRequired 该角色是否必须启用两步验证
+func mfaRequired(role string) bool {
+	for _, r := range config.AppConfig.MFA.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func mfaIssuer() string {
+	if config.AppConfig.MFA.Issuer != "" {
+		return config.AppConfig.MFA.Issuer
+	}
+	return "hospital-system"
+}
+
+// mfaEnabled 用户是否已启用两步验证
+func mfaEnabled(userID uint) bool {
+	var count int64
+	database.DB.Model(&model.TOTPCredential{}).Where("user_id = ? AND enabled = ?", userID, true).Count(&count)
+	return count > 0
+}
+
+// mfaChallenge 密码校验通过后判断是否需要两步验证，需要时直接返回临时令牌
+func mfaChallenge(c *gin.Context, user model.User) bool {
+	purpose := ""
+	if mfaEnabled(user.ID) {
+		purpose = mfaPurposeVerify
+	} else if mfaRequired(user.Role) {
+		purpose = mfaPurposeSetup
+	}
+	if purpose == "" {
+		return false
+	}
+
+	// 临时令牌不带会话 (sid)，不能访问任何业务接口
+	mfaToken, err := token.Default.SignWithTTL(jwt.MapClaims{"user_id": user.ID, "mfa": purpose}, mfaTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return true
+	}
+	resp := gin.H{
+		"mfa_token":  mfaToken,
+		"expires_in": int(mfaTokenTTL.Seconds()),
+	}
+	if purpose == mfaPurposeVerify {
+		resp["mfa_required"] = true
+		resp["msg"] = "请输入验证器 App 中的动态码"
+	} else {
+		resp["mfa_setup_required"] = true
+		resp["msg"] = "该账号必须启用两步验证，请先绑定验证器 App"
+	}
+	c.JSON(http.StatusOK, resp)
+	return true
+}
+
+// parseMFAToken 校验临时令牌，返回对应用户和用途
+func parseMFAToken(raw string) (model.User, string, error) {
+	var user model.User
+	claims, err := token.Default.Parse(raw)
+	if err != nil {
+		return user, "", errors.New("临时令牌无效或已过期，请重新登录")
+	}
+	purpose, _ := claims["mfa"].(string)
+	uid, _ := claims["user_id"].(float64)
+	if purpose == "" || uid == 0 {
+		return user, "", errors.New("临时令牌无效或已过期，请重新登录")
+	}
+	if err := database.DB.First(&user, uint(uid)).Error; err != nil {
+		return user, "", errors.New("临时令牌无效或已过期，请重新登录")
+	}
+	return user, purpose, nil
+}
+
+// LoginMFASetup 登录时绑定验证器 (仅限角色要求两步验证但尚未绑定的用户)
+// POST /api/v1/login/mfa/setup
+func LoginMFASetup(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	user, purpose, err := parseMFAToken(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if purpose != mfaPurposeSetup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已绑定验证器，请直接输入动态码"})
+		return
+	}
+	respondEnrollment(c, user)
+}
+
+// LoginMFAVerify 登录第二步：提交动态码或恢复码，通过后建立会话
+// 绑定流程中提交的动态码用于确认绑定，同时返回恢复码
+// POST /api/v1/login/mfa
+func LoginMFAVerify(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请输入动态码"})
+		return
+	}
+	user, purpose, err := parseMFAToken(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 动态码只有 6 位，与密码共用失败计数和锁定
+	now := time.Now()
+	if wait := loginRetryAfter(user.Username, c.ClientIP(), now); wait > 0 {
+		logSecurityEvent(c, "login_blocked", user.Username, user.ID, fmt.Sprintf("两步验证，需等待 %d 秒", int(wait.Seconds())+1))
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	var recoveryCodes []string
+	detail := ""
+	switch purpose {
+	case mfaPurposeSetup:
+		recoveryCodes, err = confirmEnrollment(user.ID, req.Code, now)
+		if err != nil {
+			mfaFailed(c, user, err.Error(), now)
+			return
+		}
+		logSecurityEvent(c, "mfa_enabled", user.Username, user.ID, "登录时绑定")
+		detail = "两步验证: 绑定"
+	default:
+		method, ok := verifyMFACode(user.ID, req.Code, now)
+		if !ok {
+			mfaFailed(c, user, "动态码错误", now)
+			return
+		}
+		if method == "recovery_code" {
+			logSecurityEvent(c, "recovery_code_used", user.Username, user.ID, fmt.Sprintf("剩余 %d 个", recoveryCodesLeft(user.ID)))
+		}
+		detail = "两步验证: " + method
+	}
+
+	resp, ok := finishLogin(c, user, detail)
+	if !ok {
+		return
+	}
+	if recoveryCodes != nil {
+		resp["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// mfaFailed 动态码错误：与密码错误一样计入失败次数
+func mfaFailed(c *gin.Context, user model.User, reason string, now time.Time) {
+	logSecurityEvent(c, "mfa_failed", user.Username, user.ID, reason)
+	for _, t := range recordLoginFailure(user.Username, c.ClientIP(), now) {
+		logSecurityEvent(c, "account_locked", user.Username, user.ID,
+			fmt.Sprintf("%s 锁定至 %s", t.Key, t.LockedUntil.Format("2006-01-02 15:04:05")))
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "动态码错误"})
+}
+
+// respondEnrollment 生成新密钥 (未启用状态) 并返回绑定信息，前端据 otpauth_uri 生成二维码
+func respondEnrollment(c *gin.Context, user model.User) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+
+	var cred model.TOTPCredential
+	database.DB.Where("user_id = ?", user.ID).FirstOrInit(&cred, model.TOTPCredential{UserID: user.ID})
+	if cred.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已启用两步验证，如需更换请先关闭"})
+		return
+	}
+	cred.Secret = secret
+	cred.LastUsedStep = 0
+	if err := database.DB.Save(&cred).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存密钥失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": totp.ProvisioningURI(mfaIssuer(), user.Username, secret),
+		"msg":         "请用验证器 App 扫描二维码，然后输入显示的 6 位动态码完成绑定",
+	})
+}
+
+// confirmEnrollment 校验绑定后的第一个动态码，启用两步验证并生成恢复码
+func confirmEnrollment(userID uint, code string, now time.Time) ([]string, error) {
+	var cred model.TOTPCredential
+	if err := database.DB.Where("user_id = ?", userID).First(&cred).Error; err != nil || cred.Secret == "" {
+		return nil, errors.New("请先获取绑定二维码")
+	}
+	if cred.Enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+	step, ok := totp.Validate(cred.Secret, code, now)
+	if !ok {
+		return nil, errors.New("动态码错误")
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		cred.Enabled = true
+		cred.ConfirmedAt = &now
+		cred.LastUsedStep = step
+		if err := tx.Save(&cred).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = newRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// verifyMFACode 校验动态码或恢复码，返回使用的方式
+func verifyMFACode(userID uint, code string, now time.Time) (string, bool) {
+	var cred model.TOTPCredential
+	if err := database.DB.Where("user_id = ? AND enabled = ?", userID, true).First(&cred).Error; err != nil {
+		return "", false
+	}
+
+	if step, ok := totp.Validate(cred.Secret, code, now); ok {
+		// 同一时间步的动态码只能用一次 (条件更新防止并发重放)
+		result := database.DB.Model(&model.TOTPCredential{}).
+			Where("id = ? AND last_used_step < ?", cred.ID, step).
+			Update("last_used_step", step)
+		return "totp", result.Error == nil && result.RowsAffected == 1
+	}
+
+	result := database.DB.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", now)
+	return "recovery_code", result.Error == nil && result.RowsAffected == 1
+}
+
+// newRecoveryCodes 作废旧恢复码并生成新的一组，明文只在此时返回一次
+func newRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		buf := make([]byte, 10)
+		for i := range buf {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+			if err != nil {
+				return nil, err
+			}
+			buf[i] = charset[n.Int64()]
+		}
+		code := string(buf[:5]) + "-" + string(buf[5:])
+		if err := tx.Create(&model.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode 忽略大小写、空格和连字符
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func recoveryCodesLeft(userID uint) int64 {
+	var count int64
+	database.DB.Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// GetMFAStatus 本人的两步验证状态
+// GET /dashboard/mfa
+func GetMFAStatus(c *gin.Context) {
+	uid := c.GetUint("user_id")
+	var cred model.TOTPCredential
+	enabled := database.DB.Where("user_id = ? AND enabled = ?", uid, true).First(&cred).Error == nil
+
+	resp := gin.H{
+		"enabled":  enabled,
+		"required": mfaRequired(c.GetString("role")),
+	}
+	if enabled {
+		resp["confirmed_at"] = cred.ConfirmedAt
+		resp["recovery_codes_left"] = recoveryCodesLeft(uid)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// EnrollMFA 开启两步验证第一步：获取密钥和二维码地址
+// POST /dashboard/mfa/enroll
+func EnrollMFA(c *gin.Context) {
+	var user model.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无法获取用户信息"})
+		return
+	}
+	respondEnrollment(c, user)
+}
+
+// ConfirmMFA 开启两步验证第二步：输入动态码确认，返回恢复码
+// POST /dashboard/mfa/confirm
+func ConfirmMFA(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请输入动态码"})
+		return
+	}
+
+	uid := c.GetUint("user_id")
+	codes, err := confirmEnrollment(uid, req.Code, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logSecurityEvent(c, "mfa_enabled", currentUsername(c), uid, "")
+	c.JSON(http.StatusOK, gin.H{"msg": "两步验证已开启，请妥善保存恢复码", "recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码 (旧的全部作废)，需验证动态码
+// POST /dashboard/mfa/recovery_codes
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请输入动态码"})
+		return
+	}
+
+	uid := c.GetUint("user_id")
+	if method, ok := verifyMFACode(uid, req.Code, time.Now()); !ok || method != "totp" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "动态码错误"})
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = newRecoveryCodes(tx, uid)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	}
+	logSecurityEvent(c, "recovery_codes_regenerated", currentUsername(c), uid, "")
+	c.JSON(http.StatusOK, gin.H{"msg": "已生成新的恢复码，旧恢复码已作废", "recovery_codes": codes})
+}
+
+// DisableMFA 关闭两步验证，需验证动态码或恢复码；角色要求两步验证时不能关闭
+// DELETE /dashboard/mfa
+func DisableMFA(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请输入动态码"})
+		return
+	}
+	if mfaRequired(c.GetString("role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "当前角色必须启用两步验证，不能关闭"})
+		return
+	}
+
+	uid := c.GetUint("user_id")
+	if _, ok := verifyMFACode(uid, req.Code, time.Now()); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "动态码错误"})
+		return
+	}
+	if err := removeMFA(database.DB, uid); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	logSecurityEvent(c, "mfa_disabled", currentUsername(c), uid, "")
+	c.JSON(http.StatusOK, gin.H{"msg": "两步验证已关闭"})
+}
+
+// ResetUserMFA 管理员清除用户的两步验证 (手机和恢复码都丢失时)
+// 角色要求两步验证的用户下次登录需重新绑定
+// POST /dashboard/users/:id/reset_mfa
+func ResetUserMFA(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var user model.User
+	if err := database.Scoped(c).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := removeMFA(tx, user.ID); err != nil {
+			return err
+		}
+		return revokeSessions(tx, user.ID, "mfa_reset")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	logSecurityEvent(c, "mfa_reset", user.Username, user.ID, "管理员清除两步验证")
+	c.JSON(http.StatusOK, gin.H{"msg": "已清除该用户的两步验证"})
+}
+
+func removeMFA(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.TOTPCredential{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+}
@@ -1,19 +1,18 @@
 package middleware
 
 import (
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/token"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-var JwtKey []byte
-
-func InitAuth(secret string) {
-	JwtKey = []byte(secret)
-}
-
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -23,31 +22,110 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := authHeader[7:]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return JwtKey, nil
-		})
+		authenticate(c, authHeader[7:])
+	}
+}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// 1. 处理 user_id (从 float64 转为 uint)
-			if uid, ok := claims["user_id"].(float64); ok {
-				c.Set("user_id", uint(uid))
+// StreamAuthMiddleware 推送通道专用：浏览器的 EventSource / WebSocket 无法设置请求头，
+// 用 ?ticket= 传一次性票据 (POST /dashboard/events/ticket 换取，见 ticket.go)；能带请求头的客户端仍可用 Bearer
+func StreamAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := ""
+		if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			tokenString = authHeader[7:]
+		} else if ticket := c.Query("ticket"); ticket != "" {
+			accessToken, ok := redeemStreamTicket(ticket)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "票据无效或已过期"})
+				c.Abort()
+				return
 			}
+			tokenString = accessToken
+		}
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+			c.Abort()
+			return
+		}
 
-			// 2. 处理 role (必须转为 string，否则后续 string 比对会失败)
-			if role, ok := claims["role"].(string); ok {
-				c.Set("role", role)
-			}
+		authenticate(c, tokenString)
+	}
+}
 
-			// 3. 处理 org_id (从 float64 转为 uint)
-			if oid, ok := claims["org_id"].(float64); ok {
-				c.Set("org_id", uint(oid))
-			}
+// passwordChangePaths 必须先修改密码的用户仍可访问的接口
+var passwordChangePaths = map[string]bool{
+	"/api/v1/dashboard/password": true,
+	"/api/v1/dashboard/logout":   true,
+}
 
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的Token: " + err.Error()})
+// authenticate 校验 Token (签名算法、kid、有效期、签发方) 并把身份信息写入上下文
+func authenticate(c *gin.Context, tokenString string) {
+	claims, err := token.Default.Parse(tokenString)
+	if err == nil {
+		// 两步验证前的临时令牌只能用于 /login/mfa
+		if _, pending := claims["mfa"]; pending {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "请先完成两步验证"})
 			c.Abort()
+			return
 		}
+
+		// 0. 会话必须仍然有效 (未退出、未被强制下线)
+		uid, _ := claims["user_id"].(float64)
+		sid, _ := claims["sid"].(float64)
+		if !SessionActive(uint(sid), uint(uid)) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新登录"})
+			c.Abort()
+			return
+		}
+		c.Set("session_id", uint(sid))
+
+		// 管理员重置密码后，修改密码前只能访问少数接口
+		if mustChange, _ := claims["pwd_change"].(bool); mustChange && !passwordChangePaths[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "请先修改密码", "must_change_password": true})
+			c.Abort()
+			return
+		}
+
+		// 1. 处理 user_id (从 float64 转为 uint)
+		c.Set("user_id", uint(uid))
+
+		// 2. 处理 role (必须转为 string，否则后续 string 比对会失败)
+		if role, ok := claims["role"].(string); ok {
+			c.Set("role", role)
+		}
+
+		// 3. 处理 org_id (从 float64 转为 uint)
+		oid, _ := claims["org_id"].(float64)
+		c.Set("org_id", uint(oid))
+
+		// 4. 数据范围 (见 database.Tenant)：只能读写本机构的数据；
+		// 有 org.all 权限的默认跨机构查看，?org_id= 切换到指定机构
+		tenant := database.Tenant{OrgID: uint(oid)}
+		if authz.Has(c.GetString("role"), "org.all") {
+			if id, err := strconv.Atoi(c.Query("org_id")); err == nil && id > 0 {
+				tenant.OrgID = uint(id)
+			} else {
+				tenant.AllOrgs = true
+			}
+		}
+		c.Set(database.TenantKey, tenant)
+
+		c.Next()
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的Token: " + err.Error()})
+		c.Abort()
+	}
+}
+
+// SessionActive 访问令牌所属会话是否有效 (旧版不带 sid 的 Token 一律视为失效)
+// 推送通道是长连接，心跳时也要重新检查，会话被注销或强制下线后断开
+func SessionActive(sessionID, userID uint) bool {
+	if sessionID == 0 {
+		return false
+	}
+	var session model.Session
+	if err := database.DB.Select("id", "user_id", "expires_at", "revoked_at").First(&session, sessionID).Error; err != nil {
+		return false
 	}
+	return session.UserID == userID && session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
 }
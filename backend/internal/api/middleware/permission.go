@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"hospital-system/internal/authz"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission 当前角色拥有其中任一权限点才放行 (权限点见 internal/authz)
+// 带数据范围的接口 (例如 record.read.own / record.read.all) 把各个范围都列上，具体过滤在处理函数中完成
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authz.HasAny(c.GetString("role"), perms...) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// --- 推送通道票据 ---
+// EventSource / WebSocket 无法设置请求头，只能把凭证放在 URL 里，而 URL 会写进访问日志和代理日志。
+// 因此不在 URL 中传 JWT，而是先用请求头换一张票据：30 秒内有效、只能使用一次，日志里留下的票据已经作废
+
+const StreamTicketTTL = 30 * time.Second
+
+type streamTicket struct {
+	accessToken string
+	expiresAt   time.Time
+}
+
+var (
+	ticketMu sync.Mutex
+	tickets  = map[string]streamTicket{}
+)
+
+// IssueStreamTicket 为已登录请求的访问令牌签发一次性票据
+func IssueStreamTicket(accessToken string) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(buf)
+
+	now := time.Now()
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+	for k, t := range tickets {
+		if now.After(t.expiresAt) {
+			delete(tickets, k)
+		}
+	}
+	tickets[ticket] = streamTicket{accessToken: accessToken, expiresAt: now.Add(StreamTicketTTL)}
+	return ticket, nil
+}
+
+// redeemStreamTicket 兑换票据 (无论成功与否都作废)
+func redeemStreamTicket(ticket string) (string, bool) {
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+	t, ok := tickets[ticket]
+	delete(tickets, ticket)
+	if !ok || time.Now().After(t.expiresAt) {
+		return "", false
+	}
+	return t.accessToken, true
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 全局管理员在跨机构视图下替其他机构办理业务，新数据归属患者 / 挂号单所在的机构
+
+const branchOrg = 2
+
+// branchFixture 分院的一位患者和一张挂号单
+func branchFixture(t *testing.T) (model.Patient, model.Booking) {
+	t.Helper()
+	database.DB.Where(model.Organization{ID: branchOrg}).Attrs(model.Organization{Name: "分院"}).FirstOrCreate(&model.Organization{})
+	db := database.ForOrg(branchOrg)
+	patient := model.Patient{Name: "分院患者", Phone: "13700000000"}
+	if err := db.Create(&patient).Error; err != nil {
+		t.Fatal(err)
+	}
+	booking := model.Booking{PatientID: patient.ID, PatientName: patient.Name, Department: "内科", DoctorID: 1, Status: "Pending", QueueState: "Waiting"}
+	if err := db.Create(&booking).Error; err != nil {
+		t.Fatal(err)
+	}
+	return patient, booking
+}
+
+// callHandler 以指定角色和数据范围调用处理函数 (模拟 middleware.authenticate 写入的上下文)
+func callHandler(h gin.HandlerFunc, role string, tenant database.Tenant, body string, params ...gin.Param) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set("user_id", uint(1))
+	c.Set("role", role)
+	c.Set("org_id", tenant.OrgID)
+	c.Set(database.TenantKey, tenant)
+	h(c)
+	return w
+}
+
+var allOrgs = database.Tenant{OrgID: model.DefaultOrgID, AllOrgs: true}
+
+func TestAllOrgsDepositUsesPatientOrg(t *testing.T) {
+	patient, _ := branchFixture(t)
+	param := gin.Param{Key: "patient_id", Value: strconv.Itoa(int(patient.ID))}
+
+	if w := callHandler(TakeDeposit, authz.SuperRole, allOrgs, `{"amount": 100}`, param); w.Code != http.StatusOK {
+		t.Fatalf("admin deposit: %d %s", w.Code, w.Body)
+	}
+	var account model.DepositAccount
+	database.DB.Where("patient_id = ?", patient.ID).First(&account)
+	var entries []model.DepositEntry
+	database.DB.Where("patient_id = ?", patient.ID).Find(&entries)
+	if account.OrgID != branchOrg || len(entries) != 1 || entries[0].OrgID != branchOrg {
+		t.Fatalf("account org=%d entries=%+v, want org %d", account.OrgID, entries, branchOrg)
+	}
+
+	// 分院收费员能看到并继续缴存到同一个账户
+	branch := database.Tenant{OrgID: branchOrg}
+	if w := callHandler(TakeDeposit, authz.SuperRole, branch, `{"amount": 50}`, param); w.Code != http.StatusOK {
+		t.Fatalf("branch deposit: %d %s", w.Code, w.Body)
+	}
+	database.DB.First(&account, account.ID)
+	if account.Balance != 150 {
+		t.Errorf("balance = %v, want 150", account.Balance)
+	}
+}
+
+func TestAllOrgsReferralUsesBookingOrg(t *testing.T) {
+	_, from := branchFixture(t)
+	body := `{"booking_id": ` + strconv.Itoa(int(from.ID)) + `, "to_department": "外科", "reason": "会诊"}`
+
+	w := callHandler(CreateReferral, authz.SuperRole, allOrgs, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("referral: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data    model.Referral `json:"data"`
+		Booking model.Booking  `json:"booking"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	var referral model.Referral
+	database.DB.First(&referral, resp.Data.ID)
+	var to model.Booking
+	database.DB.First(&to, resp.Booking.ID)
+	if referral.OrgID != branchOrg || to.OrgID != branchOrg {
+		t.Errorf("referral org=%d new booking org=%d, want %d", referral.OrgID, to.OrgID, branchOrg)
+	}
+
+	// 新挂号单进入分院的队列
+	var queued int64
+	database.ForOrg(branchOrg).Model(&model.Booking{}).Where("id = ? AND status = ?", to.ID, "Pending").Count(&queued)
+	if queued != 1 {
+		t.Error("referred booking is not in the branch queue")
+	}
+}
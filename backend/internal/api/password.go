@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 密码策略与修改 / 重置密码 ---
+
+// maxPasswordBytes bcrypt 只使用前 72 字节，更长的部分会被忽略
+const maxPasswordBytes = 72
+
+// commonPasswords 常见 / 已泄露密码 (小写)
+var commonPasswords = map[string]bool{}
+
+// LoadCommonPasswords 读取常见密码列表，每行一个，# 开头为注释
+func LoadCommonPasswords(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commonPasswords[strings.ToLower(line)] = true
+	}
+	return scanner.Err()
+}
+
+// checkPassword 按 config.yaml 的密码策略校验新密码
+func checkPassword(password, username string) error {
+	policy := config.AppConfig.Password
+	minLength := policy.MinLength
+	if minLength <= 0 {
+		minLength = 8
+	}
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("密码长度至少 %d 位", minLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("密码不能超过 %d 个字节", maxPasswordBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, ok := range []bool{upper, lower, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+	if classes < policy.MinClasses {
+		return fmt.Errorf("密码需包含大写字母、小写字母、数字、符号中的至少 %d 类", policy.MinClasses)
+	}
+
+	lowered := strings.ToLower(password)
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		return errors.New("密码不能包含用户名")
+	}
+	if commonPasswords[lowered] {
+		return errors.New("该密码过于常见或已出现在泄露密码库中，请更换")
+	}
+	return nil
+}
+
+// generatePassword 生成满足密码策略的临时密码
+func generatePassword(username string) (string, error) {
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789!@#$%&*"
+	for {
+		buf := make([]byte, 12)
+		for i := range buf {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+			if err != nil {
+				return "", err
+			}
+			buf[i] = charset[n.Int64()]
+		}
+		if password := string(buf); checkPassword(password, username) == nil {
+			return password, nil
+		}
+	}
+}
+
+// ChangePassword 修改本人密码 (需验证旧密码)
+// 修改后所有已登录设备下线，当前设备换发新的会话
+// POST /dashboard/password
+func ChangePassword(c *gin.Context) {
+	var req struct {
+		OldPassword string `json:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：请填写旧密码和新密码"})
+		return
+	}
+
+	var user model.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无法获取用户信息"})
+		return
+	}
+	if user.IsExternal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "统一身份认证账号请在集团目录中修改密码"})
+		return
+	}
+	if !user.CheckPassword(req.OldPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "旧密码不正确"})
+		return
+	}
+	if req.NewPassword == req.OldPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新密码不能与旧密码相同"})
+		return
+	}
+	if err := checkPassword(req.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+		return
+	}
+	user.MustChangePassword = false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, user.ID, "password_changed")
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+
+	resp, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return
+	}
+	logSecurityEvent(c, "password_changed", user.Username, user.ID, "")
+	resp["msg"] = "密码已修改，其他设备需重新登录"
+	c.JSON(http.StatusOK, resp)
+}
+
+// ResetUserPassword 管理员重置密码：不指定新密码时生成临时密码，用户下次登录必须先修改
+// POST /dashboard/users/:id/reset_password
+func ResetUserPassword(c *gin.Context) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	c.ShouldBindJSON(&req)
+
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var user model.User
+	if err := database.Scoped(c).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+
+	if user.IsExternal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "统一身份认证账号的密码由目录管理，不能在本系统重置"})
+		return
+	}
+
+	password := req.Password
+	if password == "" {
+		generated, err := generatePassword(user.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成临时密码失败"})
+			return
+		}
+		password = generated
+	} else if err := checkPassword(password, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := resetPassword(database.DB, &user, password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+
+	logSecurityEvent(c, "password_reset", user.Username, user.ID, "")
+	resp := gin.H{"msg": "密码已重置，用户下次登录需修改密码"}
+	if req.Password == "" {
+		resp["temporary_password"] = password
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// resetPassword 管理员设置的密码：强制下次登录修改，并让该用户所有会话下线
+func resetPassword(db *gorm.DB, user *model.User, password string) error {
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	user.MustChangePassword = true
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, user.ID, "password_reset")
+	})
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"testing"
+)
+
+// 同名患者只有第二项身份信息一致时才归并到同一份档案
+
+func TestFindOrCreatePatientMatching(t *testing.T) {
+	db := database.ForOrg(model.DefaultOrgID)
+	find := func(info model.PatientInfo) model.Patient {
+		t.Helper()
+		p, err := model.FindOrCreatePatient(db, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	first := find(model.PatientInfo{Name: "王芳", Phone: "13511111111", Gender: "女", BirthYear: 1980})
+	if first.NeedsReview {
+		t.Error("first patient with a new name flagged for review")
+	}
+
+	// 电话一致 -> 同一人
+	if p := find(model.PatientInfo{Name: "王芳", Phone: "13511111111"}); p.ID != first.ID {
+		t.Errorf("same name and phone created patient %d, want %d", p.ID, first.ID)
+	}
+	// 性别 + 年龄一致 (出生年份相差一年内) -> 同一人
+	if p := find(model.PatientInfo{Name: "王芳", Gender: "女", BirthYear: 1981}); p.ID != first.ID {
+		t.Errorf("same name, gender and age created patient %d, want %d", p.ID, first.ID)
+	}
+
+	// 只有姓名、电话不同、性别不同 -> 新档案并标记待核对
+	for _, info := range []model.PatientInfo{
+		{Name: "王芳"},
+		{Name: "王芳", Phone: "13622222222", Gender: "女", BirthYear: 1980},
+		{Name: "王芳", Gender: "男", BirthYear: 1980},
+	} {
+		p := find(info)
+		if p.ID == first.ID {
+			t.Errorf("%+v merged into patient %d", info, first.ID)
+		}
+		if !p.NeedsReview {
+			t.Errorf("%+v not flagged for review", info)
+		}
+	}
+}
+
+func TestFindOrCreatePatientIDCard(t *testing.T) {
+	db := database.ForOrg(model.DefaultOrgID)
+	withCard, err := model.FindOrCreatePatient(db, model.PatientInfo{Name: "赵强", IDCard: "110101198001010011", Phone: "13833333333"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 身份证号不同，即使电话相同也不归并
+	other, err := model.FindOrCreatePatient(db, model.PatientInfo{Name: "赵强", IDCard: "110101199502020022", Phone: "13833333333"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == withCard.ID {
+		t.Fatal("patients with different id cards merged")
+	}
+
+	// 没有身份证号的旧档案，电话一致时归并并补全身份证号
+	legacy, _ := model.FindOrCreatePatient(db, model.PatientInfo{Name: "孙丽", Phone: "13944444444"})
+	p, err := model.FindOrCreatePatient(db, model.PatientInfo{Name: "孙丽", IDCard: "110101197003030033", Phone: "13944444444"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != legacy.ID {
+		t.Fatalf("legacy patient not linked: got %d, want %d", p.ID, legacy.ID)
+	}
+	var stored model.Patient
+	database.DB.First(&stored, legacy.ID)
+	if stored.IDCard != "110101197003030033" {
+		t.Errorf("id card not filled in: %q", stored.IDCard)
+	}
+}
+
+func TestFindOrCreatePatientByAccount(t *testing.T) {
+	db := database.ForOrg(model.DefaultOrgID)
+	// 挂号员登记的同名患者
+	staff, _ := model.FindOrCreatePatient(db, model.PatientInfo{Name: "user_lee", Phone: "13755555555"})
+
+	// 患者本人自助挂号 (姓名即用户名)：不归并到无法确认的同名档案，之后按账号关联
+	own, err := model.FindOrCreatePatient(db, model.PatientInfo{Name: "user_lee", UserID: 9001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if own.ID == staff.ID {
+		t.Fatal("self booking merged into a same-name patient")
+	}
+	again, _ := model.FindOrCreatePatient(db, model.PatientInfo{Name: "user_lee", UserID: 9001})
+	if again.ID != own.ID {
+		t.Errorf("second self booking created patient %d, want %d", again.ID, own.ID)
+	}
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 排队叫号 (Queue) ---
+// 挂号时按 科室 + 日期 分配排队号；医生叫号/重呼/过号；挂号台看到同一份队列
+// 队列变化通过事件总线推送到医生工作台和挂号台 (SSE)
+
+const elderlyAge = 65 // 达到该年龄自动标记为老年优先
+
+// 排序：已分诊的按分级在前 (1 级最先)，其余按 急诊 > 老年 > 复诊 > 普通，同级按号码 (即到达顺序)
+const queueOrder = "CASE WHEN bookings.acuity > 0 THEN bookings.acuity ELSE 9 END, CASE bookings.priority WHEN 'emergency' THEN 0 WHEN 'elderly' THEN 1 WHEN 'revisit' THEN 2 ELSE 3 END, bookings.queue_date asc, bookings.ticket_no asc, bookings.created_at asc"
+
+// errNoCapacity 医生当日号源已满
+var errNoCapacity = errors.New("该医生今日号源已满")
+
+var validPriorities = map[string]bool{"": true, "emergency": true, "elderly": true, "revisit": true}
+
+// ticketMu 串行化取号，避免并发挂号拿到同一个号码
+var ticketMu sync.Mutex
+
+// createQueuedBooking 分配排队号并保存挂号单
+// db 决定挂号单所属机构 (见 database.Scoped)；checkCapacity 为 false 时不受号源限制 (急诊分诊)；then 在同一事务中保存关联数据
+func createQueuedBooking(db *gorm.DB, booking *model.Booking, checkCapacity bool, then func(tx *gorm.DB) error) error {
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if checkCapacity && doctorFull(tx, booking.DoctorID, time.Now().Format("2006-01-02")) {
+			return errNoCapacity
+		}
+
+		if err := assignTicket(tx, booking); err != nil {
+			return err
+		}
+		if err := tx.Create(booking).Error; err != nil {
+			return err
+		}
+		if then != nil {
+			return then(tx)
+		}
+		return nil
+	})
+}
+
+// doctorFull 医生某日号源是否已满 (含尚未签到的复诊预约)，未配置上限时永远不满
+func doctorFull(tx *gorm.DB, doctorID uint, date string) bool {
+	limit := config.AppConfig.Booking.DoctorDailyLimit
+	if limit <= 0 {
+		return false
+	}
+	var count int64
+	tx.Model(&model.Booking{}).
+		Where("doctor_id = ? AND queue_date = ? AND status NOT IN ?", doctorID, date, []string{"Cancelled", "Missed"}).
+		Count(&count)
+	return count >= int64(limit)
+}
+
+// assignTicket 分配当日科室排队号，并按年龄/就诊史推断优先标志
+func assignTicket(tx *gorm.DB, booking *model.Booking) error {
+	booking.QueueDate = time.Now().Format("2006-01-02")
+	booking.QueueState = "Waiting"
+
+	var maxNo int
+	if err := tx.Model(&model.Booking{}).
+		Where("department = ? AND queue_date = ?", booking.Department, booking.QueueDate).
+		Select("COALESCE(MAX(ticket_no), 0)").Scan(&maxNo).Error; err != nil {
+		return err
+	}
+	booking.TicketNo = maxNo + 1
+
+	if booking.Priority == "" {
+		if booking.Age >= elderlyAge {
+			booking.Priority = "elderly"
+		} else if booking.PatientID != 0 {
+			// 同科室看过的患者算复诊
+			var visits int64
+			tx.Model(&model.Booking{}).
+				Where("patient_id = ? AND department = ? AND status = ?", booking.PatientID, booking.Department, "Completed").
+				Count(&visits)
+			if visits > 0 {
+				booking.Priority = "revisit"
+			}
+		}
+	}
+	return nil
+}
+
+// queueEventTypes 会改变候诊队列的事件
+var queueEventTypes = map[string]bool{
+	"booking.created":   true,
+	"booking.cancelled": true,
+	"booking.completed": true,
+	"patient.called":    true,
+	"queue.skipped":     true,
+	"queue.updated":     true,
+}
+
+// publishQueue 推送队列变化 (挂号台、医生、管理员可见)
+func publishQueue(typ string, booking model.Booking) {
+	events.Publish(events.Event{
+		Type:        typ,
+		OrgID:       booking.OrgID,
+		Permissions: []string{"queue.manage", "consult.queue"},
+		Department:  booking.Department,
+		DoctorID:    booking.DoctorID,
+		Data:        booking,
+	})
+}
+
+// queueSnapshot 按叫号状态分组返回候诊队列
+func queueSnapshot(tx *gorm.DB) (gin.H, error) {
+	var bookings []model.Booking
+	if err := tx.Where("bookings.status = ?", "Pending").Order(queueOrder).Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	calling, waiting, skipped := []model.Booking{}, []model.Booking{}, []model.Booking{}
+	for _, b := range bookings {
+		switch b.QueueState {
+		case "Called":
+			calling = append(calling, b)
+		case "Skipped":
+			skipped = append(skipped, b)
+		default:
+			waiting = append(waiting, b)
+		}
+	}
+	return gin.H{"calling": calling, "data": waiting, "skipped": skipped}, nil
+}
+
+// GetDoctorQueue 医生的候诊队列
+// GET /doctor/queue (管理员可用 ?doctor_id= 查看指定医生)
+func GetDoctorQueue(c *gin.Context) {
+	tx := database.Scoped(c).Model(&model.Booking{})
+	if !can(c, "patient.all") {
+		tx = doctorQueueScope(tx, c.GetUint("user_id"))
+	} else if doctorID := c.Query("doctor_id"); doctorID != "" {
+		tx = tx.Where("doctor_id = ?", doctorID)
+	}
+
+	snapshot, err := queueSnapshot(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取候诊队列失败"})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// CallNextPatient 叫下一位：按优先级取第一个候诊患者
+// POST /doctor/queue/next  {"room": "3诊室"}
+func CallNextPatient(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var booking model.Booking
+	err := doctorQueueScope(database.Scoped(c), userID).
+		Where("status = ? AND queue_state = ?", "Pending", "Waiting").
+		Order(queueOrder).First(&booking).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "当前没有候诊患者"})
+		return
+	}
+
+	// 科室候诊池中的患者 (未指定医生的转诊)：叫号即认领
+	if booking.DoctorID == 0 {
+		res := database.Scoped(c).Model(&booking).Where("doctor_id = 0").Update("doctor_id", userID)
+		if res.Error != nil || res.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "该患者已被其他医生接诊，请重试"})
+			return
+		}
+		booking.DoctorID = userID
+	}
+
+	callPatient(c, booking)
+}
+
+// doctorQueueScope 医生的队列：分配给自己的患者 + 本科室未指定医生的患者
+func doctorQueueScope(tx *gorm.DB, doctorID uint) *gorm.DB {
+	var doctor model.User
+	database.DB.First(&doctor, doctorID)
+	if doctor.Department == "" {
+		return tx.Where("bookings.doctor_id = ?", doctorID)
+	}
+	return tx.Where("bookings.doctor_id = ? OR (bookings.doctor_id = 0 AND bookings.department = ?)", doctorID, doctor.Department)
+}
+
+// RecallPatient 重呼 (也用于过号患者回来后重新叫号)
+// POST /doctor/queue/:id/recall
+func RecallPatient(c *gin.Context) {
+	booking, ok := findQueueBooking(c)
+	if !ok {
+		return
+	}
+	if booking.QueueState == "Waiting" {
+		c.JSON(http.StatusConflict, gin.H{"error": "该患者尚未叫号"})
+		return
+	}
+
+	callPatient(c, booking)
+}
+
+// callPatient 叫号，诊室显示在候诊区大屏上
+// 请求体可带 {"room": "3诊室"}，不带则沿用该医生上一次叫号的诊室
+func callPatient(c *gin.Context, booking model.Booking) {
+	var req struct {
+		Room string `json:"room"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.Room == "" {
+		var last model.Booking
+		if database.Scoped(c).Where("doctor_id = ? AND room <> ''", booking.DoctorID).Order("called_at desc").First(&last).Error == nil {
+			req.Room = last.Room
+		}
+	}
+
+	now := time.Now()
+	booking.QueueState = "Called"
+	booking.CalledAt = &now
+	booking.CallCount++
+	booking.Room = req.Room
+	if err := database.Scoped(c).Model(&booking).Updates(map[string]interface{}{
+		"queue_state": booking.QueueState,
+		"called_at":   now,
+		"call_count":  booking.CallCount,
+		"room":        booking.Room,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "叫号失败"})
+		return
+	}
+
+	publishQueue("patient.called", booking)
+	c.JSON(http.StatusOK, gin.H{"msg": "已叫号", "data": booking})
+}
+
+// SkipPatient 过号：叫号未到的患者移出队列，等挂号台重新排队
+// POST /doctor/queue/:id/skip
+func SkipPatient(c *gin.Context) {
+	booking, ok := findQueueBooking(c)
+	if !ok {
+		return
+	}
+	if booking.QueueState != "Called" {
+		c.JSON(http.StatusConflict, gin.H{"error": "只能对已叫号的患者过号"})
+		return
+	}
+
+	booking.QueueState = "Skipped"
+	database.Scoped(c).Model(&booking).Update("queue_state", booking.QueueState)
+
+	publishQueue("queue.skipped", booking)
+	c.JSON(http.StatusOK, gin.H{"msg": "已过号", "data": booking})
+}
+
+// findQueueBooking 取候诊中的挂号单，医生只能操作自己的患者
+func findQueueBooking(c *gin.Context) (model.Booking, bool) {
+	var booking model.Booking
+	if err := database.Scoped(c).Where("id = ? AND status = ?", c.Param("id"), "Pending").First(&booking).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "候诊记录不存在"})
+		return booking, false
+	}
+	if !can(c, "patient.all") && booking.DoctorID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能操作本人的候诊患者"})
+		return booking, false
+	}
+	return booking, true
+}
+
+// GetQueue 挂号台查看候诊队列
+// GET /queue?department=内科&doctor_id=2
+func GetQueue(c *gin.Context) {
+	tx := database.Scoped(c).Model(&model.Booking{})
+	if department := c.Query("department"); department != "" {
+		tx = tx.Where("department = ?", department)
+	}
+	if doctorID := c.Query("doctor_id"); doctorID != "" {
+		tx = tx.Where("doctor_id = ?", doctorID)
+	}
+
+	snapshot, err := queueSnapshot(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取候诊队列失败"})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// RequeuePatient 过号患者回到队列 (保留原号码)
+// POST /queue/:id/requeue
+func RequeuePatient(c *gin.Context) {
+	booking, ok := findQueueBooking(c)
+	if !ok {
+		return
+	}
+	if booking.QueueState != "Skipped" {
+		c.JSON(http.StatusConflict, gin.H{"error": "只有过号患者需要重新排队"})
+		return
+	}
+
+	booking.QueueState = "Waiting"
+	database.Scoped(c).Model(&booking).Update("queue_state", booking.QueueState)
+
+	publishQueue("queue.updated", booking)
+	c.JSON(http.StatusOK, gin.H{"msg": "已重新排队", "data": booking})
+}
+
+// SetQueuePriority 挂号台调整优先标志
+// PUT /queue/:id/priority  {"priority": "elderly"}
+func SetQueuePriority(c *gin.Context) {
+	var req struct {
+		Priority string `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validPriorities[req.Priority] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "优先标志只能是 emergency、elderly、revisit 或空"})
+		return
+	}
+
+	booking, ok := findQueueBooking(c)
+	if !ok {
+		return
+	}
+	booking.Priority = req.Priority
+	database.Scoped(c).Model(&booking).Update("priority", booking.Priority)
+
+	publishQueue("queue.updated", booking)
+	c.JSON(http.StatusOK, gin.H{"msg": "已更新", "data": booking})
+}
+
+// StreamDoctorQueue 医生工作台的队列推送 (SSE)
+// GET /doctor/queue/stream
+func StreamDoctorQueue(c *gin.Context) {
+	doctorID := c.GetUint("user_id")
+	if can(c, "patient.all") {
+		id, _ := strconv.Atoi(c.Query("doctor_id"))
+		doctorID = uint(id)
+	}
+
+	sub := events.Subscribe(func(e events.Event) bool {
+		return isQueueEvent(e) && inTenant(c, e) && (doctorID == 0 || e.DoctorID == doctorID)
+	})
+	streamEvents(c, sub)
+}
+
+// StreamQueue 挂号台的队列推送 (SSE)
+// GET /queue/stream?department=内科
+func StreamQueue(c *gin.Context) {
+	department := c.Query("department")
+	sub := events.Subscribe(func(e events.Event) bool {
+		return isQueueEvent(e) && inTenant(c, e) && (department == "" || e.Department == department)
+	})
+	streamEvents(c, sub)
+}
+
+func isQueueEvent(e events.Event) bool {
+	return queueEventTypes[e.Type]
+}
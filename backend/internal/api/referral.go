@@ -0,0 +1,241 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hospital-system/internal/database"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 转诊 (Referral) ---
+// 医生把患者转到其他科室/医生：生成新的挂号单进入对方队列，随附本次就诊信息，两次就诊互相关联
+
+type ReferralRequest struct {
+	BookingID    uint   `json:"booking_id" binding:"required"`
+	ToDepartment string `json:"to_department" binding:"required"`
+	ToDoctorID   uint   `json:"to_doctor_id"` // 不指定则进入该科室候诊池
+	Reason       string `json:"reason" binding:"required"`
+	Notes        string `json:"notes"`
+}
+
+// ReferralDetail 转诊单 + 随附就诊信息
+type ReferralDetail struct {
+	model.Referral
+	PatientName string                 `json:"patient_name"`
+	Context     *model.ReferralContext `json:"context,omitempty"`
+}
+
+// CreateReferral 发起转诊
+// POST /doctor/referrals
+func CreateReferral(c *gin.Context) {
+	var req ReferralRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：挂号单、转入科室和转诊原因必填"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	var from model.Booking
+	if err := database.Scoped(c).First(&from, req.BookingID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "挂号单不存在"})
+		return
+	}
+	if !can(c, "patient.all") && from.DoctorID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能转诊本人接诊的患者"})
+		return
+	}
+	if from.Status != "Pending" && from.Status != "Completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "该挂号单已取消或已转诊"})
+		return
+	}
+
+	// 新挂号单和转诊单归属原挂号单的机构，转入医生也必须是该机构的
+	orgDB := database.ForOrg(from.OrgID)
+
+	if req.ToDoctorID != 0 {
+		var doctor model.User
+		if err := orgDB.Where("id = ? AND role = ?", req.ToDoctorID, "doctor").First(&doctor).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "转入医生不存在"})
+			return
+		}
+	}
+
+	contextJSON, _ := json.Marshal(referralContext(from))
+
+	// 新挂号单：沿用患者信息和优先标志，转给指定医生或科室候诊池
+	to := model.Booking{
+		OrgID:          from.OrgID,
+		PatientID:      from.PatientID,
+		PatientName:    from.PatientName,
+		Age:            from.Age,
+		Gender:         from.Gender,
+		Department:     req.ToDepartment,
+		DoctorID:       req.ToDoctorID,
+		Status:         "Pending",
+		Priority:       from.Priority,
+		ReferredFromID: from.ID,
+		CreatedAt:      time.Now(),
+	}
+	referral := model.Referral{
+		OrgID:          from.OrgID,
+		FromBookingID:  from.ID,
+		PatientID:      from.PatientID,
+		FromDoctorID:   from.DoctorID,
+		FromDepartment: from.Department,
+		ToDoctorID:     req.ToDoctorID,
+		ToDepartment:   req.ToDepartment,
+		Reason:         req.Reason,
+		Notes:          req.Notes,
+		Context:        string(contextJSON),
+		CreatedAt:      time.Now(),
+	}
+
+	// 转给指定医生占用其号源；进入科室候诊池不占号源
+	err := createQueuedBooking(orgDB, &to, to.DoctorID != 0, func(tx *gorm.DB) error {
+		referral.ToBookingID = to.ID
+		if err := tx.Create(&referral).Error; err != nil {
+			return err
+		}
+		// 尚未接诊完成的原挂号单标记为已转诊，离开当前医生的队列
+		if from.Status == "Pending" {
+			return tx.Model(&from).Update("status", "Referred").Error
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errNoCapacity) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转诊失败"})
+		return
+	}
+
+	if from.Status == "Pending" {
+		from.Status = "Referred"
+		publishQueue("booking.cancelled", from)
+	}
+	publishQueue("booking.created", to)
+	events.Publish(events.Event{
+		Type:        "referral.created",
+		OrgID:       referral.OrgID,
+		Permissions: []string{"referral.manage", "booking.manage"},
+		Department:  referral.ToDepartment,
+		DoctorID:    referral.ToDoctorID,
+		Data:        referral,
+	})
+	c.JSON(http.StatusOK, gin.H{"msg": "转诊成功", "data": referral, "booking": to})
+}
+
+// GetReferrals 医生的转诊单
+// GET /doctor/referrals?direction=in (转入，默认) | out (转出)
+func GetReferrals(c *gin.Context) {
+	tx := database.Scoped(c).Table("referrals").
+		Select("referrals.*, patients.name as patient_name").
+		Joins("LEFT JOIN patients ON patients.id = referrals.patient_id").
+		Order("referrals.created_at desc")
+
+	if !can(c, "patient.all") {
+		userID := c.GetUint("user_id")
+		if c.Query("direction") == "out" {
+			tx = tx.Where("referrals.from_doctor_id = ?", userID)
+		} else {
+			var doctor model.User
+			database.Scoped(c).First(&doctor, userID)
+			tx = tx.Where("referrals.to_doctor_id = ? OR (referrals.to_doctor_id = 0 AND referrals.to_department = ?)", userID, doctor.Department)
+		}
+	}
+
+	var referrals []ReferralDetail
+	tx.Scan(&referrals)
+	c.JSON(http.StatusOK, gin.H{"data": referrals})
+}
+
+// GetReferral 转诊详情 (含随附的就诊信息)
+// GET /doctor/referrals/:id
+func GetReferral(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var referral model.Referral
+	if err := database.Scoped(c).First(&referral, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "转诊单不存在"})
+		return
+	}
+
+	// 医生只能看自己转出或转给自己 (含本科室候诊池) 的转诊
+	if !can(c, "patient.all") {
+		userID := c.GetUint("user_id")
+		var to model.Booking
+		database.Scoped(c).First(&to, referral.ToBookingID)
+		if referral.FromDoctorID != userID && referral.ToDoctorID != userID && to.DoctorID != userID {
+			var doctor model.User
+			database.Scoped(c).First(&doctor, userID)
+			if referral.ToDoctorID != 0 || referral.ToDepartment != doctor.Department {
+				c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该转诊单"})
+				return
+			}
+		}
+	}
+
+	detail := ReferralDetail{Referral: referral, Context: &model.ReferralContext{}}
+	var patient model.Patient
+	database.Scoped(c).First(&patient, referral.PatientID)
+	detail.PatientName = patient.Name
+	json.Unmarshal([]byte(referral.Context), detail.Context)
+
+	c.JSON(http.StatusOK, gin.H{"data": detail})
+}
+
+// ReferralStat 转诊流向统计
+type ReferralStat struct {
+	FromDepartment string `json:"from_department"`
+	ToDepartment   string `json:"to_department"`
+	Count          int64  `json:"count"`
+}
+
+// GetReferralStats 科室间转诊流向
+// GET /finance/referral_stats?from=2026-01-01&to=2026-01-31
+func GetReferralStats(c *gin.Context) {
+	tx := database.Scoped(c).Model(&model.Referral{}).
+		Select("from_department, to_department, COUNT(*) as count").
+		Group("from_department, to_department").
+		Order("count desc")
+	if from := c.Query("from"); from != "" {
+		tx = tx.Where("date(created_at) >= ?", from)
+	}
+	if to := c.Query("to"); to != "" {
+		tx = tx.Where("date(created_at) <= ?", to)
+	}
+
+	var stats []ReferralStat
+	tx.Scan(&stats)
+	c.JSON(http.StatusOK, gin.H{"data": stats})
+}
+
+// referralContext 收集原就诊的病历、分诊和检验结果
+func referralContext(booking model.Booking) model.ReferralContext {
+	ctx := model.ReferralContext{LabResults: []model.LabOrder{}}
+
+	var record model.MedicalRecord
+	if database.DB.Where("booking_id = ?", booking.ID).Order("id desc").First(&record).Error == nil {
+		content := recordContent(record, currentDiagnoses(database.DB, record))
+		ctx.RecordID = record.ID
+		ctx.Record = &content
+	}
+
+	var triage model.TriageRecord
+	if database.DB.Where("booking_id = ?", booking.ID).Order("id desc").First(&triage).Error == nil {
+		ctx.Triage = &triage
+	}
+
+	database.DB.Where("booking_id = ? AND status = ?", booking.ID, "Resulted").Order("id asc").Find(&ctx.LabResults)
+	return ctx
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"fmt"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 角色与权限 ---
+// 路由用 middleware.RequirePermission 拦截，处理函数内的数据范围判断用 can
+// 角色 = 一组权限点，保存在 roles / role_permissions 表，修改后立即生效，无需重新编译
+
+// can 当前登录角色是否拥有权限点
+func can(c *gin.Context, perm string) bool {
+	return authz.Has(c.GetString("role"), perm)
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// validatePermissions 拒绝未定义的权限点，避免拼写错误的权限悄悄不生效
+func validatePermissions(perms []string) error {
+	var unknown []string
+	for _, p := range perms {
+		if !authz.Known(p) {
+			unknown = append(unknown, p)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("未定义的权限点: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// GetRoles 角色列表 (含权限点与用户数)
+// GET /dashboard/roles
+func GetRoles(c *gin.Context) {
+	var roles []model.Role
+	database.DB.Order("builtin desc, id asc").Find(&roles)
+
+	type roleCount struct {
+		Role  string
+		Count int64
+	}
+	var counts []roleCount
+	database.DB.Model(&model.User{}).Select("role, count(*) as count").Group("role").Scan(&counts)
+	users := map[string]int64{}
+	for _, rc := range counts {
+		users[rc.Role] = rc.Count
+	}
+
+	data := make([]gin.H, 0, len(roles))
+	for _, r := range roles {
+		r.Permissions = authz.PermissionsOf(r.Name)
+		data = append(data, gin.H{"role": r, "user_count": users[r.Name]})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// GetPermissionCatalog 全部权限点 (编辑角色时勾选)
+// GET /dashboard/roles/permissions
+func GetPermissionCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": authz.Catalog})
+}
+
+// GetMyPermissions 当前登录用户的权限点，前端据此显示菜单和按钮
+// GET /dashboard/permissions
+func GetMyPermissions(c *gin.Context) {
+	role := c.GetString("role")
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"role": role, "permissions": authz.PermissionsOf(role)}})
+}
+
+// CreateRole 新建自定义角色
+// POST /dashboard/roles
+func CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色名只能包含小写字母、数字和下划线，以字母开头，2-32 位"})
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := model.Role{Name: req.Name, Label: req.Label, Description: req.Description}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return authz.SetPermissions(tx, role.Name, req.Permissions)
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "角色已存在"})
+		return
+	}
+	authz.Invalidate()
+	logSecurityEvent(c, "role_created", "", 0, fmt.Sprintf("角色: %s, 权限: %s", role.Name, strings.Join(req.Permissions, ",")))
+
+	role.Permissions = authz.PermissionsOf(role.Name)
+	c.JSON(http.StatusOK, gin.H{"msg": "角色已创建", "data": role})
+}
+
+// findEditableRole 按名称查找角色；全局管理员角色不允许修改
+func findEditableRole(c *gin.Context) (model.Role, bool) {
+	var role model.Role
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return role, false
+	}
+	if role.Name == authz.SuperRole {
+		c.JSON(http.StatusForbidden, gin.H{"error": "全局管理员拥有全部权限，不能修改"})
+		return role, false
+	}
+	return role, true
+}
+
+// UpdateRole 修改角色名称说明和权限点，立即对该角色的所有用户生效
+// PUT /dashboard/roles/:name
+func UpdateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	role, ok := findEditableRole(c)
+	if !ok {
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Label != "" {
+		role.Label = req.Label
+	}
+	role.Description = req.Description
+	// 内置角色改过之后，升级时不再按默认权限覆盖
+	role.Customized = role.Builtin
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		return authz.SetPermissions(tx, role.Name, req.Permissions)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存角色失败"})
+		return
+	}
+	authz.Invalidate()
+	logSecurityEvent(c, "role_updated", "", 0, fmt.Sprintf("角色: %s, 权限: %s", role.Name, strings.Join(req.Permissions, ",")))
+
+	role.Permissions = authz.PermissionsOf(role.Name)
+	c.JSON(http.StatusOK, gin.H{"msg": "角色已更新", "data": role})
+}
+
+// ResetRole 内置角色恢复默认权限
+// POST /dashboard/roles/:name/reset
+func ResetRole(c *gin.Context) {
+	role, ok := findEditableRole(c)
+	if !ok {
+		return
+	}
+	perms, builtin := authz.Defaults(role.Name)
+	if !builtin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有内置角色可以恢复默认权限"})
+		return
+	}
+
+	role.Customized = false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		return authz.SetPermissions(tx, role.Name, perms)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存角色失败"})
+		return
+	}
+	authz.Invalidate()
+	logSecurityEvent(c, "role_updated", "", 0, "角色: "+role.Name+", 恢复默认权限")
+
+	role.Permissions = authz.PermissionsOf(role.Name)
+	c.JSON(http.StatusOK, gin.H{"msg": "已恢复默认权限", "data": role})
+}
+
+// DeleteRole 删除自定义角色 (仍有用户使用时拒绝，避免账号变成无权限)
+// DELETE /dashboard/roles/:name
+func DeleteRole(c *gin.Context) {
+	role, ok := findEditableRole(c)
+	if !ok {
+		return
+	}
+	if role.Builtin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "内置角色不能删除"})
+		return
+	}
+	var inUse int64
+	database.DB.Model(&model.User{}).Where("role = ?", role.Name).Count(&inUse)
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("仍有 %d 个用户使用该角色", inUse)})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&role).Error; err != nil {
+			return err
+		}
+		return authz.SetPermissions(tx, role.Name, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除角色失败"})
+		return
+	}
+	authz.Invalidate()
+	logSecurityEvent(c, "role_deleted", "", 0, "角色: "+role.Name)
+
+	c.JSON(http.StatusOK, gin.H{"msg": "角色已删除"})
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/token"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// --- 登录会话 (Session) ---
+// 短期访问令牌 + 服务端保存的轮换刷新令牌，支持退出登录和强制下线
+
+// startSession 登录成功后建立会话，返回访问令牌和刷新令牌
+func startSession(c *gin.Context, user model.User) (gin.H, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := model.Session{
+		UserID:      user.ID,
+		RefreshHash: hashRefreshToken(refreshToken),
+		IP:          c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		ExpiresAt:   now.Add(token.Default.SessionTTL),
+		LastUsedAt:  now,
+		CreatedAt:   now,
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return tokenResponse(user, session, refreshToken)
+}
+
+// tokenResponse 为会话签发新的访问令牌
+func tokenResponse(user model.User, session model.Session, refreshToken string) (gin.H, error) {
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"role":    user.Role,
+		"org_id":  user.OrgID,
+		"sid":     session.ID,
+	}
+	if user.MustChangePassword {
+		claims["pwd_change"] = true // 只能访问修改密码 / 退出登录
+	}
+	tokenString, err := token.Default.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":              tokenString,
+		"refresh_token":      refreshToken,
+		"expires_in":         int(token.Default.AccessTTL.Seconds()),
+		"session_expires_at": session.ExpiresAt,
+	}, nil
+}
+
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// currentUsername 当前登录用户的用户名
+func currentUsername(c *gin.Context) string {
+	var user model.User
+	database.DB.Select("username").First(&user, c.GetUint("user_id"))
+	return user.Username
+}
+
+// revokeSessions 作废用户的全部有效会话 (角色变更、删除用户、强制下线等)
+func revokeSessions(tx *gorm.DB, userID uint, reason string) error {
+	return tx.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+}
+
+// RefreshToken 用刷新令牌换发访问令牌，同时轮换刷新令牌
+// POST /api/v1/refresh
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	now := time.Now()
+	hash := hashRefreshToken(req.RefreshToken)
+	var session model.Session
+	if err := database.DB.Where("refresh_hash = ?", hash).First(&session).Error; err != nil {
+		// 已轮换掉的旧令牌再次出现：令牌可能被窃取，整个会话作废
+		var reused model.Session
+		if database.DB.Where("prev_refresh_hash = ? AND revoked_at IS NULL", hash).First(&reused).Error == nil {
+			database.DB.Model(&reused).Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": "refresh_reuse"})
+			var owner model.User
+			database.DB.Unscoped().First(&owner, reused.UserID)
+			logSecurityEvent(c, "refresh_reuse", owner.Username, reused.UserID, "会话 "+strconv.Itoa(int(reused.ID))+" 已作废")
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "刷新令牌无效，请重新登录"})
+		return
+	}
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新登录"})
+		return
+	}
+
+	// 每次换发都读取最新的用户信息，角色以数据库为准
+	var user model.User
+	if err := database.DB.First(&user, session.UserID).Error; err != nil {
+		revokeSessions(database.DB, session.UserID, "user_deleted")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新登录"})
+		return
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return
+	}
+	result := database.DB.Model(&model.Session{}).
+		Where("id = ? AND refresh_hash = ? AND revoked_at IS NULL", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_hash":      hashRefreshToken(refreshToken),
+			"prev_refresh_hash": hash,
+			"last_used_at":      now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "刷新令牌已被使用，请重新登录"})
+		return
+	}
+
+	resp, err := tokenResponse(user, session, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return
+	}
+	logSecurityEvent(c, "token_refresh", user.Username, user.ID, "会话 "+strconv.Itoa(int(session.ID)))
+	c.JSON(http.StatusOK, resp)
+}
+
+// Logout 退出登录，作废当前会话
+// POST /dashboard/logout
+func Logout(c *gin.Context) {
+	database.DB.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", c.GetUint("session_id")).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": "logout"})
+	logSecurityEvent(c, "logout", currentUsername(c), c.GetUint("user_id"), "会话 "+strconv.Itoa(int(c.GetUint("session_id"))))
+	c.JSON(http.StatusOK, gin.H{"msg": "已退出登录"})
+}
+
+// GetMySessions 当前用户的有效会话 (登录设备)
+// GET /dashboard/sessions
+func GetMySessions(c *gin.Context) {
+	var sessions []model.Session
+	database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", c.GetUint("user_id"), time.Now()).
+		Order("last_used_at desc").Find(&sessions)
+	c.JSON(http.StatusOK, gin.H{"data": sessions, "current": c.GetUint("session_id")})
+}
+
+// RevokeMySessions 退出所有设备
+// DELETE /dashboard/sessions
+func RevokeMySessions(c *gin.Context) {
+	if err := revokeSessions(database.DB, c.GetUint("user_id"), "logout_all"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	logSecurityEvent(c, "logout_all", currentUsername(c), c.GetUint("user_id"), "")
+	c.JSON(http.StatusOK, gin.H{"msg": "已退出所有设备"})
+}
+
+// RevokeUserSessions 管理员强制用户下线
+// POST /dashboard/users/:id/revoke_sessions
+func RevokeUserSessions(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var user model.User
+	if err := database.Scoped(c).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	if err := revokeSessions(database.DB, user.ID, "admin"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	logSecurityEvent(c, "sessions_revoked", user.Username, user.ID, "管理员强制下线")
+	c.JSON(http.StatusOK, gin.H{"msg": "已强制该用户下线"})
+}
+
+// GetJWKS 公开签名公钥，供其他内部服务校验本系统签发的访问令牌
+// GET /.well-known/jwks.json
+func GetJWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, token.Default.JWKS())
+}
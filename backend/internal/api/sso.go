@@ -0,0 +1,571 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/ldap"
+	"hospital-system/internal/model"
+	"hospital-system/internal/oidc"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 统一身份认证 (LDAP / OIDC) ---
+// 用户名密码登录按账号来源选择身份源：本地账号校验 bcrypt，目录账号向 LDAP 发起 bind；
+// 本地不存在的用户名在启用 LDAP 时交给目录校验，通过后自动创建本地用户 (JIT)。
+// OIDC 走授权码模式：回调后换成一次性 sso_code 跳回前端，前端再用它换 Token (同样经过两步验证)
+
+const (
+	ssoStateTTL = 10 * time.Minute // 跳转 IdP 登录到回调的最长时间
+	ssoCodeTTL  = time.Minute      // 一次性 sso_code 有效期
+	ldapTimeout = 5 * time.Second
+)
+
+// badCredentials 用户名或密码错误：对外统一提示，内容只写入审计日志
+type badCredentials string
+
+func (e badCredentials) Error() string { return string(e) }
+
+var (
+	errProviderUnavailable = errors.New("统一身份认证服务暂时不可用，请稍后再试")
+	errAccountConflict     = errors.New("该用户名已被本地账号占用，请联系管理员")
+	errNoRoleMapping       = errors.New("目录账号未分配本系统角色，请联系管理员")
+)
+
+// loginProvider 用户名密码登录的身份源
+type loginProvider interface {
+	Name() string
+	// Authenticate 校验密码，返回本地用户 (目录账号会按需创建 / 同步)
+	Authenticate(c *gin.Context, username, password string) (model.User, error)
+}
+
+var (
+	localLogin loginProvider = localProvider{}
+	ldapLogin  loginProvider = ldapProvider{}
+)
+
+// loginProviderFor 已有账号按其来源；新用户名在启用 LDAP 时交给目录
+func loginProviderFor(username string) loginProvider {
+	var user model.User
+	if database.DB.Select("auth_provider").Where("username = ?", username).First(&user).Error == nil {
+		if user.AuthProvider == "ldap" {
+			return ldapLogin
+		}
+		return localLogin
+	}
+	if config.AppConfig.SSO.LDAP.Enabled {
+		return ldapLogin
+	}
+	return localLogin
+}
+
+// localProvider 本地账号 (bcrypt)
+type localProvider struct{}
+
+func (localProvider) Name() string { return "local" }
+
+func (localProvider) Authenticate(c *gin.Context, username, password string) (model.User, error) {
+	// 用户不存在和密码错误返回同样的错误，且同样做一次 bcrypt 比对，防止枚举用户名
+	var user model.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		dummyUser.CheckPassword(password)
+		return user, badCredentials("用户不存在")
+	}
+	if user.IsExternal() {
+		dummyUser.CheckPassword(password)
+		return user, badCredentials("统一身份认证账号不能用本地密码登录")
+	}
+	if !user.CheckPassword(password) {
+		return user, badCredentials("密码错误")
+	}
+	return user, nil
+}
+
+// ldapProvider 目录账号：服务账号查找用户 DN，再用用户密码 bind
+type ldapProvider struct{}
+
+func (ldapProvider) Name() string { return "ldap" }
+
+func (ldapProvider) Authenticate(c *gin.Context, username, password string) (model.User, error) {
+	cfg := config.AppConfig.SSO.LDAP
+	if !cfg.Enabled {
+		return model.User{}, badCredentials("LDAP 未启用")
+	}
+
+	conn, err := ldap.Dial(cfg.URL, ldapTimeout)
+	if err != nil {
+		log.Printf("连接 LDAP 失败: %v", err)
+		return model.User{}, errProviderUnavailable
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			log.Printf("LDAP 服务账号 bind 失败: %v", err)
+			return model.User{}, errProviderUnavailable
+		}
+	}
+	filter := cfg.UserFilter
+	if filter == "" {
+		filter = "(uid=%s)"
+	}
+	attrs := []string{"cn"}
+	if cfg.GroupAttribute != "" {
+		attrs = append(attrs, cfg.GroupAttribute)
+	}
+	if cfg.DepartmentAttribute != "" {
+		attrs = append(attrs, cfg.DepartmentAttribute)
+	}
+	entries, err := conn.Search(ldap.SearchRequest{
+		BaseDN:     cfg.BaseDN,
+		Filter:     fmt.Sprintf(filter, ldap.EscapeFilter(username)),
+		Attributes: attrs,
+		SizeLimit:  2,
+	})
+	if err != nil {
+		log.Printf("LDAP 查找用户失败: %v", err)
+		return model.User{}, errProviderUnavailable
+	}
+	if len(entries) != 1 {
+		dummyUser.CheckPassword(password)
+		return model.User{}, badCredentials(fmt.Sprintf("目录中找到 %d 个匹配的用户", len(entries)))
+	}
+
+	entry := entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if errors.Is(err, ldap.ErrInvalidCredentials) {
+			return model.User{}, badCredentials("目录密码错误")
+		}
+		log.Printf("LDAP 用户 bind 失败: %v", err)
+		return model.User{}, errProviderUnavailable
+	}
+
+	return provisionUser(c, externalIdentity{
+		Provider:   "ldap",
+		ExternalID: entry.DN,
+		Username:   username,
+		Groups:     entry.GetAll(cfg.GroupAttribute),
+		Department: entry.Get(cfg.DepartmentAttribute),
+	})
+}
+
+// externalIdentity 目录 / IdP 返回的身份
+type externalIdentity struct {
+	Provider   string
+	ExternalID string
+	Username   string
+	Groups     []string
+	Department string
+}
+
+// mapDirectoryGroups 按 role_mapping 的顺序取第一个匹配的组
+// 映射到未定义的角色 (配置写错或角色已删除) 视为不匹配
+func mapDirectoryGroups(groups []string, department string) (string, string) {
+	for _, m := range config.AppConfig.SSO.RoleMapping {
+		if !authz.Exists(m.Role) {
+			log.Printf("统一身份认证: 组 %s 映射的角色 %s 不存在，已忽略", m.Group, m.Role)
+			continue
+		}
+		for _, g := range groups {
+			if groupMatches(m.Group, g) {
+				if m.Department != "" {
+					department = m.Department
+				}
+				return m.Role, department
+			}
+		}
+	}
+	if role := config.AppConfig.SSO.DefaultRole; authz.Exists(role) {
+		return role, department
+	}
+	return "", department
+}
+
+// directoryRole 目录同步可以直接生效的角色，以及需要审批的管理员角色
+// 管理员角色 (authz.Privileged) 不随目录自动授予，否则能改目录组的人就能给自己提权：
+// 新账号先按 default_role 创建，已有账号保持原角色，同时登记一条待审批的授予申请
+func directoryRole(mapped string, user model.User) (role, pending string) {
+	if mapped == "" || !authz.Privileged(mapped) || mapped == user.Role {
+		return mapped, ""
+	}
+	if user.ID != 0 {
+		return user.Role, mapped
+	}
+	if def := config.AppConfig.SSO.DefaultRole; authz.Exists(def) && !authz.Privileged(def) {
+		return def, mapped
+	}
+	return "", mapped
+}
+
+// requestDirectoryGrant 为目录组映射的管理员角色登记授予申请 (已有待审批申请时不重复登记)
+func requestDirectoryGrant(c *gin.Context, user model.User, toRole, provider string) {
+	var pending int64
+	database.DB.Model(&model.RoleGrant{}).Where("user_id = ? AND status = ?", user.ID, "Pending").Count(&pending)
+	if pending > 0 {
+		return
+	}
+	grant := model.RoleGrant{
+		OrgID:         user.OrgID,
+		UserID:        user.ID,
+		Username:      user.Username,
+		FromRole:      user.Role,
+		ToRole:        toRole,
+		Status:        "Pending",
+		RequesterName: "目录同步 (" + provider + ")",
+	}
+	if err := database.DB.Create(&grant).Error; err != nil {
+		log.Printf("登记目录角色授予申请失败: %v", err)
+		return
+	}
+	logSecurityEvent(c, "role_grant_requested", user.Username, user.ID, fmt.Sprintf("申请 #%d, %s 目录同步 -> %s", grant.ID, provider, toRole))
+}
+
+// groupMatches 配置可以写完整 DN，也可以只写组名 (DN 的第一段 cn=xxx)
+func groupMatches(want, group string) bool {
+	if strings.EqualFold(want, group) {
+		return true
+	}
+	first := strings.SplitN(group, ",", 2)[0]
+	if eq := strings.IndexByte(first, '='); eq > 0 {
+		return strings.EqualFold(want, strings.TrimSpace(first[eq+1:]))
+	}
+	return false
+}
+
+// ssoOrg 统一身份认证账号归属的机构
+func ssoOrg() uint {
+	if id := config.AppConfig.SSO.OrgID; id != 0 {
+		return id
+	}
+	return model.DefaultOrgID
+}
+
+// provisionUser 首次登录创建本地用户，之后每次登录按目录同步角色和科室
+// 同名的本地账号不会自动关联，防止目录中新建同名账号接管本地账号
+func provisionUser(c *gin.Context, id externalIdentity) (model.User, error) {
+	mapped, department := mapDirectoryGroups(id.Groups, id.Department)
+
+	var user model.User
+	err := database.DB.Where("auth_provider = ? AND external_id = ?", id.Provider, id.ExternalID).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+	role, pending := directoryRole(mapped, user)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if database.DB.Where("username = ?", id.Username).First(&model.User{}).Error == nil {
+			logSecurityEvent(c, "sso_conflict", id.Username, 0, id.Provider+": "+id.ExternalID)
+			return user, errAccountConflict
+		}
+		if role == "" && pending != "" {
+			logSecurityEvent(c, "sso_denied", id.Username, 0, id.Provider+": 管理员角色 "+pending+" 需在系统内授予，且未配置可用的 default_role")
+			return user, errNoRoleMapping
+		}
+		if role == "" {
+			logSecurityEvent(c, "sso_denied", id.Username, 0, id.Provider+": 没有匹配的角色")
+			return user, errNoRoleMapping
+		}
+
+		// 本地密码随机生成且不会告知任何人，目录账号只能走统一身份认证
+		placeholder := make([]byte, 32)
+		if _, err := rand.Read(placeholder); err != nil {
+			return user, err
+		}
+		user = model.User{
+			Username:     id.Username,
+			Password:     base64.RawURLEncoding.EncodeToString(placeholder),
+			Role:         role,
+			Department:   department,
+			OrgID:        ssoOrg(),
+			AuthProvider: id.Provider,
+			ExternalID:   id.ExternalID,
+		}
+		if err := database.DB.Create(&user).Error; err != nil {
+			return user, err
+		}
+		logSecurityEvent(c, "user_provisioned", user.Username, user.ID, fmt.Sprintf("%s 角色: %s", id.Provider, role))
+		if pending != "" {
+			requestDirectoryGrant(c, user, pending, id.Provider)
+		}
+		return user, nil
+	}
+
+	if role == "" {
+		// 已从所有映射组中移除：禁止登录并作废现有会话
+		revokeSessions(database.DB, user.ID, "sso_role_removed")
+		logSecurityEvent(c, "sso_denied", user.Username, user.ID, id.Provider+": 没有匹配的角色")
+		return user, errNoRoleMapping
+	}
+	if role != user.Role || department != user.Department {
+		oldRole := user.Role
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{"role": role, "department": department}).Error; err != nil {
+				return err
+			}
+			if role != oldRole {
+				return revokeSessions(tx, user.ID, "role_changed")
+			}
+			return nil
+		})
+		if err != nil {
+			return user, err
+		}
+		if role != oldRole {
+			logSecurityEvent(c, "role_changed", user.Username, user.ID, oldRole+" -> "+role+" (目录同步)")
+		}
+	}
+	if pending != "" {
+		requestDirectoryGrant(c, user, pending, id.Provider)
+	}
+	return user, nil
+}
+
+// --- OIDC 授权码模式 ---
+
+var (
+	oidcOnce     sync.Once
+	oidcProvider *oidc.Provider
+
+	// 跳转 IdP 时的 state → nonce / PKCE verifier，以及回调后的一次性 sso_code (单实例部署，放内存即可)
+	ssoMu      sync.Mutex
+	oidcStates = map[string]oidcState{}
+	ssoCodes   = map[string]ssoCode{}
+)
+
+type oidcState struct {
+	Nonce     string
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+type ssoCode struct {
+	UserID    uint
+	ExpiresAt time.Time
+}
+
+func oidcClient() *oidc.Provider {
+	oidcOnce.Do(func() {
+		cfg := config.AppConfig.SSO.OIDC
+		oidcProvider = oidc.New(cfg.Issuer, cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, cfg.Scopes)
+	})
+	return oidcProvider
+}
+
+// purgeSSOState 清理过期的 state 和 sso_code (调用方持有 ssoMu)
+func purgeSSOState(now time.Time) {
+	for k, v := range oidcStates {
+		if now.After(v.ExpiresAt) {
+			delete(oidcStates, k)
+		}
+	}
+	for k, v := range ssoCodes {
+		if now.After(v.ExpiresAt) {
+			delete(ssoCodes, k)
+		}
+	}
+}
+
+// GetSSOProviders 登录页显示哪些登录方式
+// GET /api/v1/sso/providers
+func GetSSOProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"local": true,
+		"ldap":  config.AppConfig.SSO.LDAP.Enabled,
+		"oidc":  config.AppConfig.SSO.OIDC.Enabled,
+	})
+}
+
+// OIDCLogin 跳转到 IdP 登录
+// GET /api/v1/sso/oidc/login
+func OIDCLogin(c *gin.Context) {
+	if !config.AppConfig.SSO.OIDC.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用 OIDC 登录"})
+		return
+	}
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成登录参数失败"})
+		return
+	}
+
+	authURL, err := oidcClient().AuthCodeURL(c.Request.Context(), state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		log.Printf("OIDC 登录跳转失败: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errProviderUnavailable.Error()})
+		return
+	}
+
+	now := time.Now()
+	ssoMu.Lock()
+	purgeSSOState(now)
+	oidcStates[state] = oidcState{Nonce: nonce, Verifier: verifier, ExpiresAt: now.Add(ssoStateTTL)}
+	ssoMu.Unlock()
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback IdP 回调：校验 ID Token，创建 / 同步本地用户，带一次性 sso_code 跳回前端
+// GET /api/v1/sso/oidc/callback?code=&state=
+func OIDCCallback(c *gin.Context) {
+	cfg := config.AppConfig.SSO.OIDC
+	if !cfg.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用 OIDC 登录"})
+		return
+	}
+	fail := func(msg string) {
+		c.Redirect(http.StatusFound, frontendURL(cfg.FrontendURL, "sso_error", msg))
+	}
+	if e := c.Query("error"); e != "" {
+		fail("统一身份认证登录失败: " + e)
+		return
+	}
+
+	ssoMu.Lock()
+	st, ok := oidcStates[c.Query("state")]
+	delete(oidcStates, c.Query("state"))
+	ssoMu.Unlock()
+	if !ok || time.Now().After(st.ExpiresAt) {
+		fail("登录请求已过期，请重新登录")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	provider := oidcClient()
+	rawIDToken, err := provider.Exchange(ctx, c.Query("code"), st.Verifier)
+	if err != nil {
+		log.Printf("OIDC 换取令牌失败: %v", err)
+		fail(errProviderUnavailable.Error())
+		return
+	}
+	claims, err := provider.Verify(ctx, rawIDToken, st.Nonce)
+	if err != nil {
+		logSecurityEvent(c, "login_failed", "", 0, "oidc: "+err.Error())
+		fail("统一身份认证登录失败")
+		return
+	}
+
+	sub, _ := claims["sub"].(string)
+	username := claimString(claims, cfg.UsernameClaim, "preferred_username")
+	if sub == "" || username == "" {
+		fail("ID Token 缺少用户标识")
+		return
+	}
+	user, err := provisionUser(c, externalIdentity{
+		Provider:   "oidc",
+		ExternalID: sub,
+		Username:   username,
+		Groups:     claimStrings(claims, orDefault(cfg.GroupsClaim, "groups")),
+		Department: claimString(claims, cfg.DepartmentClaim, "department"),
+	})
+	if err != nil {
+		if errors.Is(err, errAccountConflict) || errors.Is(err, errNoRoleMapping) {
+			fail(err.Error())
+			return
+		}
+		log.Printf("OIDC 创建本地用户失败: %v", err)
+		fail("登录失败")
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		fail("登录失败")
+		return
+	}
+	now := time.Now()
+	ssoMu.Lock()
+	purgeSSOState(now)
+	ssoCodes[code] = ssoCode{UserID: user.ID, ExpiresAt: now.Add(ssoCodeTTL)}
+	ssoMu.Unlock()
+
+	c.Redirect(http.StatusFound, frontendURL(cfg.FrontendURL, "sso_code", code))
+}
+
+// SSOExchange 前端用一次性 sso_code 换 Token，与密码登录的后续步骤相同 (两步验证、强制改密)
+// POST /api/v1/sso/exchange
+func SSOExchange(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	ssoMu.Lock()
+	sc, ok := ssoCodes[req.Code]
+	delete(ssoCodes, req.Code)
+	ssoMu.Unlock()
+	if !ok || time.Now().After(sc.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录凭证无效或已过期，请重新登录"})
+		return
+	}
+
+	var user model.User
+	if err := database.DB.First(&user, sc.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录凭证无效或已过期，请重新登录"})
+		return
+	}
+	if mfaChallenge(c, user) {
+		return
+	}
+	if resp, ok := finishLogin(c, user, "oidc"); ok {
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func frontendURL(base, key, value string) string {
+	if base == "" {
+		base = "/login"
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + key + "=" + url.QueryEscape(value)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func claimString(claims map[string]interface{}, name, def string) string {
+	s, _ := claims[orDefault(name, def)].(string)
+	return s
+}
+
+// claimStrings 组声明可能是数组，也可能是单个字符串
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/authz"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/ssostandin"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withSSOConfig 临时替换统一身份认证的角色映射
+func withSSOConfig(t *testing.T, defaultRole string, mapping ...config.GroupMapping) {
+	t.Helper()
+	saved := config.AppConfig.SSO
+	config.AppConfig.SSO.RoleMapping = mapping
+	config.AppConfig.SSO.DefaultRole = defaultRole
+	t.Cleanup(func() { config.AppConfig.SSO = saved })
+}
+
+func loginContext() *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", nil)
+	return c
+}
+
+func pendingGrants(userID uint) []model.RoleGrant {
+	var grants []model.RoleGrant
+	database.DB.Where("user_id = ? AND status = ?", userID, "Pending").Find(&grants)
+	return grants
+}
+
+// 目录组映射的管理员角色不自动生效，登记为待审批的授予申请
+func TestDirectoryPrivilegedRoleNeedsGrant(t *testing.T) {
+	withSSOConfig(t, "general_user",
+		config.GroupMapping{Group: "admins", Role: authz.SuperRole},
+		config.GroupMapping{Group: "doctors", Role: "doctor"},
+	)
+	id := externalIdentity{Provider: "ldap", ExternalID: "uid=dir.admin,ou=people", Username: "dir.admin", Groups: []string{"cn=admins,ou=groups"}}
+
+	user, err := provisionUser(loginContext(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != "general_user" {
+		t.Errorf("new directory admin provisioned as %q, want general_user", user.Role)
+	}
+	grants := pendingGrants(user.ID)
+	if len(grants) != 1 || grants[0].ToRole != authz.SuperRole || grants[0].FromRole != "general_user" {
+		t.Fatalf("pending grants %+v", grants)
+	}
+
+	// 再次登录：角色不变，不重复登记申请
+	user, err = provisionUser(loginContext(), id)
+	if err != nil || user.Role != "general_user" || len(pendingGrants(user.ID)) != 1 {
+		t.Errorf("second login role=%q err=%v grants=%d", user.Role, err, len(pendingGrants(user.ID)))
+	}
+
+	// 已有的医生被加入管理员组：保持医生角色
+	doc := externalIdentity{Provider: "ldap", ExternalID: "uid=dir.doc,ou=people", Username: "dir.doc", Groups: []string{"doctors"}}
+	user, _ = provisionUser(loginContext(), doc)
+	doc.Groups = []string{"admins"}
+	user, err = provisionUser(loginContext(), doc)
+	if err != nil || user.Role != "doctor" {
+		t.Errorf("doctor moved to admins: role=%q err=%v", user.Role, err)
+	}
+	var stored model.User
+	database.DB.First(&stored, user.ID)
+	if stored.Role != "doctor" || len(pendingGrants(user.ID)) != 1 {
+		t.Errorf("stored role %q, %d pending grants", stored.Role, len(pendingGrants(user.ID)))
+	}
+}
+
+func TestDirectoryPrivilegedRoleWithoutDefault(t *testing.T) {
+	withSSOConfig(t, "", config.GroupMapping{Group: "admins", Role: "org_admin"})
+	_, err := provisionUser(loginContext(), externalIdentity{Provider: "oidc", ExternalID: "sub-admin", Username: "oidc.admin", Groups: []string{"admins"}})
+	if !errors.Is(err, errNoRoleMapping) {
+		t.Errorf("err = %v, want errNoRoleMapping", err)
+	}
+	var count int64
+	database.DB.Model(&model.User{}).Where("username = ?", "oidc.admin").Count(&count)
+	if count != 0 {
+		t.Error("directory admin provisioned without a grantable role")
+	}
+}
+
+// 映射到不存在的角色视为不匹配
+func TestDirectoryUnknownRoleIgnored(t *testing.T) {
+	withSSOConfig(t, "no_such_default",
+		config.GroupMapping{Group: "typo", Role: "docter"},
+		config.GroupMapping{Group: "staff", Role: "lab"},
+	)
+	if role, _ := mapDirectoryGroups([]string{"typo", "staff"}, ""); role != "lab" {
+		t.Errorf("role = %q, want lab", role)
+	}
+	if role, _ := mapDirectoryGroups([]string{"typo"}, ""); role != "" {
+		t.Errorf("role = %q for unknown mapping and default, want none", role)
+	}
+}
+
+// --- 对接进程内的联调目录和身份提供方 (internal/ssostandin) ---
+
+// useStandin 启动联调目录和身份提供方，按 config.yaml 示例配置 LDAP / OIDC 和组映射
+func useStandin(t *testing.T, defaultRole string) {
+	t.Helper()
+	withSSOConfig(t, defaultRole,
+		config.GroupMapping{Group: "finance", Role: "finance"},
+		config.GroupMapping{Group: "doctors", Role: "doctor"},
+	)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ssostandin.NewLDAPServer("").Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+
+	var handler http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler.ServeHTTP(w, r) }))
+	t.Cleanup(srv.Close)
+	idp, err := ssostandin.NewIdP(srv.URL, "hospital-system", "standin-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler = idp.Handler()
+
+	sso := &config.AppConfig.SSO
+	sso.LDAP.Enabled = true
+	sso.LDAP.URL = "ldap://" + ln.Addr().String()
+	sso.LDAP.BindDN, sso.LDAP.BindPassword = ssostandin.ReadonlyDN, ssostandin.ReadonlyPassword
+	sso.LDAP.BaseDN = "ou=people," + ssostandin.BaseDN
+	sso.LDAP.UserFilter = "(uid=%s)"
+	sso.LDAP.GroupAttribute, sso.LDAP.DepartmentAttribute = "memberOf", "departmentNumber"
+
+	sso.OIDC.Enabled = true
+	sso.OIDC.Issuer = srv.URL
+	sso.OIDC.ClientID, sso.OIDC.ClientSecret = "hospital-system", "standin-secret"
+	sso.OIDC.RedirectURL = "http://app.local/api/v1/sso/oidc/callback"
+	sso.OIDC.FrontendURL = "http://app.local/login"
+	oidcProvider = nil
+	oidcOnce = sync.Once{}
+	t.Cleanup(func() { oidcProvider, oidcOnce = nil, sync.Once{} })
+}
+
+func TestLDAPLoginWithStandin(t *testing.T) {
+	useStandin(t, "")
+	login := func(username, password string) (model.User, error) {
+		return ldapLogin.Authenticate(loginContext(), username, password)
+	}
+
+	// 组 doctors -> doctor，科室取目录属性
+	user, err := login("zhangsan", ssostandin.DemoPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != "doctor" || user.Department != "内科" || user.AuthProvider != "ldap" || user.OrgID != model.DefaultOrgID {
+		t.Errorf("provisioned %+v", user)
+	}
+	again, err := login("zhangsan", ssostandin.DemoPassword)
+	if err != nil || again.ID != user.ID {
+		t.Errorf("second login: user %d err %v, want user %d", again.ID, err, user.ID)
+	}
+	if loginProviderFor("zhangsan") != ldapLogin {
+		t.Error("directory account not routed to LDAP")
+	}
+
+	var bad badCredentials
+	if _, err := login("zhangsan", "wrong-password"); !errors.As(err, &bad) {
+		t.Errorf("wrong password: err = %v", err)
+	}
+	if _, err := login("zhangsan)(uid=*", ssostandin.DemoPassword); !errors.As(err, &bad) {
+		t.Errorf("filter injection: err = %v", err)
+	}
+	// 不属于任何映射组
+	if _, err := login("wangwu", ssostandin.DemoPassword); !errors.Is(err, errNoRoleMapping) {
+		t.Errorf("unmapped user: err = %v", err)
+	}
+
+	// 同名本地账号不会被目录账号接管
+	local := model.User{Username: "lisi", Password: "Passw0rd!x", Role: "general_user"}
+	if err := database.DB.Create(&local).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login("lisi", ssostandin.DemoPassword); !errors.Is(err, errAccountConflict) {
+		t.Errorf("local account conflict: err = %v", err)
+	}
+	var stored model.User
+	database.DB.First(&stored, local.ID)
+	if stored.IsExternal() || stored.Role != "general_user" {
+		t.Errorf("local account changed: %+v", stored)
+	}
+}
+
+// oidcCallback 走一遍 OIDC 登录：跳转 IdP -> 演示账号登录 -> 回调，返回跳回前端的地址参数
+func oidcCallback(t *testing.T, username string) url.Values {
+	t.Helper()
+	// 测试请求是 POST，http.Redirect 不写响应体，状态码留在 gin 的 Writer 里，这里只看 Location
+	w := callHandler(OIDCLogin, "", database.Tenant{}, ``)
+	if w.Header().Get("Location") == "" {
+		t.Fatalf("oidc login: %d %s", w.Code, w.Body)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(w.Header().Get("Location"), url.Values{"username": {username}, "password": {ssostandin.DemoPassword}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: %d %v", resp.StatusCode, err)
+	}
+
+	w = callHandler(func(c *gin.Context) {
+		c.Request.URL.RawQuery = back.RawQuery
+		OIDCCallback(c)
+	}, "", database.Tenant{}, ``)
+	front, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || front.Path != "/login" {
+		t.Fatalf("callback: %s %v", w.Header().Get("Location"), err)
+	}
+	return front.Query()
+}
+
+func TestOIDCLoginWithStandin(t *testing.T) {
+	useStandin(t, "lab")
+
+	// 没有映射组，按 default_role 创建
+	q := oidcCallback(t, "wangwu")
+	if q.Get("sso_code") == "" {
+		t.Fatalf("no sso_code: %v", q)
+	}
+	var user model.User
+	if err := database.DB.Where("auth_provider = ? AND external_id = ?", "oidc", "standin-wangwu").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "wangwu" || user.Role != "lab" || user.Department != "后勤" {
+		t.Errorf("provisioned %+v", user)
+	}
+	ssoMu.Lock()
+	sc := ssoCodes[q.Get("sso_code")]
+	ssoMu.Unlock()
+	if sc.UserID != user.ID {
+		t.Errorf("sso_code for user %d, want %d", sc.UserID, user.ID)
+	}
+
+	// 伪造或已用过的 state
+	w := callHandler(func(c *gin.Context) {
+		c.Request.URL.RawQuery = "state=forged&code=x"
+		OIDCCallback(c)
+	}, "", database.Tenant{}, ``)
+	if front, _ := url.Parse(w.Header().Get("Location")); front == nil || front.Query().Get("sso_error") == "" {
+		t.Errorf("forged state: %s", w.Header().Get("Location"))
+	}
+
+	// 用户名已被其他来源的账号占用 (本地账号，或 LDAP 测试中创建的目录账号)
+	database.DB.Where(model.User{Username: "zhangsan"}).
+		Attrs(model.User{Password: "Passw0rd!x", Role: "general_user"}).FirstOrCreate(&model.User{})
+	if q := oidcCallback(t, "zhangsan"); q.Get("sso_error") != errAccountConflict.Error() {
+		t.Errorf("conflict: %v", q)
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 患者时间轴 (Timeline) ---
+// 把挂号、就诊、诊断、处方、检验、缴费、附件按时间合并成一条时间线
+
+// TimelineEvent 时间轴上的一条事件
+type TimelineEvent struct {
+	Type       string    `json:"type"` // booking, encounter, diagnosis, prescription, lab_result, payment, attachment
+	Time       time.Time `json:"time"`
+	BookingID  uint      `json:"booking_id"`
+	RefID      uint      `json:"ref_id"` // 对应业务表的主键
+	Department string    `json:"department"`
+	DoctorName string    `json:"doctor_name"`
+	Title      string    `json:"title"`
+	Detail     string    `json:"detail"`
+}
+
+var timelineTypes = []string{"booking", "encounter", "diagnosis", "prescription", "lab_result", "payment", "attachment"}
+
+// timelineBooking 挂号单 + 医生名
+type timelineBooking struct {
+	model.Booking
+	DoctorName string
+}
+
+// GetPatientTimeline 患者纵向时间轴
+// GET /patients/:id/timeline?types=encounter,lab_result&page=1&page_size=20
+func GetPatientTimeline(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var patient model.Patient
+	if err := database.Scoped(c).First(&patient, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者不存在"})
+		return
+	}
+
+	// 1. 过滤参数
+	wanted := map[string]bool{}
+	if types := c.Query("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			wanted[strings.TrimSpace(t)] = true
+		}
+	} else {
+		for _, t := range timelineTypes {
+			wanted[t] = true
+		}
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// 2. 当前用户可见的挂号单 (与病历同一套角色规则)
+	db := database.Scoped(c).Table("bookings").
+		Select("bookings.*, users.username as doctor_name").
+		Joins("LEFT JOIN users ON users.id = bookings.doctor_id").
+		Where("bookings.patient_id = ?", patient.ID)
+	db, ok = scopeMedicalRecords(c, db)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+	var bookings []timelineBooking
+	if err := db.Scan(&bookings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取时间轴失败"})
+		return
+	}
+
+	// 患者本人看不到别人的档案；医生只能看到自己接诊过的患者
+	if len(bookings) == 0 && !can(c, "record.read.all") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该患者"})
+		return
+	}
+
+	byID := map[uint]timelineBooking{}
+	ids := make([]uint, 0, len(bookings))
+	for _, b := range bookings {
+		byID[b.ID] = b
+		ids = append(ids, b.ID)
+	}
+	event := func(typ string, t time.Time, bookingID, refID uint, title, detail string) TimelineEvent {
+		b := byID[bookingID]
+		return TimelineEvent{Type: typ, Time: t, BookingID: bookingID, RefID: refID, Department: b.Department, DoctorName: b.DoctorName, Title: title, Detail: detail}
+	}
+
+	// 3. 汇总各类事件
+	events := []TimelineEvent{}
+
+	if wanted["booking"] {
+		for _, b := range bookings {
+			events = append(events, event("booking", b.CreatedAt, b.ID, b.ID, "挂号 "+b.Department, b.Status))
+		}
+	}
+
+	if len(ids) > 0 && (wanted["encounter"] || wanted["diagnosis"] || wanted["prescription"] || wanted["attachment"]) {
+		var records []struct {
+			model.MedicalRecord
+			AuthorName string
+		}
+		database.Scoped(c).Table("medical_records").
+			Select("medical_records.*, users.username as author_name").
+			Joins("LEFT JOIN users ON users.id = medical_records.doctor_id").
+			Where("medical_records.booking_id IN ?", ids).
+			Scan(&records)
+
+		recordIDs := make([]uint, 0, len(records))
+		recordByID := map[uint]model.MedicalRecord{}
+		for _, r := range records {
+			recordIDs = append(recordIDs, r.ID)
+			recordByID[r.ID] = r.MedicalRecord
+
+			if wanted["encounter"] {
+				e := event("encounter", r.CreatedAt, r.BookingID, r.ID, "就诊", r.ChiefComplaint)
+				if r.AuthorName != "" {
+					e.DoctorName = r.AuthorName
+				}
+				events = append(events, e)
+			}
+			if wanted["prescription"] && r.Prescription != "" {
+				events = append(events, event("prescription", r.CreatedAt, r.BookingID, r.ID, "处方", r.Prescription))
+			}
+		}
+
+		if wanted["diagnosis"] && len(recordIDs) > 0 {
+			var diagnoses []model.MedicalRecordDiagnosis
+			database.Scoped(c).Where("record_id IN ?", recordIDs).Order("sequence asc").Find(&diagnoses)
+			for _, d := range diagnoses {
+				r := recordByID[d.RecordID]
+				if d.RecordVersion != r.Version {
+					continue
+				}
+				events = append(events, event("diagnosis", r.CreatedAt, r.BookingID, d.ID, d.Code, d.Description))
+			}
+		}
+
+		if wanted["attachment"] && len(recordIDs) > 0 {
+			var attachments []model.Attachment
+			database.Scoped(c).Where("record_id IN ?", recordIDs).Find(&attachments)
+			for _, a := range attachments {
+				events = append(events, event("attachment", a.CreatedAt, recordByID[a.RecordID].BookingID, a.ID, a.FileName, a.MimeType))
+			}
+		}
+	}
+
+	if wanted["lab_result"] && len(ids) > 0 {
+		var labs []model.LabOrder
+		database.Scoped(c).Where("booking_id IN ? AND status = ?", ids, "Resulted").Find(&labs)
+		for _, l := range labs {
+			detail := l.ResultValue + " " + l.Unit
+			if l.Flag != "" && l.Flag != "N" {
+				detail += " [" + l.Flag + "]"
+			}
+			events = append(events, event("lab_result", *l.ResultedAt, l.BookingID, l.ID, l.TestName, strings.TrimSpace(detail)))
+		}
+	}
+
+	if wanted["payment"] && len(ids) > 0 {
+		var orders []model.Order
+		database.Scoped(c).Where("booking_id IN ? AND status = ?", ids, "Paid").Find(&orders)
+		for _, o := range orders {
+			events = append(events, event("payment", o.UpdatedAt, o.BookingID, o.ID, "缴费", strconv.FormatFloat(o.TotalAmount, 'f', 2, 64)))
+		}
+	}
+
+	// 4. 按时间倒序 + 分页
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.After(events[j].Time) })
+	total := len(events)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patient":   patient,
+		"data":      events[start:end],
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// --- 待核对的患者档案 ---
+
+// PatientReview 待核对档案及其同名档案
+type PatientReview struct {
+	model.Patient
+	SameName []model.Patient `json:"same_name"`
+}
+
+// GetPatientsForReview 与已有同名档案无法确认是否同一人的新档案 (见 model.MatchPatient)，供人工核对合并
+// GET /patients/review
+func GetPatientsForReview(c *gin.Context) {
+	var flagged []model.Patient
+	database.Scoped(c).Where("needs_review = ?", true).Order("id desc").Limit(200).Find(&flagged)
+
+	result := make([]PatientReview, 0, len(flagged))
+	for _, p := range flagged {
+		var same []model.Patient
+		database.Scoped(c).Where("org_id = ? AND name = ? AND id <> ?", p.OrgID, p.Name, p.ID).Order("id asc").Find(&same)
+		result = append(result, PatientReview{Patient: p, SameName: same})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/events"
+	"hospital-system/internal/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 急诊分诊 (Triage) ---
+// 急诊台登记分级、生命体征和主诉后直接进入医生队列 (不占号源)
+// 候诊超过该级别的时限时推送 triage.overdue 提醒，并可复评调整分级
+
+// defaultMaxWait 未配置时各级最长候诊时间 (分钟)
+var defaultMaxWait = []int{0, 10, 30, 60, 120}
+
+type TriageRequest struct {
+	// 新患者登记 (复评时不需要)
+	PatientName string `json:"patient_name"`
+	Age         int    `json:"age"`
+	Gender      string `json:"gender"`
+	Department  string `json:"department"`
+	DoctorID    uint   `json:"doctor_id"`
+	Phone       string `json:"phone"`
+	IDCard      string `json:"id_card"`
+
+	Level     int          `json:"level" binding:"required"`
+	Complaint string       `json:"complaint"`
+	Vitals    *VitalsInput `json:"vitals"`
+	Reason    string       `json:"reason"` // 复评原因
+}
+
+// CreateTriage 急诊分诊并挂号
+// POST /triage
+func CreateTriage(c *gin.Context) {
+	var req TriageRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Level < 1 || req.Level > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：分级必须为 1-5"})
+		return
+	}
+	if req.PatientName == "" || req.Department == "" || req.Complaint == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "患者姓名、科室和主诉必填"})
+		return
+	}
+	vitals, err := req.Vitals.Normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patient, err := model.FindOrCreatePatient(homeOrg(c), model.PatientInfo{
+		Name:      req.PatientName,
+		IDCard:    req.IDCard,
+		Phone:     req.Phone,
+		Gender:    req.Gender,
+		BirthYear: model.BirthYearOf(req.Age, time.Now()),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "建立患者档案失败"})
+		return
+	}
+
+	now := time.Now()
+	booking := model.Booking{
+		PatientID:   patient.ID,
+		PatientName: req.PatientName,
+		Age:         req.Age,
+		Gender:      req.Gender,
+		Department:  req.Department,
+		DoctorID:    req.DoctorID,
+		Status:      "Pending",
+		Acuity:      req.Level,
+		Priority:    triagePriority(req.Level, ""),
+		TriagedAt:   &now,
+		CreatedAt:   now,
+	}
+	if booking.DoctorID == 0 {
+		booking.DoctorID = 1
+	}
+
+	var record model.TriageRecord
+	err = createQueuedBooking(homeOrg(c), &booking, false, func(tx *gorm.DB) error {
+		record = model.TriageRecord{
+			OrgID:     booking.OrgID,
+			BookingID: booking.ID,
+			Level:     req.Level,
+			Complaint: req.Complaint,
+			Vitals:    vitals,
+			TriagedBy: c.GetUint("user_id"),
+			CreatedAt: now,
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分诊登记失败"})
+		return
+	}
+
+	publishQueue("booking.created", booking)
+	publishBookingADT(booking, "A04")
+	c.JSON(http.StatusOK, gin.H{"msg": "分诊完成", "data": booking, "triage": record})
+}
+
+// Retriage 复评：重新分级，候诊计时从复评时刻重新开始
+// POST /triage/:id/retriage  (:id 为挂号单号)
+func Retriage(c *gin.Context) {
+	var req TriageRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Level < 1 || req.Level > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：分级必须为 1-5"})
+		return
+	}
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写复评原因"})
+		return
+	}
+	vitals, err := req.Vitals.Normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	booking, ok := findQueueBooking(c)
+	if !ok {
+		return
+	}
+
+	// 未填写主诉时沿用上一次分诊的主诉
+	if req.Complaint == "" {
+		var last model.TriageRecord
+		if database.Scoped(c).Where("booking_id = ?", booking.ID).Order("id desc").First(&last).Error == nil {
+			req.Complaint = last.Complaint
+		}
+	}
+
+	now := time.Now()
+	record := model.TriageRecord{
+		OrgID:     booking.OrgID,
+		BookingID: booking.ID,
+		Level:     req.Level,
+		Complaint: req.Complaint,
+		Vitals:    vitals,
+		Reason:    req.Reason,
+		TriagedBy: c.GetUint("user_id"),
+		CreatedAt: now,
+	}
+	booking.Acuity = req.Level
+	booking.Priority = triagePriority(req.Level, booking.Priority)
+	booking.TriagedAt = &now
+	booking.EscalatedAt = nil
+
+	err = database.Scoped(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return tx.Model(&booking).Updates(map[string]interface{}{
+			"acuity":       booking.Acuity,
+			"priority":     booking.Priority,
+			"triaged_at":   now,
+			"escalated_at": nil,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "复评失败"})
+		return
+	}
+
+	publishQueue("queue.updated", booking)
+	c.JSON(http.StatusOK, gin.H{"msg": "复评完成", "data": booking, "triage": record})
+}
+
+// GetTriageHistory 挂号单的分诊/复评记录
+// GET /triage/:id
+func GetTriageHistory(c *gin.Context) {
+	var records []model.TriageRecord
+	database.Scoped(c).Where("booking_id = ?", c.Param("id")).Order("created_at asc").Find(&records)
+	c.JSON(http.StatusOK, gin.H{"data": records})
+}
+
+// GetOverdueTriage 候诊超时的分诊患者
+// GET /triage/overdue
+func GetOverdueTriage(c *gin.Context) {
+	bookings, err := overdueBookings(database.Scoped(c), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	if !can(c, "patient.all") {
+		own := []model.Booking{}
+		for _, b := range bookings {
+			if b.DoctorID == c.GetUint("user_id") {
+				own = append(own, b)
+			}
+		}
+		bookings = own
+	}
+	c.JSON(http.StatusOK, gin.H{"data": bookings})
+}
+
+// RunTriageMonitor 定时检查候诊超时，向医生和挂号台推送提醒
+// 同一患者在每个时限周期内只提醒一次 (至少间隔 5 分钟)
+func RunTriageMonitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		bookings, err := overdueBookings(database.DB, now)
+		if err != nil {
+			log.Printf("分诊超时检查失败: %v", err)
+			continue
+		}
+		for _, b := range bookings {
+			repeat := maxWait(b.Acuity)
+			if repeat < 5*time.Minute {
+				repeat = 5 * time.Minute
+			}
+			if b.EscalatedAt != nil && now.Sub(*b.EscalatedAt) < repeat {
+				continue
+			}
+
+			database.DB.Model(&b).Update("escalated_at", now)
+			b.EscalatedAt = &now
+			events.Publish(events.Event{
+				Type:        "triage.overdue",
+				OrgID:       b.OrgID,
+				Permissions: []string{"triage.manage"},
+				Department:  b.Department,
+				DoctorID:    b.DoctorID,
+				Data:        gin.H{"booking": b, "waited_minutes": int(now.Sub(*b.TriagedAt).Minutes())},
+			})
+		}
+	}
+}
+
+// overdueBookings 已分诊、尚未叫号且候诊超过该级别时限的挂号单
+// 接口传 Scoped(c) 只查本机构；定时检查传 DB 查全部机构 (推送时按 OrgID 分发)
+func overdueBookings(db *gorm.DB, now time.Time) ([]model.Booking, error) {
+	var bookings []model.Booking
+	err := db.Where("status = ? AND queue_state = ? AND acuity > 0 AND triaged_at IS NOT NULL", "Pending", "Waiting").
+		Order(queueOrder).Find(&bookings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := []model.Booking{}
+	for _, b := range bookings {
+		if now.Sub(*b.TriagedAt) >= maxWait(b.Acuity) {
+			overdue = append(overdue, b)
+		}
+	}
+	return overdue, nil
+}
+
+// maxWait 分级对应的最长候诊时间
+func maxWait(level int) time.Duration {
+	limits := config.AppConfig.Triage.MaxWaitMinutes
+	if len(limits) < 5 {
+		limits = defaultMaxWait
+	}
+	if level < 1 || level > 5 {
+		return time.Duration(limits[4]) * time.Minute
+	}
+	return time.Duration(limits[level-1]) * time.Minute
+}
+
+// triagePriority 1、2 级标记为急诊优先；降级时撤销急诊标记
+func triagePriority(level int, current string) string {
+	if level <= 2 {
+		return "emergency"
+	}
+	if current == "emergency" {
+		return ""
+	}
+	return current
+}
@@ -0,0 +1,308 @@
+// Package authz 权限点目录与角色权限判断
+// 权限点在代码中定义 (路由和业务逻辑引用它们)，角色 = 一组权限点，保存在数据库中，可在管理后台修改
+package authz
+
+import (
+	"hospital-system/internal/model"
+	"log"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// SuperRole 超级管理员拥有全部权限，且不能被修改，防止误操作把所有人锁在门外
+const SuperRole = "global_admin"
+
+// Permission 权限点
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Catalog 全部权限点
+// 带 .own / .assigned / .all 后缀的是数据范围：own 为本人作为患者的数据，assigned 为本人接诊的患者，all 为全部
+var Catalog = []Permission{
+	{"booking.read.own", "查看本人的挂号"},
+	{"booking.read.all", "查看全部挂号"},
+	{"booking.create", "挂号 (没有 booking.manage 时只能给自己挂号)"},
+	{"booking.cancel", "退号、复诊签到 (没有 booking.manage 时只限本人)"},
+	{"booking.manage", "挂号窗口：代他人挂号、指定优先标志、处理任何人的挂号单"},
+	{"queue.manage", "候诊队列：过号重排、调整优先级"},
+	{"triage.manage", "急诊分诊与复评"},
+	{"display.manage", "叫号屏管理"},
+
+	{"payment.read.own", "查看本人的缴费单"},
+	{"payment.read.all", "查看全部缴费单"},
+	{"payment.pay.own", "为本人的订单缴费"},
+	{"payment.collect", "收费窗口：为任意订单收费"},
+	{"deposit.read", "查看预交金账户与对账单"},
+	{"deposit.manage", "预交金缴存与退款"},
+	{"finance.report", "财务统计报表"},
+
+	{"patient.all", "处理任意医生的患者 (没有该权限时只限本人接诊的患者)"},
+	{"consult.queue", "医生工作台：候诊列表、叫号、过号"},
+	{"record.read.own", "查看本人的病历"},
+	{"record.read.assigned", "查看本人接诊的病历"},
+	{"record.read.all", "查看全部病历"},
+	{"record.write", "书写、签署、修订病历，上传附件"},
+	{"lab.order", "开检验单、查看并确认检验结果"},
+	{"referral.manage", "转诊"},
+	{"followup.read", "复诊 / 爽约报表"},
+	{"icd.read", "检索 ICD-10 编码"},
+	{"icd.import", "导入 ICD-10 编码"},
+	{"fhir.read", "FHIR 接口读取"},
+	{"fhir.import", "FHIR 患者导入"},
+
+	{"inventory.read", "查看药品物资库存"},
+	{"inventory.adjust", "药品物资入库、修改、删除"},
+	{"lab.catalog.read", "查看检验项目"},
+	{"lab.catalog.manage", "维护检验项目"},
+	{"lab.process", "检验科工作台：采样、录入结果"},
+
+	{"inpatient.read", "查看病区、床位和住院记录"},
+	{"inpatient.manage", "入院、转床、出院、床位状态"},
+	{"inpatient.order", "住院医嘱"},
+	{"ward.configure", "病区与床位配置"},
+
+	{"user.manage", "用户管理 (创建、修改、删除、重置密码、解锁)"},
+	{"org.all", "跨机构查看和操作所有机构的数据"},
+	{"org.manage", "机构管理"},
+	{"role.manage", "角色与权限管理"},
+	{"security.audit", "查看安全审计日志"},
+}
+
+// DefaultRole 内置角色及默认权限
+type DefaultRole struct {
+	Name        string
+	Label       string
+	Permissions []string
+}
+
+// DefaultRoles 与改造前 RoleMiddleware 的授权范围一致
+var DefaultRoles = []DefaultRole{
+	{"general_user", "患者", []string{
+		"booking.read.own", "booking.create", "booking.cancel",
+		"payment.read.own", "payment.pay.own", "record.read.own",
+	}},
+	{"registration", "挂号员", []string{
+		"booking.read.all", "booking.create", "booking.cancel", "booking.manage", "queue.manage", "triage.manage",
+		"payment.read.all", "payment.collect", "deposit.read", "deposit.manage",
+		"patient.all", "record.read.all", "inpatient.read", "inpatient.manage",
+	}},
+	{"finance", "财务", []string{
+		"payment.read.all", "payment.collect", "deposit.read", "deposit.manage", "finance.report",
+		"patient.all", "record.read.all", "icd.read", "inpatient.read",
+	}},
+	{"doctor", "医生", []string{
+		"triage.manage", "consult.queue", "record.read.assigned", "record.write", "lab.order", "referral.manage",
+		"followup.read", "icd.read", "fhir.read", "inventory.read", "lab.catalog.read",
+		"inpatient.read", "inpatient.manage", "inpatient.order",
+	}},
+	{"storekeeper", "库管", []string{"inventory.read", "inventory.adjust"}},
+	{"lab", "检验科", []string{"lab.catalog.read", "lab.process"}},
+	{"org_admin", "院区管理员", allExcept("role.manage", "security.audit", "org.all", "org.manage")},
+	{SuperRole, "全局管理员", nil}, // 拥有全部权限，见 Has
+}
+
+func allExcept(excluded ...string) []string {
+	skip := map[string]bool{}
+	for _, p := range excluded {
+		skip[p] = true
+	}
+	var perms []string
+	for _, p := range Catalog {
+		if !skip[p.Name] {
+			perms = append(perms, p.Name)
+		}
+	}
+	return perms
+}
+
+// Known 是否为已定义的权限点
+func Known(name string) bool {
+	for _, p := range Catalog {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults 内置角色的默认权限，非内置角色返回 false
+func Defaults(role string) ([]string, bool) {
+	for _, r := range DefaultRoles {
+		if r.Name == role {
+			return r.Permissions, true
+		}
+	}
+	return nil, false
+}
+
+// --- 权限缓存 ---
+// 每个请求都要判断权限，角色表很小，整体缓存在内存中；角色被修改时调用 Invalidate
+
+var (
+	db      *gorm.DB
+	mu      sync.RWMutex
+	cache   map[string]map[string]bool
+	loadErr error
+)
+
+// Init 同步内置角色并设置数据源
+// 内置角色未被管理员改过时，每次启动都按代码中的默认权限覆盖，新版本新增的权限点随升级生效
+func Init(conn *gorm.DB) error {
+	db = conn
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		for _, def := range DefaultRoles {
+			var role model.Role
+			tx.Where("name = ?", def.Name).FirstOrInit(&role, model.Role{Name: def.Name})
+			if role.ID != 0 && role.Customized {
+				continue
+			}
+			role.Label, role.Builtin = def.Label, true
+			if err := tx.Save(&role).Error; err != nil {
+				return err
+			}
+			if err := SetPermissions(tx, def.Name, def.Permissions); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	Invalidate()
+	return err
+}
+
+// SetPermissions 覆盖角色的权限点 (调用方负责校验和 Invalidate)
+func SetPermissions(tx *gorm.DB, role string, perms []string) error {
+	if err := tx.Where("role = ?", role).Delete(&model.RolePermission{}).Error; err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, p := range perms {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if err := tx.Create(&model.RolePermission{Role: role, Permission: p}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidate 角色权限变更后清空缓存，下一个请求重新加载
+func Invalidate() {
+	mu.Lock()
+	cache = nil
+	mu.Unlock()
+}
+
+func load() map[string]map[string]bool {
+	mu.RLock()
+	c := cache
+	mu.RUnlock()
+	if c != nil {
+		return c
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cache != nil {
+		return cache
+	}
+	var rows []model.RolePermission
+	if err := db.Find(&rows).Error; err != nil {
+		// 读库失败时不缓存，本次按无权限处理
+		if loadErr == nil {
+			log.Printf("加载角色权限失败: %v", err)
+		}
+		loadErr = err
+		return map[string]map[string]bool{}
+	}
+	loadErr = nil
+	cache = map[string]map[string]bool{}
+	for _, r := range rows {
+		if cache[r.Role] == nil {
+			cache[r.Role] = map[string]bool{}
+		}
+		cache[r.Role][r.Permission] = true
+	}
+	return cache
+}
+
+// Has 角色是否拥有权限点 (未定义的角色没有任何权限)
+func Has(role, perm string) bool {
+	if role == SuperRole {
+		return true
+	}
+	return load()[role][perm]
+}
+
+// HasAny 拥有其中任一权限点
+func HasAny(role string, perms ...string) bool {
+	for _, p := range perms {
+		if Has(role, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- 角色授予 ---
+
+// AdminPermissions 管理类权限点：拥有其中任一项的角色视为管理员角色，授予时需另一位管理员审批
+var AdminPermissions = []string{"user.manage", "role.manage", "org.manage", "org.all"}
+
+// Exists 角色是否已定义
+func Exists(role string) bool {
+	if role == "" {
+		return false
+	}
+	var count int64
+	db.Model(&model.Role{}).Where("name = ?", role).Count(&count)
+	return count > 0
+}
+
+// Privileged 是否为管理员角色
+func Privileged(role string) bool {
+	return HasAny(role, AdminPermissions...)
+}
+
+// CanGrant granter 角色能否把 role 授予 (或收回) 他人：
+//   - 全局管理员角色只能由全局管理员授予
+//   - 不能授予超出自己权限的角色
+//   - 管理员角色只能由权限严格多于它的角色授予 (院区管理员不能任命院区管理员)
+func CanGrant(granter, role string) bool {
+	if role == SuperRole || granter == SuperRole {
+		return granter == SuperRole
+	}
+	roles := load()
+	have, granted := roles[granter], roles[role]
+	for p := range granted {
+		if !have[p] {
+			return false
+		}
+	}
+	if Privileged(role) {
+		return len(have) > len(granted)
+	}
+	return true
+}
+
+// PermissionsOf 角色的全部权限点 (排序后)
+func PermissionsOf(role string) []string {
+	var perms []string
+	if role == SuperRole {
+		for _, p := range Catalog {
+			perms = append(perms, p.Name)
+		}
+	} else {
+		for p := range load()[role] {
+			perms = append(perms, p)
+		}
+	}
+	sort.Strings(perms)
+	return perms
+}
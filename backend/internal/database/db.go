@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
@@ -21,7 +22,8 @@ func InitDB(dbPath string) {
 
 	// 2. 连接数据库
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	// busy_timeout: 并发写入 (如同时缴费) 时等待锁而不是直接报错
+	DB, err = gorm.Open(sqlite.Open(dbPath+"?_pragma=busy_timeout(5000)"), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("无法连接数据库: %v", err)
 	}
@@ -29,18 +31,205 @@ func InitDB(dbPath string) {
 	// 3. 开启 WAL 模式，提升并发性能
 	DB.Exec("PRAGMA journal_mode=WAL;")
 
+	// 3.1 多机构数据隔离 (见 tenant.go)
+	if err := registerTenantCallbacks(DB); err != nil {
+		log.Fatalf("注册机构隔离回调失败: %v", err)
+	}
+
 	// 4. 自动迁移表结构 (自动在 SQLite 里建表)
-	err = DB.AutoMigrate(
+	models := []interface{}{
+		&model.Organization{},
 		&model.User{},
 		&model.InventoryItem{},
 		&model.Patient{},
 		&model.Booking{},
 		&model.MedicalRecord{},
 		&model.Order{},
-	)
-	if err != nil {
+		&model.ICD10Code{},
+		&model.MedicalRecordDiagnosis{},
+		&model.MedicalRecordVersion{},
+		&model.Attachment{},
+		&model.LabTest{},
+		&model.LabOrder{},
+		&model.DisplayScreen{},
+		&model.TriageRecord{},
+		&model.Ward{},
+		&model.Bed{},
+		&model.Admission{},
+		&model.BedTransfer{},
+		&model.InpatientCharge{},
+		&model.DepositAccount{},
+		&model.DepositEntry{},
+		&model.Referral{},
+		&model.FollowUp{},
+		&model.Session{},
+		&model.SecurityEvent{},
+		&model.LoginThrottle{},
+		&model.TOTPCredential{},
+		&model.RecoveryCode{},
+		&model.Role{},
+		&model.RolePermission{},
+		&model.RoleGrant{},
+	}
+	// 病区名称改为机构内唯一，先删除旧的全局唯一索引
+	if DB.Migrator().HasIndex(&model.Ward{}, "idx_wards_name") {
+		DB.Migrator().DropIndex(&model.Ward{}, "idx_wards_name")
+	}
+	if err = DB.AutoMigrate(models...); err != nil {
 		log.Printf("自动迁移失败: %v", err)
 	}
+	DB.Where(model.Organization{ID: model.DefaultOrgID}).Attrs(model.Organization{Name: "总院"}).FirstOrCreate(&model.Organization{})
+
+	// 5. 启用多机构隔离前的旧数据归入默认机构
+	// 下面的保护触发器会拒绝对已签署病历、版本快照和预交金流水的 UPDATE (整条语句回滚)，
+	// 先删除，迁移完成后再按最新定义重建
+	dropTriggers(signedRecordTriggers, depositLedgerTriggers, securityEventTriggers)
+	if err := registerTenantTables(models...); err != nil {
+		log.Fatalf("旧数据归入默认机构失败: %v", err)
+	}
+
+	// 6. 数据库层约束：已签署病历只能追加版本，不能原地篡改或删除
+	for _, stmt := range signedRecordTriggers {
+		if err := DB.Exec(stmt).Error; err != nil {
+			log.Printf("创建病历保护触发器失败: %v", err)
+		}
+	}
+
+	// 6.1 预交金流水只追加，余额不能为负
+	for _, stmt := range depositLedgerTriggers {
+		if err := DB.Exec(stmt).Error; err != nil {
+			log.Printf("创建预交金保护触发器失败: %v", err)
+		}
+	}
+
+	// 6.2 安全事件日志只追加
+	for _, stmt := range securityEventTriggers {
+		if err := DB.Exec(stmt).Error; err != nil {
+			log.Printf("创建安全日志保护触发器失败: %v", err)
+		}
+	}
+
+	// 6.3 同一住院同一天只有一条床位费 (并发计费的兜底)
+	if err := DB.Exec(bedChargeDayIndex).Error; err != nil {
+		log.Printf("创建床位费唯一索引失败 (请先清理重复计费的床位费): %v", err)
+	}
+
+	// 7. 历史挂号单只有姓名，补齐患者档案关联
+	backfillBookingPatients()
 
 	log.Println("数据库初始化成功，WAL模式已开启")
 }
+
+var triggerName = regexp.MustCompile(`CREATE TRIGGER IF NOT EXISTS (\w+)`)
+
+// dropTriggers 删除一组触发器 (数据迁移期间临时解除保护)
+func dropTriggers(groups ...[]string) {
+	for _, group := range groups {
+		for _, stmt := range group {
+			if m := triggerName.FindStringSubmatch(stmt); m != nil {
+				if err := DB.Exec("DROP TRIGGER IF EXISTS " + m[1]).Error; err != nil {
+					log.Printf("删除触发器 %s 失败: %v", m[1], err)
+				}
+			}
+		}
+	}
+}
+
+// signedRecordTriggers 已签署病历的保护规则：
+//   - medical_records: 已签署后只允许版本号 +1 的修订更新，且对应版本快照必须已写入
+//   - medical_record_versions: 只追加，禁止修改和删除
+//   - medical_record_diagnoses: 已签署病历的诊断只能以新版本号追加
+var signedRecordTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS trg_signed_record_update
+	BEFORE UPDATE ON medical_records
+	WHEN OLD.status = 'Signed' AND (
+		NEW.status <> 'Signed'
+		OR NEW.version <> OLD.version + 1
+		OR NOT EXISTS (SELECT 1 FROM medical_record_versions v WHERE v.record_id = NEW.id AND v.version = NEW.version)
+	)
+	BEGIN SELECT RAISE(ABORT, 'signed medical record is immutable'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_signed_record_delete
+	BEFORE DELETE ON medical_records
+	WHEN OLD.status = 'Signed'
+	BEGIN SELECT RAISE(ABORT, 'signed medical record is immutable'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_record_version_update
+	BEFORE UPDATE ON medical_record_versions
+	BEGIN SELECT RAISE(ABORT, 'medical record versions are append-only'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_record_version_delete
+	BEFORE DELETE ON medical_record_versions
+	BEGIN SELECT RAISE(ABORT, 'medical record versions are append-only'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_signed_diagnosis_insert
+	BEFORE INSERT ON medical_record_diagnoses
+	WHEN EXISTS (SELECT 1 FROM medical_records r WHERE r.id = NEW.record_id AND r.status = 'Signed' AND NEW.record_version <= r.version)
+	BEGIN SELECT RAISE(ABORT, 'signed medical record is immutable'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_signed_diagnosis_update
+	BEFORE UPDATE ON medical_record_diagnoses
+	WHEN EXISTS (SELECT 1 FROM medical_records r WHERE r.id = OLD.record_id AND r.status = 'Signed')
+	BEGIN SELECT RAISE(ABORT, 'signed medical record is immutable'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_signed_diagnosis_delete
+	BEFORE DELETE ON medical_record_diagnoses
+	WHEN EXISTS (SELECT 1 FROM medical_records r WHERE r.id = OLD.record_id AND r.status = 'Signed')
+	BEGIN SELECT RAISE(ABORT, 'signed medical record is immutable'); END;`,
+}
+
+// depositLedgerTriggers 预交金账本的保护规则：
+//   - deposit_entries: 只追加，禁止修改和删除 (冲正请追加一笔反向流水)
+//   - deposit_accounts: 余额不能为负，账户不能删除
+var depositLedgerTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS trg_deposit_entry_update
+	BEFORE UPDATE ON deposit_entries
+	BEGIN SELECT RAISE(ABORT, 'deposit ledger is append-only'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_deposit_entry_delete
+	BEFORE DELETE ON deposit_entries
+	BEGIN SELECT RAISE(ABORT, 'deposit ledger is append-only'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_deposit_balance_negative
+	BEFORE UPDATE ON deposit_accounts
+	WHEN NEW.balance < 0
+	BEGIN SELECT RAISE(ABORT, 'deposit balance cannot be negative'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_deposit_account_delete
+	BEFORE DELETE ON deposit_accounts
+	BEGIN SELECT RAISE(ABORT, 'deposit accounts cannot be deleted'); END;`,
+}
+
+// bedChargeDayIndex 床位费按 住院 + 日期 唯一；药品费同一天可以有多条，不受限制
+const bedChargeDayIndex = `CREATE UNIQUE INDEX IF NOT EXISTS idx_bed_charge_day
+	ON inpatient_charges (admission_id, type, charge_date) WHERE type = 'bed'`
+
+// securityEventTriggers 安全事件日志只追加，禁止修改和删除
+var securityEventTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS trg_security_event_update
+	BEFORE UPDATE ON security_events
+	BEGIN SELECT RAISE(ABORT, 'security events are append-only'); END;`,
+
+	`CREATE TRIGGER IF NOT EXISTS trg_security_event_delete
+	BEFORE DELETE ON security_events
+	BEGIN SELECT RAISE(ABORT, 'security events are append-only'); END;`,
+}
+
+// backfillBookingPatients 为 patient_id 为空的挂号单关联 (或新建) 本机构的患者档案
+// 旧挂号单只有姓名、性别和年龄，同名且性别年龄一致才归并，其余新建并标记待核对 (见 model.MatchPatient)
+func backfillBookingPatients() {
+	var bookings []model.Booking
+	DB.Where("patient_id = 0 OR patient_id IS NULL").Order("id asc").Find(&bookings)
+	for _, b := range bookings {
+		patient, err := model.FindOrCreatePatient(ForOrg(b.OrgID), model.PatientInfo{
+			Name:      b.PatientName,
+			Gender:    b.Gender,
+			BirthYear: model.BirthYearOf(b.Age, b.CreatedAt),
+		})
+		if err != nil {
+			log.Printf("挂号单 %d 关联患者失败: %v", b.ID, err)
+			continue
+		}
+		DB.Model(&model.Booking{}).Where("id = ?", b.ID).Update("patient_id", patient.ID)
+	}
+}
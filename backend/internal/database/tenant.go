@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"hospital-system/internal/model"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- 多机构数据隔离 ---
+// 带 OrgID 字段的表都是机构数据。请求上下文里带有 Tenant 时 (见 middleware.authenticate)，
+// 通过 GORM 回调自动给查询、更新、删除加上 org_id 条件，新建数据自动写入当前机构。
+// 处理函数只要用 Scoped(c) 代替 DB 即可；不带 Tenant 的上下文 (登录、后台任务) 不做过滤。
+
+// TenantKey 上下文中 Tenant 的键 (gin.Context.Set 同一个键即可被 GORM 读到)
+const TenantKey = "tenant"
+
+// Tenant 当前请求的数据范围
+type Tenant struct {
+	OrgID   uint // 读写的机构；AllOrgs 时为新建数据的默认归属
+	AllOrgs bool // 跨机构视图 (全局管理员)：查询不加过滤
+}
+
+// tenantTables 带 org_id 列的表，InitDB 迁移时登记
+var tenantTables = map[string]bool{}
+
+// IsTenantTable 表是否按机构隔离
+func IsTenantTable(table string) bool {
+	return tenantTables[table]
+}
+
+// Scoped 绑定请求上下文的数据库句柄 (事务、子查询沿用同一上下文)
+func Scoped(ctx context.Context) *gorm.DB {
+	return DB.WithContext(ctx)
+}
+
+// ForOrg 后台任务等没有登录上下文时，限定在某个机构内读写
+func ForOrg(orgID uint) *gorm.DB {
+	return DB.WithContext(context.WithValue(context.Background(), TenantKey, Tenant{OrgID: orgID}))
+}
+
+// registerTenantTables 登记带 OrgID 字段的模型，并把迁移前的旧数据归入默认机构
+// (org_id 为空的行对所有限定机构的用户都不可见，迁移失败必须报错)
+func registerTenantTables(models ...interface{}) error {
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(m); err != nil || stmt.Schema.LookUpField("OrgID") == nil {
+			continue
+		}
+		tenantTables[stmt.Schema.Table] = true
+		err := DB.Table(stmt.Schema.Table).Where("org_id IS NULL OR org_id = 0").Update("org_id", model.DefaultOrgID).Error
+		if err != nil {
+			return fmt.Errorf("%s: %w", stmt.Schema.Table, err)
+		}
+	}
+	return nil
+}
+
+func registerTenantCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:row", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:update", func(db *gorm.DB) {
+		stampTenant(db, false)
+		scopeTenant(db)
+	}); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:delete", scopeTenant); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("tenant:create", func(db *gorm.DB) {
+		stampTenant(db, true)
+	})
+}
+
+// tenantOf 取语句上下文中的 Tenant，仅对机构数据表生效
+func tenantOf(db *gorm.DB) (Tenant, bool) {
+	if db.Statement.Context == nil || !tenantTables[db.Statement.Table] {
+		return Tenant{}, false
+	}
+	t, ok := db.Statement.Context.Value(TenantKey).(Tenant)
+	return t, ok
+}
+
+func orgColumn(table string) clause.Column {
+	return clause.Column{Table: table, Name: "org_id"}
+}
+
+// scopeTenant 追加 org_id 条件
+// 已有条件整体加括号后再 AND，避免 a OR b AND org_id = ? 的优先级问题
+func scopeTenant(db *gorm.DB) {
+	t, ok := tenantOf(db)
+	if !ok || t.AllOrgs {
+		return
+	}
+	stmt := db.Statement
+	cond := clause.Eq{Column: orgColumn(stmt.Table), Value: t.OrgID}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			where.Exprs = []clause.Expression{clause.And(where.Exprs...), cond}
+			c.Expression = where
+			stmt.Clauses["WHERE"] = c
+			return
+		}
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{cond}})
+}
+
+// stampTenant 新建 / 整体保存时写入机构：
+// 限定机构时强制为当前机构 (不信任请求体里的 org_id)；跨机构视图下只给新建数据补齐未指定的
+// (跨机构视图下的当前机构只是管理员自己的机构，挂在某张挂号单、某个患者下的数据要由调用方填写其 OrgID)
+func stampTenant(db *gorm.DB, creating bool) {
+	t, ok := tenantOf(db)
+	if !ok || db.Statement.Schema == nil || (t.AllOrgs && !creating) {
+		return
+	}
+	stmt := db.Statement
+	field := stmt.Schema.LookUpField("OrgID")
+	if field == nil {
+		return
+	}
+
+	set := func(rv reflect.Value) {
+		if rv.Kind() != reflect.Struct || !rv.CanAddr() {
+			return
+		}
+		if _, zero := field.ValueOf(stmt.Context, rv); zero || !t.AllOrgs {
+			field.Set(stmt.Context, rv, t.OrgID)
+		}
+	}
+	switch rv := stmt.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+
+	// Save 在更新不到行时会改用 INSERT ... ON CONFLICT DO UPDATE，限定只能覆盖本机构的行
+	if c, ok := stmt.Clauses["ON CONFLICT"]; ok && !t.AllOrgs {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs, clause.Eq{Column: orgColumn(stmt.Table), Value: t.OrgID})
+			c.Expression = onConflict
+			stmt.Clauses["ON CONFLICT"] = c
+		}
+	}
+}
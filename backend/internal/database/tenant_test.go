@@ -0,0 +1,296 @@
+package database
+
+import (
+	"errors"
+	"hospital-system/internal/model"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 两个机构各一套数据，验证机构 A 的上下文读不到、改不了、删不掉机构 B 的数据
+
+const orgA, orgB = model.DefaultOrgID, 2
+
+type tenantFixture struct {
+	booking model.Booking
+	record  model.MedicalRecord
+	order   model.Order
+	user    model.User
+	entry   model.DepositEntry
+}
+
+var fixtures = map[uint]*tenantFixture{}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "tenant-test")
+	if err != nil {
+		panic(err)
+	}
+	InitDB(filepath.Join(dir, "test.db"))
+	DB.Logger = logger.Default.LogMode(logger.Silent) // 越权查询本来就查不到，不打印 record not found
+	if err := DB.Create(&model.Organization{ID: orgB, Name: "分院"}).Error; err != nil {
+		panic(err)
+	}
+	for _, org := range []uint{orgA, orgB} {
+		fixtures[org] = seedOrg(org)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func seedOrg(org uint) *tenantFixture {
+	db := ForOrg(org)
+	name := map[uint]string{orgA: "a", orgB: "b"}[org]
+	f := &tenantFixture{
+		user:    model.User{Username: "doctor_" + name, Password: "x", Role: "doctor"},
+		booking: model.Booking{PatientName: "patient_" + name, Department: "内科", Status: "Pending"},
+		order:   model.Order{TotalAmount: 10, Status: "Unpaid"},
+		entry:   model.DepositEntry{AccountID: org, Amount: 100},
+	}
+	must(db.Create(&f.user).Error)
+	f.booking.DoctorID = f.user.ID
+	must(db.Create(&f.booking).Error)
+	f.record = model.MedicalRecord{BookingID: f.booking.ID, DoctorID: f.user.ID, Diagnosis: "diag_" + name}
+	must(db.Create(&f.record).Error)
+	f.order.BookingID = f.booking.ID
+	must(db.Create(&f.order).Error)
+	must(db.Create(&f.entry).Error)
+	return f
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ginContext 模拟 middleware.authenticate 写入 Tenant 后的请求上下文
+func ginContext(t Tenant) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Set(TenantKey, t)
+	return c
+}
+
+func TestCreateStampsTenant(t *testing.T) {
+	for org, f := range fixtures {
+		for name, got := range map[string]uint{
+			"booking": f.booking.OrgID, "record": f.record.OrgID, "order": f.order.OrgID,
+			"user": f.user.OrgID, "deposit entry": f.entry.OrgID,
+		} {
+			if got != org {
+				t.Errorf("%s created for org %d has org_id %d", name, org, got)
+			}
+		}
+	}
+
+	// 请求体里伪造的 org_id 被当前机构覆盖
+	forged := model.Booking{OrgID: orgB, PatientName: "forged"}
+	if err := Scoped(ginContext(Tenant{OrgID: orgA})).Create(&forged).Error; err != nil {
+		t.Fatal(err)
+	}
+	var stored model.Booking
+	DB.First(&stored, forged.ID)
+	if stored.OrgID != orgA {
+		t.Errorf("forged org_id stored as %d, want %d", stored.OrgID, orgA)
+	}
+	DB.Delete(&stored)
+}
+
+func TestCannotReadOtherOrg(t *testing.T) {
+	a, b := fixtures[orgA], fixtures[orgB]
+	for name, db := range map[string]*gorm.DB{
+		"Scoped": Scoped(ginContext(Tenant{OrgID: orgA})),
+		"ForOrg": ForOrg(orgA),
+	} {
+		t.Run(name, func(t *testing.T) {
+			checks := []struct {
+				name     string
+				dest     interface{}
+				idA, idB uint
+			}{
+				{"bookings", &model.Booking{}, a.booking.ID, b.booking.ID},
+				{"medical records", &model.MedicalRecord{}, a.record.ID, b.record.ID},
+				{"orders", &model.Order{}, a.order.ID, b.order.ID},
+				{"users", &model.User{}, a.user.ID, b.user.ID},
+				{"deposit entries", &model.DepositEntry{}, a.entry.ID, b.entry.ID},
+			}
+			for _, ck := range checks {
+				if err := db.First(ck.dest, ck.idB).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+					t.Errorf("%s: org A read org B row (err=%v)", ck.name, err)
+				}
+				if err := db.First(ck.dest, ck.idA).Error; err != nil {
+					t.Errorf("%s: org A cannot read its own row: %v", ck.name, err)
+				}
+				// OR 条件不能绕过机构过滤
+				var count int64
+				db.Model(ck.dest).Where("id = ? OR 1 = 1", ck.idB).Count(&count)
+				if count != 1 {
+					t.Errorf("%s: org A sees %d rows, want 1", ck.name, count)
+				}
+			}
+
+			// 联表查询按主表过滤
+			var names []string
+			db.Model(&model.MedicalRecord{}).
+				Joins("JOIN bookings ON bookings.id = medical_records.booking_id").
+				Pluck("bookings.patient_name", &names)
+			if len(names) != 1 || names[0] != a.booking.PatientName {
+				t.Errorf("joined records = %v, want only %s", names, a.booking.PatientName)
+			}
+		})
+	}
+}
+
+func TestCannotUpdateOrDeleteOtherOrg(t *testing.T) {
+	db := Scoped(ginContext(Tenant{OrgID: orgA}))
+	b := fixtures[orgB]
+
+	if n := db.Model(&model.Booking{}).Where("id = ?", b.booking.ID).Update("status", "Cancelled").RowsAffected; n != 0 {
+		t.Errorf("booking update affected %d rows", n)
+	}
+	if n := db.Model(&model.MedicalRecord{}).Where("id = ? OR 1 = 1", b.record.ID).Update("diagnosis", "tampered").RowsAffected; n != 1 {
+		t.Errorf("record update affected %d rows, want only org A's", n)
+	}
+	if n := db.Model(&model.Order{}).Where("id = ?", b.order.ID).Updates(map[string]interface{}{"status": "Paid"}).RowsAffected; n != 0 {
+		t.Errorf("order update affected %d rows", n)
+	}
+	if n := db.Model(&model.User{}).Where("id = ?", b.user.ID).Update("role", "global_admin").RowsAffected; n != 0 {
+		t.Errorf("user update affected %d rows", n)
+	}
+
+	if n := db.Delete(&model.Booking{}, b.booking.ID).RowsAffected; n != 0 {
+		t.Errorf("booking delete affected %d rows", n)
+	}
+	if n := db.Where("id = ?", b.order.ID).Delete(&model.Order{}).RowsAffected; n != 0 {
+		t.Errorf("order delete affected %d rows", n)
+	}
+	if n := db.Delete(&model.User{}, b.user.ID).RowsAffected; n != 0 {
+		t.Errorf("user delete affected %d rows", n)
+	}
+	if n := db.Delete(&model.MedicalRecord{}, b.record.ID).RowsAffected; n != 0 {
+		t.Errorf("record delete affected %d rows", n)
+	}
+
+	assertUnchanged(t, b)
+	DB.Model(&model.MedicalRecord{}).Where("id = ?", fixtures[orgA].record.ID).Update("diagnosis", fixtures[orgA].record.Diagnosis)
+}
+
+// Save 先 UPDATE ... WHERE id AND org_id，更新不到行时改用 INSERT ... ON CONFLICT DO UPDATE，
+// 冲突更新同样只能覆盖本机构的行
+func TestSaveUpsertCannotOverwriteOtherOrg(t *testing.T) {
+	db := Scoped(ginContext(Tenant{OrgID: orgA}))
+	b := fixtures[orgB]
+
+	booking := b.booking
+	booking.PatientName = "hijacked"
+	db.Save(&booking)
+	record := b.record
+	record.Diagnosis = "hijacked"
+	db.Save(&record)
+	order := b.order
+	order.Status = "Paid"
+	db.Save(&order)
+	user := b.user
+	user.Role = "global_admin"
+	db.Omit("password").Save(&user)
+
+	assertUnchanged(t, b)
+}
+
+func TestAllOrgsView(t *testing.T) {
+	db := Scoped(ginContext(Tenant{OrgID: orgA, AllOrgs: true}))
+
+	var bookings []model.Booking
+	db.Find(&bookings)
+	if len(bookings) != 2 {
+		t.Fatalf("global admin sees %d bookings, want 2", len(bookings))
+	}
+	var entries int64
+	db.Model(&model.DepositEntry{}).Count(&entries)
+	if entries != 2 {
+		t.Errorf("global admin sees %d deposit entries, want 2", entries)
+	}
+
+	// 跨机构修改保留数据原有的机构
+	record := fixtures[orgB].record
+	record.Diagnosis = "reviewed"
+	if err := db.Save(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	var stored model.MedicalRecord
+	DB.First(&stored, record.ID)
+	if stored.Diagnosis != "reviewed" || stored.OrgID != orgB {
+		t.Errorf("global admin save: diagnosis=%q org=%d", stored.Diagnosis, stored.OrgID)
+	}
+	DB.Model(&stored).Update("diagnosis", fixtures[orgB].record.Diagnosis)
+
+	// 切换到指定机构 (?org_id=) 时与机构用户一致
+	var scoped int64
+	Scoped(ginContext(Tenant{OrgID: orgB})).Model(&model.Booking{}).Count(&scoped)
+	if scoped != 1 {
+		t.Errorf("org B view sees %d bookings, want 1", scoped)
+	}
+}
+
+// 跨机构视图下新建数据：指定了机构的 (处理函数按所属挂号单、患者填写) 保留，未指定的归入当前机构
+func TestAllOrgsCreate(t *testing.T) {
+	db := Scoped(ginContext(Tenant{OrgID: orgA, AllOrgs: true}))
+	b := fixtures[orgB]
+
+	child := model.Order{OrgID: b.booking.OrgID, BookingID: b.booking.ID, TotalAmount: 5, Status: "Unpaid"}
+	if err := db.Create(&child).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Delete(&child)
+	var stored model.Order
+	DB.First(&stored, child.ID)
+	if stored.OrgID != orgB {
+		t.Errorf("child of org B booking stored in org %d", stored.OrgID)
+	}
+	var count int64
+	Scoped(ginContext(Tenant{OrgID: orgB})).Model(&model.Order{}).Where("booking_id = ?", b.booking.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("org B sees %d orders for its booking, want 2", count)
+	}
+
+	// 批量新建逐行处理
+	referrals := []model.Referral{{OrgID: orgB, FromBookingID: b.booking.ID}, {FromBookingID: fixtures[orgA].booking.ID}}
+	if err := db.Create(&referrals).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Delete(&referrals)
+	if referrals[0].OrgID != orgB || referrals[1].OrgID != orgA {
+		t.Errorf("batch create org_ids = %d, %d, want %d, %d", referrals[0].OrgID, referrals[1].OrgID, orgB, orgA)
+	}
+}
+
+// assertUnchanged 机构 B 的数据与初始一致
+func assertUnchanged(t *testing.T, f *tenantFixture) {
+	t.Helper()
+	var booking model.Booking
+	var record model.MedicalRecord
+	var order model.Order
+	var user model.User
+	if err := DB.First(&booking, f.booking.ID).Error; err != nil || booking.Status != f.booking.Status ||
+		booking.PatientName != f.booking.PatientName || booking.OrgID != orgB {
+		t.Errorf("org B booking changed: %+v (err=%v)", booking, err)
+	}
+	if err := DB.First(&record, f.record.ID).Error; err != nil || record.Diagnosis != f.record.Diagnosis || record.OrgID != orgB {
+		t.Errorf("org B record changed: %+v (err=%v)", record, err)
+	}
+	if err := DB.First(&order, f.order.ID).Error; err != nil || order.Status != f.order.Status || order.OrgID != orgB {
+		t.Errorf("org B order changed: %+v (err=%v)", order, err)
+	}
+	if err := DB.First(&user, f.user.ID).Error; err != nil || user.Role != f.user.Role || user.OrgID != orgB {
+		t.Errorf("org B user changed: %+v (err=%v)", user, err)
+	}
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"hospital-system/internal/authz"
+	"sync"
+	"time"
+)
+
+// --- 进程内事件总线 ---
+// 业务模块发布事件，SSE 等推送通道订阅事件
+// 订阅者消费太慢时直接丢弃事件，不阻塞发布方
+
+// Event 一条业务事件
+type Event struct {
+	Type        string      `json:"type"` // 例如 booking.created, patient.called, order.paid, stock.low
+	Time        time.Time   `json:"time"`
+	OrgID       uint        `json:"org_id,omitempty"` // 所属机构，0 表示全院
+	Permissions []string    `json:"-"`                // 拥有其中任一权限点才能接收，为空表示所有人
+	Department  string      `json:"department,omitempty"`
+	DoctorID    uint        `json:"doctor_id,omitempty"`
+	Data        interface{} `json:"data"`
+}
+
+// VisibleTo 判断事件对某个登录用户是否可见
+// 只看本机构 (有 org.all 权限的看全部机构)、有相应权限的事件，接诊但不能处理他人患者的角色 (医生) 只看自己患者的事件
+func (e Event) VisibleTo(role string, userID, orgID uint) bool {
+	if e.OrgID != 0 && e.OrgID != orgID && !authz.Has(role, "org.all") {
+		return false
+	}
+	if len(e.Permissions) > 0 && !authz.HasAny(role, e.Permissions...) {
+		return false
+	}
+	if e.DoctorID != 0 && e.DoctorID != userID && authz.Has(role, "consult.queue") && !authz.Has(role, "patient.all") {
+		return false
+	}
+	return true
+}
+
+// Subscription 一个订阅者，从 C 中读取事件
+type Subscription struct {
+	C      chan Event
+	filter func(Event) bool
+}
+
+// Bus 事件总线
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe 订阅事件，filter 为空表示接收全部
+func (b *Bus) Subscribe(filter func(Event) bool) *Subscription {
+	sub := &Subscription{C: make(chan Event, 64), filter: filter}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe 取消订阅并关闭通道
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.C)
+	}
+	b.mu.Unlock()
+}
+
+// Publish 发布事件 (非阻塞)
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.C <- e:
+		default:
+		}
+	}
+}
+
+// Default 全局事件总线
+var Default = NewBus()
+
+func Publish(e Event) { Default.Publish(e) }
+
+func Subscribe(filter func(Event) bool) *Subscription { return Default.Subscribe(filter) }
+
+func Unsubscribe(sub *Subscription) { Default.Unsubscribe(sub) }
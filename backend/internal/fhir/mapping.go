@@ -0,0 +1,272 @@
+package fhir
+
+import (
+	"hospital-system/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 本系统数据 -> FHIR 资源的映射
+
+func ref(resourceType string, id uint) Reference {
+	return Reference{Reference: resourceType + "/" + strconv.FormatUint(uint64(id), 10)}
+}
+
+func idOf(id uint) string { return strconv.FormatUint(uint64(id), 10) }
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Gender 挂号单里的性别 -> FHIR administrative-gender
+func Gender(g string) string {
+	switch strings.ToLower(strings.TrimSpace(g)) {
+	case "男", "m", "male":
+		return "male"
+	case "女", "f", "female":
+		return "female"
+	case "":
+		return ""
+	}
+	return "other"
+}
+
+// FromPatient 患者档案 -> Patient
+func FromPatient(p model.Patient, gender string) Patient {
+	r := Patient{
+		ResourceType: "Patient",
+		ID:           idOf(p.ID),
+		Meta:         &Meta{LastUpdated: timePtr(p.CreatedAt)},
+		Name:         []HumanName{{Text: p.Name}},
+		Gender:       Gender(gender),
+	}
+	if p.IDCard != "" {
+		r.Identifier = []Identifier{{System: SystemIDCard, Value: p.IDCard}}
+	}
+	if p.Phone != "" {
+		r.Telecom = []ContactPoint{{System: "phone", Value: p.Phone}}
+	}
+	return r
+}
+
+// PatientFields 从 Patient 资源中取出姓名、身份证号、电话 (导入用)
+func PatientFields(p Patient) (name, idCard, phone string) {
+	for _, n := range p.Name {
+		if n.Text != "" {
+			name = n.Text
+			break
+		}
+	}
+	for _, id := range p.Identifier {
+		if id.System == SystemIDCard || idCard == "" {
+			idCard = id.Value
+		}
+	}
+	for _, t := range p.Telecom {
+		if t.System == "phone" {
+			phone = t.Value
+			break
+		}
+	}
+	return
+}
+
+// EncounterStatus 挂号状态 -> Encounter.status
+func EncounterStatus(status string) string {
+	switch status {
+	case "Completed":
+		return "finished"
+	case "Cancelled":
+		return "cancelled"
+	}
+	return "arrived"
+}
+
+// FromBooking 挂号单 -> Encounter (门诊)
+func FromBooking(b model.Booking, doctorName string) Encounter {
+	r := Encounter{
+		ResourceType: "Encounter",
+		ID:           idOf(b.ID),
+		Status:       EncounterStatus(b.Status),
+		Class:        Coding{System: "http://terminology.hl7.org/CodeSystem/v3-ActCode", Code: "AMB", Display: "ambulatory"},
+		Period:       &Period{Start: timePtr(b.CreatedAt)},
+	}
+	if b.Department != "" {
+		r.ServiceType = &CodeableConcept{Text: b.Department}
+	}
+	if b.PatientID != 0 {
+		s := ref("Patient", b.PatientID)
+		s.Display = b.PatientName
+		r.Subject = &s
+	}
+	if b.DoctorID != 0 {
+		d := ref("Practitioner", b.DoctorID)
+		d.Display = doctorName
+		r.Participant = []EncounterParticipant{{Individual: &d}}
+	}
+	return r
+}
+
+// FromDiagnosis 编码诊断 -> Condition
+func FromDiagnosis(d model.MedicalRecordDiagnosis, record model.MedicalRecord, b model.Booking) Condition {
+	r := Condition{
+		ResourceType: "Condition",
+		ID:           idOf(d.ID),
+		Category: []CodeableConcept{{Coding: []Coding{{
+			System: "http://terminology.hl7.org/CodeSystem/condition-category", Code: "encounter-diagnosis",
+		}}}},
+		Code:         CodeableConcept{Coding: []Coding{{System: SystemICD10, Code: d.Code, Display: d.Description}}, Text: d.Description},
+		Subject:      ref("Patient", b.PatientID),
+		RecordedDate: timePtr(record.CreatedAt),
+	}
+	enc := ref("Encounter", b.ID)
+	r.Encounter = &enc
+	if record.DoctorID != 0 {
+		rec := ref("Practitioner", record.DoctorID)
+		r.Recorder = &rec
+	}
+	return r
+}
+
+// vitalCodes 生命体征对应的 LOINC 编码
+var vitalCodes = []struct {
+	loinc, display, unit string
+	value                func(v model.Vitals) float64
+}{
+	{"8480-6", "Systolic blood pressure", "mm[Hg]", func(v model.Vitals) float64 { return float64(v.SystolicBP) }},
+	{"8462-4", "Diastolic blood pressure", "mm[Hg]", func(v model.Vitals) float64 { return float64(v.DiastolicBP) }},
+	{"8867-4", "Heart rate", "/min", func(v model.Vitals) float64 { return float64(v.HeartRate) }},
+	{"8310-5", "Body temperature", "Cel", func(v model.Vitals) float64 { return v.Temperature }},
+	{"59408-5", "Oxygen saturation", "%", func(v model.Vitals) float64 { return float64(v.SpO2) }},
+	{"29463-7", "Body weight", "kg", func(v model.Vitals) float64 { return v.Weight }},
+}
+
+// VitalObservations 病历中的生命体征 -> Observation (未测量的项不输出)
+func VitalObservations(record model.MedicalRecord, b model.Booking) []Observation {
+	var out []Observation
+	for _, vc := range vitalCodes {
+		v := vc.value(record.Vitals)
+		if v == 0 {
+			continue
+		}
+		enc := ref("Encounter", b.ID)
+		out = append(out, Observation{
+			ResourceType: "Observation",
+			ID:           "vital-" + idOf(record.ID) + "-" + vc.loinc,
+			Status:       "final",
+			Category: []CodeableConcept{{Coding: []Coding{{
+				System: "http://terminology.hl7.org/CodeSystem/observation-category", Code: "vital-signs",
+			}}}},
+			Code:              CodeableConcept{Coding: []Coding{{System: SystemLOINC, Code: vc.loinc, Display: vc.display}}},
+			Subject:           ref("Patient", b.PatientID),
+			Encounter:         &enc,
+			EffectiveDateTime: timePtr(record.CreatedAt),
+			ValueQuantity:     &Quantity{Value: v, Unit: vc.unit, System: SystemUCUM, Code: vc.unit},
+		})
+	}
+	return out
+}
+
+// FromLabOrder 检验结果 -> Observation
+func FromLabOrder(l model.LabOrder, b model.Booking) Observation {
+	enc := ref("Encounter", b.ID)
+	r := Observation{
+		ResourceType: "Observation",
+		ID:           "lab-" + idOf(l.ID),
+		Status:       "final",
+		Category: []CodeableConcept{{Coding: []Coding{{
+			System: "http://terminology.hl7.org/CodeSystem/observation-category", Code: "laboratory",
+		}}}},
+		Code:      CodeableConcept{Coding: []Coding{{System: SystemLocal + ":lab-test", Code: l.TestCode, Display: l.TestName}}, Text: l.TestName},
+		Subject:   ref("Patient", b.PatientID),
+		Encounter: &enc,
+	}
+	if l.ResultedAt != nil {
+		r.EffectiveDateTime = l.ResultedAt
+	}
+	if v, err := strconv.ParseFloat(l.ResultValue, 64); err == nil {
+		r.ValueQuantity = &Quantity{Value: v, Unit: l.Unit}
+	} else {
+		r.ValueString = l.ResultValue
+	}
+	if l.Flag != "" {
+		r.Interpretation = []CodeableConcept{{Coding: []Coding{{
+			System: "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation", Code: l.Flag,
+		}}}}
+	}
+	if l.RefRange != "" {
+		r.ReferenceRange = []ReferenceRange{{Text: l.RefRange}}
+	}
+	return r
+}
+
+// FromMedicationOrder 药品订单 -> MedicationRequest
+func FromMedicationOrder(o model.Order, b model.Booking, medName string) MedicationRequest {
+	enc := ref("Encounter", b.ID)
+	status := "active"
+	if o.Status == "Paid" {
+		status = "completed"
+	}
+	r := MedicationRequest{
+		ResourceType: "MedicationRequest",
+		ID:           idOf(o.ID),
+		Status:       status,
+		Intent:       "order",
+		MedicationCodeableConcept: CodeableConcept{
+			Coding: []Coding{{System: SystemLocal + ":medicine", Code: idOf(o.MedicineID), Display: medName}},
+			Text:   medName,
+		},
+		Subject:         ref("Patient", b.PatientID),
+		Encounter:       &enc,
+		AuthoredOn:      timePtr(o.CreatedAt),
+		DispenseRequest: &DispenseRequest{Quantity: &Quantity{Value: float64(o.Quantity)}},
+	}
+	if b.DoctorID != 0 {
+		req := ref("Practitioner", b.DoctorID)
+		r.Requester = &req
+	}
+	return r
+}
+
+// FromOrder 缴费订单 -> ChargeItem
+func FromOrder(o model.Order, b model.Booking, label string) ChargeItem {
+	ctx := ref("Encounter", b.ID)
+	status := "billable"
+	if o.Status == "Paid" {
+		status = "billed"
+	}
+	return ChargeItem{
+		ResourceType:       "ChargeItem",
+		ID:                 idOf(o.ID),
+		Status:             status,
+		Code:               CodeableConcept{Text: label},
+		Subject:            ref("Patient", b.PatientID),
+		Context:            &ctx,
+		OccurrenceDateTime: timePtr(o.CreatedAt),
+		Quantity:           &Quantity{Value: float64(o.Quantity)},
+		PriceOverride:      &Money{Value: o.TotalAmount, Currency: "CNY"},
+	}
+}
+
+// InvoiceFromOrder 缴费订单 -> Invoice (一单一票)
+func InvoiceFromOrder(o model.Order, b model.Booking) Invoice {
+	status := "issued"
+	if o.Status == "Paid" {
+		status = "balanced"
+	}
+	subject := ref("Patient", b.PatientID)
+	item := ref("ChargeItem", o.ID)
+	return Invoice{
+		ResourceType: "Invoice",
+		ID:           idOf(o.ID),
+		Status:       status,
+		Subject:      &subject,
+		Date:         timePtr(o.CreatedAt),
+		LineItem:     []InvoiceLineItem{{ChargeItemReference: &item}},
+		TotalGross:   &Money{Value: o.TotalAmount, Currency: "CNY"},
+	}
+}
@@ -0,0 +1,219 @@
+// Package fhir 实现 FHIR R4 资源的最小子集，用于与区域卫生平台交换数据
+// 只包含本系统用得到的字段，不追求完整覆盖规范
+package fhir
+
+import "time"
+
+const (
+	ContentType = "application/fhir+json"
+
+	SystemIDCard = "urn:oid:2.16.156.10011.1.1" // 居民身份证号
+	SystemICD10  = "http://hl7.org/fhir/sid/icd-10"
+	SystemLOINC  = "http://loinc.org"
+	SystemUCUM   = "http://unitsofmeasure.org"
+	SystemLocal  = "urn:hospital-system" // 本系统内部编码 (检验项目、药品)
+)
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type HumanName struct {
+	Text string `json:"text,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Period struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+type Quantity struct {
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit,omitempty"`
+	System string  `json:"system,omitempty"`
+	Code   string  `json:"code,omitempty"`
+}
+
+type Money struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+}
+
+type Meta struct {
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+}
+
+type Patient struct {
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id,omitempty"`
+	Meta         *Meta          `json:"meta,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	Gender       string         `json:"gender,omitempty"`
+}
+
+type EncounterParticipant struct {
+	Individual *Reference `json:"individual,omitempty"`
+}
+
+type Encounter struct {
+	ResourceType string                 `json:"resourceType"`
+	ID           string                 `json:"id"`
+	Status       string                 `json:"status"`
+	Class        Coding                 `json:"class"`
+	ServiceType  *CodeableConcept       `json:"serviceType,omitempty"`
+	Subject      *Reference             `json:"subject,omitempty"`
+	Participant  []EncounterParticipant `json:"participant,omitempty"`
+	Period       *Period                `json:"period,omitempty"`
+}
+
+type Condition struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id"`
+	Category     []CodeableConcept `json:"category,omitempty"`
+	Code         CodeableConcept   `json:"code"`
+	Subject      Reference         `json:"subject"`
+	Encounter    *Reference        `json:"encounter,omitempty"`
+	RecordedDate *time.Time        `json:"recordedDate,omitempty"`
+	Recorder     *Reference        `json:"recorder,omitempty"`
+}
+
+type ReferenceRange struct {
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+	Text string    `json:"text,omitempty"`
+}
+
+type Observation struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id"`
+	Status            string            `json:"status"`
+	Category          []CodeableConcept `json:"category,omitempty"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           Reference         `json:"subject"`
+	Encounter         *Reference        `json:"encounter,omitempty"`
+	EffectiveDateTime *time.Time        `json:"effectiveDateTime,omitempty"`
+	ValueQuantity     *Quantity         `json:"valueQuantity,omitempty"`
+	ValueString       string            `json:"valueString,omitempty"`
+	Interpretation    []CodeableConcept `json:"interpretation,omitempty"`
+	ReferenceRange    []ReferenceRange  `json:"referenceRange,omitempty"`
+}
+
+type DispenseRequest struct {
+	Quantity *Quantity `json:"quantity,omitempty"`
+}
+
+type MedicationRequest struct {
+	ResourceType              string           `json:"resourceType"`
+	ID                        string           `json:"id"`
+	Status                    string           `json:"status"`
+	Intent                    string           `json:"intent"`
+	MedicationCodeableConcept CodeableConcept  `json:"medicationCodeableConcept"`
+	Subject                   Reference        `json:"subject"`
+	Encounter                 *Reference       `json:"encounter,omitempty"`
+	AuthoredOn                *time.Time       `json:"authoredOn,omitempty"`
+	Requester                 *Reference       `json:"requester,omitempty"`
+	DispenseRequest           *DispenseRequest `json:"dispenseRequest,omitempty"`
+}
+
+type ChargeItem struct {
+	ResourceType       string          `json:"resourceType"`
+	ID                 string          `json:"id"`
+	Status             string          `json:"status"`
+	Code               CodeableConcept `json:"code"`
+	Subject            Reference       `json:"subject"`
+	Context            *Reference      `json:"context,omitempty"`
+	OccurrenceDateTime *time.Time      `json:"occurrenceDateTime,omitempty"`
+	Quantity           *Quantity       `json:"quantity,omitempty"`
+	PriceOverride      *Money          `json:"priceOverride,omitempty"`
+}
+
+type InvoiceLineItem struct {
+	ChargeItemReference *Reference `json:"chargeItemReference,omitempty"`
+}
+
+type Invoice struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id"`
+	Status       string            `json:"status"`
+	Subject      *Reference        `json:"subject,omitempty"`
+	Date         *time.Time        `json:"date,omitempty"`
+	LineItem     []InvoiceLineItem `json:"lineItem,omitempty"`
+	TotalGross   *Money            `json:"totalGross,omitempty"`
+}
+
+type BundleEntry struct {
+	FullURL  string      `json:"fullUrl,omitempty"`
+	Resource interface{} `json:"resource"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"` // searchset, collection, transaction
+	Total        *int          `json:"total,omitempty"`
+	Timestamp    *time.Time    `json:"timestamp,omitempty"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+// NewOutcome 生成单条错误/信息的 OperationOutcome
+func NewOutcome(severity, code, diagnostics string) OperationOutcome {
+	return OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []OperationOutcomeIssue{{Severity: severity, Code: code, Diagnostics: diagnostics}},
+	}
+}
+
+// NewBundle 把资源列表包装成 Bundle
+func NewBundle(bundleType, baseURL string, resources []Resource) Bundle {
+	now := time.Now()
+	total := len(resources)
+	b := Bundle{ResourceType: "Bundle", Type: bundleType, Timestamp: &now, Entry: []BundleEntry{}}
+	if bundleType == "searchset" {
+		b.Total = &total
+	}
+	for _, r := range resources {
+		b.Entry = append(b.Entry, BundleEntry{FullURL: baseURL + "/" + r.Type + "/" + r.ID, Resource: r.Body})
+	}
+	return b
+}
+
+// Resource 资源及其类型/ID，便于统一组装 Bundle
+type Resource struct {
+	Type string
+	ID   string
+	Body interface{}
+}
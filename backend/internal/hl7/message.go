@@ -0,0 +1,203 @@
+// Package hl7 实现 HL7 v2.x 消息的解析、组装与 MLLP 传输
+// 只覆盖本系统用到的 ADT/ORU/ACK 消息，不做完整的版本校验
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Segment 消息段，Fields[0] 为段名
+// MSH 段特殊：Fields[1] 是字段分隔符本身，保证 "MSH-9" 这样的序号与规范一致
+type Segment struct {
+	Fields []string
+}
+
+// Name 段名，例如 PID
+func (s Segment) Name() string {
+	if len(s.Fields) == 0 {
+		return ""
+	}
+	return s.Fields[0]
+}
+
+// Field 取第 n 个字段 (从 1 开始)，不存在返回空串
+func (s Segment) Field(n int) string {
+	if n <= 0 || n >= len(s.Fields) {
+		return ""
+	}
+	return s.Fields[n]
+}
+
+// Component 取第 n 个字段的第 m 个组件 (都从 1 开始)
+func (s Segment) Component(n, m int) string {
+	parts := strings.Split(s.Field(n), "^")
+	if m <= 0 || m > len(parts) {
+		return ""
+	}
+	return parts[m-1]
+}
+
+// Message 一条 HL7 消息
+type Message struct {
+	Segments []Segment
+}
+
+// Parse 解析 HL7 消息，段分隔符兼容 \r、\n、\r\n
+func Parse(raw string) (*Message, error) {
+	raw = strings.ReplaceAll(raw, "\r\n", "\r")
+	raw = strings.ReplaceAll(raw, "\n", "\r")
+
+	msg := &Message{}
+	for _, line := range strings.Split(raw, "\r") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "MSH") {
+			if len(line) < 8 {
+				return nil, errors.New("MSH 段不完整")
+			}
+			sep := string(line[3])
+			rest := strings.Split(line[4:], sep)
+			fields := append([]string{"MSH", sep}, rest...)
+			msg.Segments = append(msg.Segments, Segment{Fields: fields})
+			continue
+		}
+		msg.Segments = append(msg.Segments, Segment{Fields: strings.Split(line, "|")})
+	}
+
+	if len(msg.Segments) == 0 || msg.Segments[0].Name() != "MSH" {
+		return nil, errors.New("消息必须以 MSH 段开头")
+	}
+	return msg, nil
+}
+
+// Segment 取第一个指定名称的段
+func (m *Message) Segment(name string) (Segment, bool) {
+	for _, s := range m.Segments {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return Segment{}, false
+}
+
+// All 取所有指定名称的段
+func (m *Message) All(name string) []Segment {
+	var out []Segment
+	for _, s := range m.Segments {
+		if s.Name() == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Get 按 "PID-5.1" 形式取值
+func (m *Message) Get(path string) string {
+	name, rest, _ := strings.Cut(path, "-")
+	fieldStr, compStr, hasComp := strings.Cut(rest, ".")
+	field, _ := strconv.Atoi(fieldStr)
+	s, ok := m.Segment(name)
+	if !ok {
+		return ""
+	}
+	if hasComp {
+		comp, _ := strconv.Atoi(compStr)
+		return s.Component(field, comp)
+	}
+	return s.Field(field)
+}
+
+// Type 消息类型，例如 ADT^A04 返回 ("ADT", "A04")
+func (m *Message) Type() (string, string) {
+	return m.Get("MSH-9.1"), m.Get("MSH-9.2")
+}
+
+// ControlID 消息控制号 MSH-10
+func (m *Message) ControlID() string {
+	return m.Get("MSH-10")
+}
+
+// String 序列化为以 \r 分隔的 HL7 文本
+func (m *Message) String() string {
+	lines := make([]string, 0, len(m.Segments))
+	for _, s := range m.Segments {
+		if s.Name() == "MSH" {
+			lines = append(lines, "MSH|"+strings.Join(s.Fields[2:], "|"))
+			continue
+		}
+		lines = append(lines, strings.Join(s.Fields, "|"))
+	}
+	return strings.Join(lines, "\r") + "\r"
+}
+
+// Add 追加一个段，字段按顺序从 1 开始
+func (m *Message) Add(name string, fields ...string) *Message {
+	m.Segments = append(m.Segments, Segment{Fields: append([]string{name}, fields...)})
+	return m
+}
+
+var controlSeq uint64
+
+// NewControlID 生成本机唯一的消息控制号
+func NewControlID() string {
+	n := atomic.AddUint64(&controlSeq, 1)
+	return fmt.Sprintf("%s%04d", time.Now().Format("20060102150405"), n%10000)
+}
+
+// New 新建消息并写入 MSH 段
+func New(sendingApp, sendingFacility, msgType, trigger string) *Message {
+	m := &Message{}
+	m.Segments = append(m.Segments, Segment{Fields: []string{
+		"MSH", "|", "^~\\&", sendingApp, sendingFacility, "", "",
+		Timestamp(time.Now()), "", msgType + "^" + trigger, NewControlID(), "P", "2.5",
+	}})
+	return m
+}
+
+// ACK 生成应答消息；code: AA 成功, AE 应用错误, AR 拒绝
+func ACK(req *Message, code, text string) *Message {
+	_, trigger := req.Type()
+	ack := &Message{}
+	ack.Segments = append(ack.Segments, Segment{Fields: []string{
+		"MSH", "|", "^~\\&", req.Get("MSH-5"), req.Get("MSH-6"), req.Get("MSH-3"), req.Get("MSH-4"),
+		Timestamp(time.Now()), "", "ACK^" + trigger + "^ACK", NewControlID(), "P", req.Get("MSH-12"),
+	}})
+	ack.Add("MSA", code, req.ControlID(), Escape(text))
+	return ack
+}
+
+// Timestamp HL7 时间格式 YYYYMMDDHHMMSS
+func Timestamp(t time.Time) string {
+	return t.Format("20060102150405")
+}
+
+// ParseTime 解析 HL7 时间 (支持到日、分、秒的精度)
+func ParseTime(s string) (time.Time, bool) {
+	for _, layout := range []string{"20060102150405", "200601021504", "20060102"} {
+		if len(s) >= len(layout) {
+			if t, err := time.ParseInLocation(layout, s[:len(layout)], time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Escape 转义字段内容中的分隔符
+func Escape(s string) string {
+	r := strings.NewReplacer(`\`, `\E\`, "|", `\F\`, "^", `\S\`, "&", `\T\`, "~", `\R\`, "\r", " ", "\n", " ")
+	return r.Replace(s)
+}
+
+// Unescape 还原转义序列
+func Unescape(s string) string {
+	r := strings.NewReplacer(`\F\`, "|", `\S\`, "^", `\T\`, "&", `\R\`, "~", `\E\`, `\`)
+	return r.Replace(s)
+}
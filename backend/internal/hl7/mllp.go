@@ -0,0 +1,154 @@
+package hl7
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// MLLP 帧格式: <VT> 消息 <FS><CR>
+const (
+	startBlock = 0x0b
+	endBlock   = 0x1c
+	carriage   = 0x0d
+)
+
+const maxFrameSize = 4 << 20 // 单条消息上限 4MB
+
+// ReadFrame 读取一帧，返回去掉帧头帧尾的消息内容
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	// 跳过帧之间的杂字节 (部分设备会发送多余换行)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+
+	var buf []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b == endBlock {
+			next, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if next != carriage {
+				return nil, errors.New("MLLP 帧尾缺少 CR")
+			}
+			return buf, nil
+		}
+		buf = append(buf, b)
+		if len(buf) > maxFrameSize {
+			return nil, errors.New("MLLP 帧过大")
+		}
+	}
+}
+
+// WriteFrame 写入一帧
+func WriteFrame(w io.Writer, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, payload...)
+	frame = append(frame, endBlock, carriage)
+	_, err := w.Write(frame)
+	return err
+}
+
+// Handler 处理一条入站消息，返回应答消息
+type Handler func(msg *Message) *Message
+
+// Server MLLP 监听服务
+type Server struct {
+	Addr        string
+	Handler     Handler
+	IdleTimeout time.Duration
+}
+
+// ListenAndServe 阻塞运行，每个连接一个 goroutine，连接内按顺序处理消息
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("HL7 MLLP 监听已启动: %s", s.Addr)
+	return s.Serve(ln)
+}
+
+// Serve 在已有的 listener 上提供服务
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	idle := s.IdleTimeout
+	if idle == 0 {
+		idle = 5 * time.Minute
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idle))
+		payload, err := ReadFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("HL7 连接 %s 读取失败: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		var reply *Message
+		msg, err := Parse(string(payload))
+		if err != nil {
+			// 连 MSH 都解析不了，无法按规范回 ACK，只能回一条最简 NAK
+			reply = New("", "", "ACK", "")
+			reply.Add("MSA", "AR", "", Escape(err.Error()))
+		} else {
+			reply = s.Handler(msg)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		if err := WriteFrame(conn, []byte(reply.String())); err != nil {
+			log.Printf("HL7 连接 %s 回复失败: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// Send 作为客户端发送一条消息并等待 ACK
+func Send(addr string, msg *Message, timeout time.Duration) (*Message, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := WriteFrame(conn, []byte(msg.String())); err != nil {
+		return nil, err
+	}
+	payload, err := ReadFrame(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(payload))
+}
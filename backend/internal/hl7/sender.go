@@ -0,0 +1,64 @@
+package hl7
+
+import (
+	"log"
+	"time"
+)
+
+// Sender 出站消息队列：业务代码只管投递，后台协程按顺序发送并在失败时重试
+type Sender struct {
+	Addr    string
+	Timeout time.Duration
+	Retries int
+	queue   chan *Message
+}
+
+// Outbound 全局出站发送器，未配置对端地址时为 nil
+var Outbound *Sender
+
+// InitSender 初始化出站发送器，addr 为空则不启用
+func InitSender(addr string) {
+	if addr == "" {
+		return
+	}
+	Outbound = &Sender{Addr: addr, Timeout: 10 * time.Second, Retries: 3, queue: make(chan *Message, 1000)}
+	go Outbound.run()
+	log.Printf("HL7 出站发送已启用: %s", addr)
+}
+
+// Publish 投递一条出站消息 (不阻塞业务请求，队列满时丢弃并记录日志)
+func Publish(msg *Message) {
+	if Outbound == nil {
+		return
+	}
+	select {
+	case Outbound.queue <- msg:
+	default:
+		log.Printf("HL7 出站队列已满，丢弃消息 %s", msg.ControlID())
+	}
+}
+
+func (s *Sender) run() {
+	for msg := range s.queue {
+		s.deliver(msg)
+	}
+}
+
+func (s *Sender) deliver(msg *Message) {
+	backoff := time.Second
+	for attempt := 1; attempt <= s.Retries; attempt++ {
+		ack, err := Send(s.Addr, msg, s.Timeout)
+		if err == nil {
+			switch code := ack.Get("MSA-1"); code {
+			case "AA", "CA":
+				return
+			default:
+				log.Printf("HL7 消息 %s 被对端拒绝: %s %s", msg.ControlID(), code, ack.Get("MSA-3"))
+				return
+			}
+		}
+		log.Printf("HL7 消息 %s 第 %d 次发送失败: %v", msg.ControlID(), attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
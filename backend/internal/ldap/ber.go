@@ -0,0 +1,202 @@
+// Package ldap 实现 LDAPv3 (RFC 4511) 的最小子集：simple bind 和 search
+// 用于对接医院集团的统一目录 (OpenLDAP / Active Directory)，另带一个简易服务端供本地联调
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER 标识字节: 类别 (2 位) | 构造位 (0x20) | 标签号
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	appBindRequest   = 0x60
+	appBindResponse  = 0x61
+	appUnbindRequest = 0x42
+	appSearchRequest = 0x63
+	appSearchEntry   = 0x64
+	appSearchDone    = 0x65
+	ctxSimpleAuth    = 0x80 // BindRequest 中的 simple 认证 [0]
+)
+
+const constructedBit byte = 0x20
+
+const maxPacketSize = 1 << 20 // 单条消息上限 1MB
+
+// Packet BER 编码的一个 TLV：基本类型用 Value，构造类型用 Children
+type Packet struct {
+	Tag      byte
+	Value    []byte
+	Children []*Packet
+}
+
+// NewPacket 构造类型 (SEQUENCE、SET、APPLICATION 等)
+func NewPacket(tag byte, children ...*Packet) *Packet {
+	return &Packet{Tag: tag, Children: children}
+}
+
+// NewString OCTET STRING 或其他以字符串为内容的基本类型
+func NewString(tag byte, s string) *Packet {
+	return &Packet{Tag: tag, Value: []byte(s)}
+}
+
+// NewInt INTEGER / ENUMERATED (补码，最短编码)
+func NewInt(tag byte, n int64) *Packet {
+	var buf []byte
+	for {
+		buf = append([]byte{byte(n)}, buf...)
+		n >>= 8
+		if (n == 0 && buf[0]&0x80 == 0) || (n == -1 && buf[0]&0x80 != 0) {
+			break
+		}
+	}
+	return &Packet{Tag: tag, Value: buf}
+}
+
+// NewBool BOOLEAN
+func NewBool(tag byte, b bool) *Packet {
+	if b {
+		return &Packet{Tag: tag, Value: []byte{0xff}}
+	}
+	return &Packet{Tag: tag, Value: []byte{0x00}}
+}
+
+func (p *Packet) constructed() bool { return p.Tag&constructedBit != 0 }
+
+// Str 内容按字符串读取
+func (p *Packet) Str() string { return string(p.Value) }
+
+// Int 内容按整数读取
+func (p *Packet) Int() int64 {
+	if len(p.Value) == 0 {
+		return 0
+	}
+	n := int64(int8(p.Value[0]))
+	for _, b := range p.Value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n
+}
+
+// Child 第 i 个子元素，不存在返回 nil
+func (p *Packet) Child(i int) *Packet {
+	if i < 0 || i >= len(p.Children) {
+		return nil
+	}
+	return p.Children[i]
+}
+
+// Bytes BER 编码 (定长形式)
+func (p *Packet) Bytes() []byte {
+	content := p.Value
+	if p.constructed() {
+		content = nil
+		for _, child := range p.Children {
+			content = append(content, child.Bytes()...)
+		}
+	}
+	out := []byte{p.Tag}
+	out = append(out, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var buf []byte
+	for ; n > 0; n >>= 8 {
+		buf = append([]byte{byte(n)}, buf...)
+	}
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
+
+// ReadPacket 从连接读取一个完整的 BER 元素
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("ldap: 不支持多字节标签")
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, errors.New("ldap: 不支持的长度编码")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxPacketSize {
+		return nil, fmt.Errorf("ldap: 消息过大 (%d 字节)", length)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return decode(tag, content)
+}
+
+func decode(tag byte, content []byte) (*Packet, error) {
+	p := &Packet{Tag: tag}
+	if tag&constructedBit == 0 {
+		p.Value = content
+		return p, nil
+	}
+	for len(content) > 0 {
+		child, rest, err := parseOne(content)
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, child)
+		content = rest
+	}
+	return p, nil
+}
+
+func parseOne(data []byte) (*Packet, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("ldap: 报文截断")
+	}
+	tag, first := data[0], data[1]
+	data = data[2:]
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 || len(data) < n {
+			return nil, nil, errors.New("ldap: 不支持的长度编码")
+		}
+		length = 0
+		for _, b := range data[:n] {
+			length = length<<8 | int(b)
+		}
+		data = data[n:]
+	}
+	if length > len(data) {
+		return nil, nil, errors.New("ldap: 报文截断")
+	}
+	p, err := decode(tag, data[:length])
+	return p, data[length:], err
+}
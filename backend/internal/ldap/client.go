@@ -0,0 +1,228 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 常用结果码
+const (
+	ResultSuccess            = 0
+	ResultProtocolError      = 2
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+	ResultUnwillingToPerform = 53
+)
+
+// ErrInvalidCredentials DN 不存在或密码错误
+var ErrInvalidCredentials = errors.New("ldap: 用户名或密码错误")
+
+// Error 服务端返回的非成功结果
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ldap: 结果码 %d: %s", e.Code, e.Message)
+}
+
+// Entry 搜索结果条目
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// GetAll 属性的全部值 (属性名不区分大小写)
+func (e *Entry) GetAll(name string) []string {
+	for k, v := range e.Attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Get 属性的第一个值
+func (e *Entry) Get(name string) string {
+	if values := e.GetAll(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// SearchRequest 在 BaseDN 下整棵子树搜索
+type SearchRequest struct {
+	BaseDN     string
+	Filter     string
+	Attributes []string // 为空返回全部属性
+	SizeLimit  int
+}
+
+// Conn 一条 LDAP 连接 (不支持并发请求)
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	msgID   int64
+	timeout time.Duration
+}
+
+// Dial 连接目录服务，地址形如 ldap://host:389 或 ldaps://host:636
+func Dial(rawURL string, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: 地址无效: %w", err)
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: timeout}
+	switch u.Scheme {
+	case "ldap":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("ldap: 不支持的协议 %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, r: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Close 发送 Unbind 并关闭连接
+func (c *Conn) Close() error {
+	c.msgID++
+	msg := NewPacket(tagSequence, NewInt(tagInteger, c.msgID), &Packet{Tag: appUnbindRequest})
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	c.conn.Write(msg.Bytes())
+	return c.conn.Close()
+}
+
+// Bind simple bind
+// 空密码在 LDAP 中是“匿名绑定”，会直接成功，这里按密码错误处理
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return ErrInvalidCredentials
+	}
+	op := NewPacket(appBindRequest,
+		NewInt(tagInteger, 3),
+		NewString(tagOctetString, dn),
+		NewString(ctxSimpleAuth, password),
+	)
+	resp, err := c.roundTrip(op, appBindResponse)
+	if err != nil {
+		return err
+	}
+	if err := resultError(resp[0]); err != nil {
+		var le *Error
+		if errors.As(err, &le) && le.Code == ResultInvalidCredentials {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// Search 整棵子树搜索
+func (c *Conn) Search(req SearchRequest) ([]*Entry, error) {
+	filter, err := ParseFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := NewPacket(tagSequence)
+	for _, a := range req.Attributes {
+		attrs.Children = append(attrs.Children, NewString(tagOctetString, a))
+	}
+	op := NewPacket(appSearchRequest,
+		NewString(tagOctetString, req.BaseDN),
+		NewInt(tagEnumerated, 2), // wholeSubtree
+		NewInt(tagEnumerated, 0), // neverDerefAliases
+		NewInt(tagInteger, int64(req.SizeLimit)),
+		NewInt(tagInteger, int64(c.timeout/time.Second)),
+		NewBool(tagBoolean, false),
+		filter.packet(),
+		attrs,
+	)
+
+	resp, err := c.roundTrip(op, appSearchDone)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, p := range resp[:len(resp)-1] {
+		if p.Tag != appSearchEntry || len(p.Children) < 2 {
+			continue // 忽略引用 (referral)
+		}
+		entry := &Entry{DN: p.Children[0].Str(), Attributes: map[string][]string{}}
+		for _, attr := range p.Children[1].Children {
+			if len(attr.Children) < 2 {
+				continue
+			}
+			name := attr.Children[0].Str()
+			for _, v := range attr.Children[1].Children {
+				entry.Attributes[name] = append(entry.Attributes[name], v.Str())
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := resultError(resp[len(resp)-1]); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+// roundTrip 发送请求，读取同一 messageID 的响应直到出现 doneTag
+func (c *Conn) roundTrip(op *Packet, doneTag byte) ([]*Packet, error) {
+	c.msgID++
+	msg := NewPacket(tagSequence, NewInt(tagInteger, c.msgID), op)
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if _, err := c.conn.Write(msg.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var ops []*Packet
+	for {
+		p, err := ReadPacket(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if p.Tag != tagSequence || len(p.Children) < 2 {
+			return nil, errors.New("ldap: 响应格式错误")
+		}
+		if p.Children[0].Int() != c.msgID {
+			continue
+		}
+		ops = append(ops, p.Children[1])
+		if p.Children[1].Tag == doneTag {
+			return ops, nil
+		}
+	}
+}
+
+// resultError 解析 LDAPResult
+func resultError(p *Packet) error {
+	if len(p.Children) < 3 {
+		return errors.New("ldap: 响应格式错误")
+	}
+	code := int(p.Children[0].Int())
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{Code: code, Message: p.Children[2].Str()}
+}
@@ -0,0 +1,193 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 过滤器类型 (RFC 4511 Filter CHOICE)，只支持与 / 或 / 非 / 等值 / 存在
+const (
+	filterAnd      = 0xa0
+	filterOr       = 0xa1
+	filterNot      = 0xa2
+	filterEquality = 0xa3
+	filterPresent  = 0x87
+)
+
+// Filter 解析后的搜索过滤器，例如 (&(uid=zhangsan)(objectClass=person))
+type Filter struct {
+	Op       byte
+	Attr     string
+	Value    string
+	Children []*Filter
+}
+
+// EscapeFilter 转义过滤器中的值 (RFC 4515)，拼接用户输入时必须使用
+func EscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ParseFilter 解析字符串形式的过滤器
+func ParseFilter(s string) (*Filter, error) {
+	f, rest, err := parseFilter(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("ldap: 过滤器多余内容 %q", rest)
+	}
+	return f, nil
+}
+
+func parseFilter(s string) (*Filter, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", errors.New("ldap: 过滤器应以 ( 开头")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", errors.New("ldap: 过滤器不完整")
+	}
+
+	switch s[0] {
+	case '&', '|', '!':
+		f := &Filter{Op: map[byte]byte{'&': filterAnd, '|': filterOr, '!': filterNot}[s[0]]}
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			f.Children = append(f.Children, child)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") || len(f.Children) == 0 || (f.Op == filterNot && len(f.Children) != 1) {
+			return nil, "", errors.New("ldap: 过滤器括号不匹配")
+		}
+		return f, s[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", errors.New("ldap: 过滤器括号不匹配")
+	}
+	item, rest := s[:end], s[end+1:]
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 || strings.ContainsAny(item[eq-1:eq], "~<>:") {
+		return nil, "", fmt.Errorf("ldap: 不支持的过滤条件 %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	if value == "*" {
+		return &Filter{Op: filterPresent, Attr: attr}, rest, nil
+	}
+	if strings.Contains(value, "*") {
+		return nil, "", fmt.Errorf("ldap: 不支持子串匹配 %q", item)
+	}
+	unescaped, err := unescapeFilter(value)
+	if err != nil {
+		return nil, "", err
+	}
+	return &Filter{Op: filterEquality, Attr: attr, Value: unescaped}, rest, nil
+}
+
+func unescapeFilter(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", errors.New("ldap: 过滤器转义不完整")
+		}
+		decoded, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", errors.New("ldap: 过滤器转义无效")
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// packet BER 编码
+func (f *Filter) packet() *Packet {
+	switch f.Op {
+	case filterAnd, filterOr, filterNot:
+		p := NewPacket(f.Op)
+		for _, child := range f.Children {
+			p.Children = append(p.Children, child.packet())
+		}
+		return p
+	case filterPresent:
+		return NewString(filterPresent, f.Attr)
+	default:
+		return NewPacket(filterEquality, NewString(tagOctetString, f.Attr), NewString(tagOctetString, f.Value))
+	}
+}
+
+// filterFromPacket 服务端解码过滤器
+func filterFromPacket(p *Packet) (*Filter, error) {
+	f := &Filter{Op: p.Tag}
+	switch p.Tag {
+	case filterAnd, filterOr, filterNot:
+		for _, child := range p.Children {
+			cf, err := filterFromPacket(child)
+			if err != nil {
+				return nil, err
+			}
+			f.Children = append(f.Children, cf)
+		}
+	case filterPresent:
+		f.Attr = p.Str()
+	case filterEquality:
+		if len(p.Children) != 2 {
+			return nil, errors.New("ldap: 等值过滤器格式错误")
+		}
+		f.Attr, f.Value = p.Children[0].Str(), p.Children[1].Str()
+	default:
+		return nil, fmt.Errorf("ldap: 不支持的过滤器类型 0x%02x", p.Tag)
+	}
+	return f, nil
+}
+
+// Match 条目是否满足过滤器 (属性名、属性值都不区分大小写)
+func (f *Filter) Match(e *Entry) bool {
+	switch f.Op {
+	case filterAnd:
+		for _, child := range f.Children {
+			if !child.Match(e) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range f.Children {
+			if child.Match(e) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !f.Children[0].Match(e)
+	case filterPresent:
+		return strings.EqualFold(f.Attr, "objectClass") || len(e.GetAll(f.Attr)) > 0
+	default:
+		for _, v := range e.GetAll(f.Attr) {
+			if strings.EqualFold(v, f.Value) {
+				return true
+			}
+		}
+		return false
+	}
+}
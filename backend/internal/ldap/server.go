@@ -0,0 +1,137 @@
+package ldap
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"strings"
+)
+
+// Server 简易 LDAP 服务，只支持 simple bind、search 和 unbind，供本地联调使用 (见 cmd/sso-standin)
+type Server struct {
+	Addr   string
+	Bind   func(dn, password string) bool
+	Search func(baseDN string, filter *Filter) []*Entry
+}
+
+// ListenAndServe 监听并处理连接
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("LDAP 联调服务已启动: %s", s.Addr)
+	return s.Serve(ln)
+}
+
+// Serve 在已有监听上处理连接
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		p, err := ReadPacket(r)
+		if err != nil {
+			return
+		}
+		if p.Tag != tagSequence || len(p.Children) < 2 {
+			return
+		}
+		id, op := p.Children[0].Int(), p.Children[1]
+
+		var replies []*Packet
+		switch op.Tag {
+		case appBindRequest:
+			replies = []*Packet{s.handleBind(op)}
+		case appSearchRequest:
+			replies = s.handleSearch(op)
+		case appUnbindRequest:
+			return
+		default:
+			// 其他操作一律拒绝 (没有对应的响应类型时直接断开)
+			return
+		}
+		for _, reply := range replies {
+			msg := NewPacket(tagSequence, NewInt(tagInteger, id), reply)
+			if _, err := conn.Write(msg.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) handleBind(op *Packet) *Packet {
+	dn, auth := op.Child(1), op.Child(2)
+	if dn == nil || auth == nil || auth.Tag != ctxSimpleAuth {
+		return result(appBindResponse, ResultProtocolError, "仅支持 simple bind")
+	}
+	if auth.Str() == "" || s.Bind == nil || !s.Bind(dn.Str(), auth.Str()) {
+		return result(appBindResponse, ResultInvalidCredentials, "Invalid credentials")
+	}
+	return result(appBindResponse, ResultSuccess, "")
+}
+
+func (s *Server) handleSearch(op *Packet) []*Packet {
+	if len(op.Children) < 8 || s.Search == nil {
+		return []*Packet{result(appSearchDone, ResultProtocolError, "search 请求格式错误")}
+	}
+	filter, err := filterFromPacket(op.Children[6])
+	if err != nil {
+		return []*Packet{result(appSearchDone, ResultUnwillingToPerform, err.Error())}
+	}
+	var wanted []string
+	for _, a := range op.Children[7].Children {
+		wanted = append(wanted, a.Str())
+	}
+	sizeLimit := int(op.Children[3].Int())
+
+	var replies []*Packet
+	for _, entry := range s.Search(op.Children[0].Str(), filter) {
+		if sizeLimit > 0 && len(replies) >= sizeLimit {
+			break
+		}
+		attrs := NewPacket(tagSequence)
+		for name, values := range entry.Attributes {
+			if !wantedAttr(wanted, name) {
+				continue
+			}
+			vals := NewPacket(tagSet)
+			for _, v := range values {
+				vals.Children = append(vals.Children, NewString(tagOctetString, v))
+			}
+			attrs.Children = append(attrs.Children, NewPacket(tagSequence, NewString(tagOctetString, name), vals))
+		}
+		replies = append(replies, NewPacket(appSearchEntry, NewString(tagOctetString, entry.DN), attrs))
+	}
+	return append(replies, result(appSearchDone, ResultSuccess, ""))
+}
+
+func wantedAttr(wanted []string, name string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if w == "*" || strings.EqualFold(w, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// result LDAPResult 响应
+func result(tag byte, code int, message string) *Packet {
+	return NewPacket(tag,
+		NewInt(tagEnumerated, int64(code)),
+		NewString(tagOctetString, ""),
+		NewString(tagOctetString, message),
+	)
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// DepositAccount 患者预交金账户 (每个患者一个)
+// 余额只能通过写入 DepositEntry 的同一事务修改，数据库触发器禁止出现负数
+type DepositAccount struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"index" json:"org_id"` // 所属机构
+	PatientID uint      `gorm:"uniqueIndex" json:"patient_id"`
+	Balance   float64   `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DepositEntry 预交金流水 (只追加，不可修改和删除)
+type DepositEntry struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	OrgID        uint      `gorm:"index" json:"org_id"` // 所属机构
+	AccountID    uint      `gorm:"index" json:"account_id"`
+	PatientID    uint      `gorm:"index" json:"patient_id"`
+	Type         string    `json:"type"`          // deposit 缴存, refund 退款, payment 缴费扣款
+	Amount       float64   `json:"amount"`        // 缴存为正，退款和扣款为负
+	BalanceAfter float64   `json:"balance_after"` // 本笔发生后的余额
+	OrderID      uint      `json:"order_id"`      // 扣款对应的订单
+	Method       string    `json:"method"`        // cash, card, wechat, alipay
+	Note         string    `json:"note"`
+	OperatorID   uint      `json:"operator_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
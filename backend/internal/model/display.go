@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// DisplayScreen 候诊区叫号屏
+// 屏幕凭 Token 访问公开的只读接口，不需要员工登录
+type DisplayScreen struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OrgID       uint      `gorm:"index" json:"org_id"`      // 所属机构
+	Name        string    `json:"name"`                     // 例如 门诊二楼候诊区
+	Token       string    `gorm:"uniqueIndex" json:"token"` // 屏幕访问令牌
+	Departments string    `json:"departments"`              // 显示的科室，逗号分隔
+	ShowName    bool      `json:"show_name"`                // 是否显示脱敏后的姓名，否则只显示号码
+	WaitingSize int       `json:"waiting_size"`             // 每个科室显示的候诊人数
+	Active      bool      `gorm:"default:true" json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// FollowUp 复诊安排 (医生在接诊时开具，如"两周后复诊")
+// Mode = booking: 直接为同一医生预约复诊日的号 (BookingID，状态 Scheduled，到院签到后进入队列)
+// Mode = reminder: 只提醒患者自行预约，患者之后在同科室挂号会自动关联
+// 生命周期: Open (待预约) / Booked (已预约) -> Completed (已复诊) / Missed (爽约) / Cancelled
+type FollowUp struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	OrgID           uint      `gorm:"index" json:"org_id"`            // 所属机构
+	SourceBookingID uint      `gorm:"index" json:"source_booking_id"` // 开具复诊的那次就诊
+	RecordID        uint      `json:"record_id"`
+	PatientID       uint      `gorm:"index" json:"patient_id"`
+	PatientName     string    `json:"patient_name"`
+	DoctorID        uint      `gorm:"index" json:"doctor_id"`
+	Department      string    `json:"department"`
+	DueDate         string    `gorm:"index" json:"due_date"` // 复诊日期 2006-01-02
+	Mode            string    `json:"mode"`                  // booking, reminder
+	Note            string    `json:"note"`
+	BookingID       uint      `gorm:"index" json:"booking_id"` // 复诊挂号单，0 表示尚未预约
+	Status          string    `gorm:"index" json:"status"`     // Open, Booked, Completed, Missed, Cancelled
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
@@ -0,0 +1,76 @@
+package model
+
+import "time"
+
+// Ward 病区
+type Ward struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	OrgID      uint      `gorm:"uniqueIndex:idx_org_ward" json:"org_id"` // 所属机构
+	Name       string    `gorm:"uniqueIndex:idx_org_ward" json:"name"`   // 例如 内科一病区 (机构内唯一)
+	Department string    `json:"department"`
+	DailyRate  float64   `json:"daily_rate"` // 床位费 (元/天)，床位未单独定价时使用
+	Beds       []Bed     `gorm:"foreignKey:WardID" json:"beds,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Bed 床位
+type Bed struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	OrgID       uint    `gorm:"index" json:"org_id"` // 所属机构
+	WardID      uint    `gorm:"uniqueIndex:idx_ward_bed" json:"ward_id"`
+	Number      string  `gorm:"uniqueIndex:idx_ward_bed" json:"number"` // 床号
+	DailyRate   float64 `json:"daily_rate"`                             // 0 表示按病区统一价格
+	Status      string  `gorm:"default:Available" json:"status"`        // Available, Occupied, Cleaning, Maintenance
+	AdmissionID uint    `json:"admission_id"`                           // 当前占用的住院记录
+}
+
+// Admission 住院记录
+// 生命周期: Admitted (在院) -> Discharged (出院，生成结算订单)
+type Admission struct {
+	ID                 uint       `gorm:"primaryKey" json:"id"`
+	OrgID              uint       `gorm:"index" json:"org_id"` // 所属机构
+	PatientID          uint       `gorm:"index" json:"patient_id"`
+	PatientName        string     `json:"patient_name"`
+	BookingID          uint       `json:"booking_id"`             // 收住院的门诊挂号单 (可为空)
+	DoctorID           uint       `gorm:"index" json:"doctor_id"` // 主治医生
+	Department         string     `json:"department"`
+	WardID             uint       `json:"ward_id"`
+	BedID              uint       `json:"bed_id"`
+	Status             string     `gorm:"default:Admitted" json:"status"`
+	AdmitDiagnosis     string     `json:"admit_diagnosis"` // 入院诊断
+	AdmittedAt         time.Time  `json:"admitted_at"`
+	ChargedThrough     string     `json:"charged_through"` // 床位费已计到的日期 (2006-01-02)
+	DischargedAt       *time.Time `json:"discharged_at"`
+	DischargeDiagnosis string     `json:"discharge_diagnosis"` // 出院诊断
+	DischargeSummary   string     `json:"discharge_summary"`   // 出院小结
+	OrderID            uint       `json:"order_id"`            // 出院结算订单
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// BedTransfer 转床记录
+type BedTransfer struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	OrgID         uint      `gorm:"index" json:"org_id"` // 所属机构
+	AdmissionID   uint      `gorm:"index" json:"admission_id"`
+	FromBedID     uint      `json:"from_bed_id"`
+	ToBedID       uint      `json:"to_bed_id"`
+	Reason        string    `json:"reason"`
+	TransferredBy uint      `json:"transferred_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// InpatientCharge 住院费用明细 (床位费、药品)，出院时汇总为一张结算订单
+type InpatientCharge struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OrgID       uint      `gorm:"index" json:"org_id"` // 所属机构
+	AdmissionID uint      `gorm:"index" json:"admission_id"`
+	Type        string    `json:"type"` // bed, drug
+	Description string    `json:"description"`
+	ChargeDate  string    `json:"charge_date"` // 计费日期 (床位费按天)
+	MedicineID  uint      `json:"medicine_id"`
+	Quantity    int       `json:"quantity"`
+	UnitPrice   float64   `json:"unit_price"`
+	Amount      float64   `json:"amount"`
+	OrderedBy   uint      `json:"ordered_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
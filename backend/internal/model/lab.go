@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// LabTest 检验项目目录
+type LabTest struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Code         string    `gorm:"uniqueIndex;not null" json:"code"` // 项目编码，例如 GLU
+	Name         string    `gorm:"not null" json:"name"`
+	Specimen     string    `json:"specimen"` // 标本类型：血液、尿液...
+	Unit         string    `json:"unit"`
+	RefLow       *float64  `json:"ref_low"`       // 参考范围下限 (数值型结果)
+	RefHigh      *float64  `json:"ref_high"`      // 参考范围上限
+	CriticalLow  *float64  `json:"critical_low"`  // 危急值下限
+	CriticalHigh *float64  `json:"critical_high"` // 危急值上限
+	RefText      string    `json:"ref_text"`      // 定性结果的正常值，例如 "阴性"
+	Price        float64   `json:"price"`
+	Active       bool      `json:"active"` // 不设数据库默认值：停用 (false) 要能原样写入
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// LabOrder 检验申请单 (一个项目一条)
+// 状态流转: Ordered (已开单) -> Collected (已采样) -> Resulted (已出结果)
+type LabOrder struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrgID          uint       `gorm:"index" json:"org_id"` // 所属机构
+	BookingID      uint       `gorm:"index" json:"booking_id"`
+	TestID         uint       `json:"test_id"`
+	TestCode       string     `json:"test_code"`
+	TestName       string     `json:"test_name"`
+	DoctorID       uint       `gorm:"index" json:"doctor_id"` // 开单医生
+	OrderID        uint       `json:"order_id"`               // 对应的缴费单
+	Status         string     `gorm:"index" json:"status"`
+	SpecimenNo     string     `json:"specimen_no"`
+	CollectedAt    *time.Time `json:"collected_at"`
+	CollectedBy    uint       `json:"collected_by"`
+	ResultValue    string     `json:"result_value"`
+	Unit           string     `json:"unit"`
+	RefRange       string     `json:"ref_range"` // 出结果时的参考范围快照
+	Flag           string     `json:"flag"`      // N 正常, H 偏高, L 偏低, HH/LL 危急, A 异常
+	ResultNote     string     `json:"result_note"`
+	ResultedAt     *time.Time `json:"resulted_at"`
+	ResultedBy     uint       `json:"resulted_by"`
+	Acknowledged   bool       `json:"acknowledged"` // 开单医生是否已查看结果
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// TOTPCredential 两步验证 (TOTP 验证器 App) 绑定信息，每个用户一条
+type TOTPCredential struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"uniqueIndex" json:"user_id"`
+	Secret       string     `json:"-"`            // Base32 密钥
+	Enabled      bool       `json:"enabled"`      // 用户输入一次正确动态码后才启用
+	LastUsedStep int64      `json:"-"`            // 最近一次用过的时间步，同一动态码不能重复使用
+	ConfirmedAt  *time.Time `json:"confirmed_at"` // 启用时间
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode 恢复码：手机丢失时代替动态码登录，每个只能用一次
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	CodeHash  string     `gorm:"index" json:"-"` // SHA-256
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
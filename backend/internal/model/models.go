@@ -1,7 +1,7 @@
 package model
 
 import (
-	"strings"
+	"errors"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -13,12 +13,23 @@ type User struct {
 	ID         uint           `gorm:"primaryKey" json:"id"`
 	Username   string         `gorm:"unique;not null" json:"username"`
 	Password   string         `gorm:"not null" json:"-"`    // 不参与 JSON 序列化
-	Role       string         `gorm:"not null" json:"role"` // global_admin, org_admin, finance, storekeeper, registration, general_user
-	OrgID      uint           `json:"org_id"`               // 所属机构ID
+	Role       string         `gorm:"not null" json:"role"` // global_admin, org_admin, finance, storekeeper, registration, doctor, lab, general_user
+	OrgID      uint           `gorm:"index" json:"org_id"`  // 所属机构ID
 	Department string         `json:"department"`
 	CreatedAt  time.Time      `json:"created_at"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+
+	MustChangePassword bool       `json:"must_change_password"` // 管理员重置后，下次登录必须先修改密码
+	PasswordChangedAt  *time.Time `json:"password_changed_at"`
+
+	AuthProvider string `gorm:"default:local" json:"auth_provider"` // local, ldap, oidc
+	ExternalID   string `gorm:"index" json:"-"`                     // 目录中的 DN 或 OIDC 的 sub
+}
+
+// IsExternal 统一身份认证账号：密码由目录管理，本系统不能修改
+func (u *User) IsExternal() bool {
+	return u.AuthProvider != "" && u.AuthProvider != "local"
 }
 
 // InventoryItem 物资表
@@ -29,7 +40,7 @@ type InventoryItem struct {
 	Price       float64        `json:"price"`
 	Stock       int            `json:"stock"`
 	Description string         `json:"description"`
-	OrgID       uint           `json:"org_id"`
+	OrgID       uint           `gorm:"index" json:"org_id"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -37,61 +48,298 @@ type InventoryItem struct {
 
 // Patient 患者表
 type Patient struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `json:"name"`
-	Phone     string    `json:"phone"`
-	IDCard    string    `json:"id_card"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OrgID       uint      `gorm:"index" json:"org_id"` // 所属机构
+	Name        string    `json:"name"`
+	Phone       string    `json:"phone"`
+	IDCard      string    `json:"id_card"`
+	Gender      string    `json:"gender"`
+	BirthYear   int       `json:"birth_year"`                // 由挂号时的年龄推算，0 表示未知
+	UserID      uint      `gorm:"index" json:"user_id"`      // 患者本人自助挂号的登录账号
+	NeedsReview bool      `gorm:"index" json:"needs_review"` // 与已有同名档案无法确认是否同一人，待人工核对合并
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // Booking 挂号记录
 type Booking struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	PatientName string    `json:"patient_name"` // 新增：直接存名字
-	Age         int       `json:"age"`          // 新增：年龄
-	Gender      string    `json:"gender"`       // 新增：性别
-	Department  string    `json:"department"`   // 新增：科室
-	DoctorID    uint      `json:"doctor_id"`    // 关联医生
-	Status      string    `json:"status"`       // Pending, Completed
+	OrgID       uint      `gorm:"index" json:"org_id"`     // 所属机构
+	PatientID   uint      `gorm:"index" json:"patient_id"` // 关联患者档案
+	PatientName string    `json:"patient_name"`            // 新增：直接存名字
+	Age         int       `json:"age"`                     // 新增：年龄
+	Gender      string    `json:"gender"`                  // 新增：性别
+	Department  string    `json:"department"`              // 新增：科室
+	DoctorID    uint      `json:"doctor_id"`               // 关联医生
+	Status      string    `json:"status"`                  // Pending, Completed, Cancelled, Referred, Scheduled (复诊预约，未签到), Missed (复诊爽约)
 	CreatedAt   time.Time `json:"created_at"`
+
+	ReferredFromID uint `json:"referred_from_id"` // 由哪张挂号单转诊而来
+
+	// 排队叫号
+	QueueDate  string     `gorm:"index" json:"queue_date"`            // 排队日期 2006-01-02，号码按科室 + 日期编排
+	TicketNo   int        `json:"ticket_no"`                          // 当日科室排队号
+	Priority   string     `json:"priority"`                           // 优先标志: emergency, elderly, revisit，空为普通
+	QueueState string     `gorm:"default:Waiting" json:"queue_state"` // Waiting, Called, Skipped
+	CalledAt   *time.Time `json:"called_at"`                          // 最近一次叫号时间
+	Room       string     `json:"room"`                               // 叫号时医生所在诊室
+	CallCount  int        `json:"call_count"`                         // 叫号次数 (含重呼)
+
+	// 急诊分诊
+	Acuity      int        `json:"acuity"`       // 分诊级别 1-5 (1 最危重)，0 表示未分诊
+	TriagedAt   *time.Time `json:"triaged_at"`   // 最近一次分诊时间，候诊超时从这里算起
+	EscalatedAt *time.Time `json:"escalated_at"` // 最近一次超时提醒时间
 }
 
 // MedicalRecord 电子病历
+// 生命周期: Draft (草稿，作者可修改) -> Signed (已签署，只能通过修订追加新版本)
 type MedicalRecord struct {
+	ID             uint                     `gorm:"primaryKey" json:"id"`
+	OrgID          uint                     `gorm:"index" json:"org_id"` // 所属机构
+	BookingID      uint                     `json:"booking_id"`
+	DoctorID       uint                     `gorm:"index" json:"doctor_id"`      // 病历作者
+	Status         string                   `gorm:"default:Draft" json:"status"` // Draft, Signed
+	Version        int                      `gorm:"default:1" json:"version"`    // 当前版本号，每次修订 +1
+	SignedAt       *time.Time               `json:"signed_at"`
+	ChiefComplaint string                   `json:"chief_complaint"` // 主诉
+	PresentIllness string                   `json:"present_illness"` // 现病史
+	PastHistory    string                   `json:"past_history"`    // 既往史
+	PhysicalExam   string                   `json:"physical_exam"`   // 体格检查
+	Vitals         Vitals                   `gorm:"embedded;embeddedPrefix:vital_" json:"vitals"`
+	Diagnosis      string                   `json:"diagnosis"`    // 诊断结果 (自由文本，兼容旧数据)
+	Prescription   string                   `json:"prescription"` // 处方内容 (简化为字符串)
+	Diagnoses      []MedicalRecordDiagnosis `gorm:"foreignKey:RecordID" json:"diagnoses"`
+	CreatedAt      time.Time                `json:"created_at"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+}
+
+// MedicalRecordVersion 病历版本 (签署及每次修订各保存一份完整快照，只追加不修改)
+type MedicalRecordVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"index" json:"org_id"` // 所属机构
+	RecordID  uint      `gorm:"uniqueIndex:idx_record_version" json:"record_id"`
+	Version   int       `gorm:"uniqueIndex:idx_record_version" json:"version"`
+	AuthorID  uint      `json:"author_id"`
+	Reason    string    `json:"reason"`  // 签署 / 修订原因
+	Content   string    `json:"content"` // RecordContent 的 JSON 快照
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Attachment 病历附件 (检查报告、影像、化验单扫描件)
+// 文件内容按 SHA-256 存储，相同内容只存一份
+type Attachment struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
-	BookingID    uint      `json:"booking_id"`
-	Diagnosis    string    `json:"diagnosis"`    // 诊断结果
-	Prescription string    `json:"prescription"` // 处方内容 (简化为字符串)
+	OrgID        uint      `gorm:"index" json:"org_id"` // 所属机构
+	RecordID     uint      `gorm:"index" json:"record_id"`
+	FileName     string    `json:"file_name"`
+	MimeType     string    `json:"mime_type"` // 服务端嗅探得到，不信任客户端声明
+	Size         int64     `json:"size"`
+	SHA256       string    `gorm:"index" json:"sha256"`
+	BlobKey      string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	HasThumbnail bool      `json:"has_thumbnail"`
+	UploadedBy   uint      `json:"uploaded_by"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// RecordContent 病历的临床内容，用于版本快照与对比
+type RecordContent struct {
+	ChiefComplaint string   `json:"chief_complaint"`
+	PresentIllness string   `json:"present_illness"`
+	PastHistory    string   `json:"past_history"`
+	PhysicalExam   string   `json:"physical_exam"`
+	Vitals         Vitals   `json:"vitals"`
+	Diagnosis      string   `json:"diagnosis"`
+	DiagnosisCodes []string `json:"diagnosis_codes"`
+	Prescription   string   `json:"prescription"`
+}
+
+// Vitals 生命体征 (统一存储为标准单位，0 表示未测量)
+type Vitals struct {
+	SystolicBP  int     `json:"systolic_bp"`  // 收缩压 mmHg
+	DiastolicBP int     `json:"diastolic_bp"` // 舒张压 mmHg
+	HeartRate   int     `json:"heart_rate"`   // 心率 次/分
+	Temperature float64 `json:"temperature"`  // 体温 ℃
+	SpO2        int     `json:"spo2"`         // 血氧饱和度 %
+	Weight      float64 `json:"weight"`       // 体重 kg
+}
+
+// ICD10Code ICD-10 诊断编码字典
+type ICD10Code struct {
+	Code        string `gorm:"primaryKey" json:"code"` // 例如 J06.9
+	Description string `gorm:"index" json:"description"`
+}
+
+// MedicalRecordDiagnosis 病历的编码诊断 (一份病历可有多个诊断，第一个为主诊断)
+type MedicalRecordDiagnosis struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	OrgID         uint   `gorm:"index" json:"org_id"` // 所属机构
+	RecordID      uint   `gorm:"index" json:"record_id"`
+	RecordVersion int    `gorm:"default:1" json:"record_version"` // 所属病历版本，修订时写入新版本的诊断，旧行保留
+	Code          string `gorm:"index" json:"code"`
+	Description   string `json:"description"` // 冗余保存，防止字典更新后历史病历变化
+	IsPrimary     bool   `json:"is_primary"`
+	Sequence      int    `json:"sequence"`
+}
+
 // Order 缴费订单
 type Order struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
+	OrgID       uint      `gorm:"index" json:"org_id"` // 所属机构
 	BookingID   uint      `json:"booking_id"`
 	TotalAmount float64   `json:"total_amount"`
-	Status      string    `json:"status"`      // Unpaid, Paid
-	MedicineID  uint      `json:"medicine_id"` // 简化：关联一个主要药品用于扣库存
+	Status      string    `json:"status"`       // Unpaid, Paid
+	MedicineID  uint      `json:"medicine_id"`  // 简化：关联一个主要药品用于扣库存
+	LabOrderID  uint      `json:"lab_order_id"` // 检验项目的收费行 (与 MedicineID 二选一)
+	AdmissionID uint      `json:"admission_id"` // 住院出院结算 (费用明细见 InpatientCharge)
 	Quantity    int       `json:"quantity"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
-// GeneratePassword 给密码加密
-func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
-	// 增加一层保护：如果密码看起来已经是 bcrypt 哈希（以 $2a$ 开头），则跳过
-	if strings.HasPrefix(u.Password, "$2a$") {
-		return nil
+// PatientInfo 用于匹配患者档案的身份信息
+type PatientInfo struct {
+	Name      string
+	IDCard    string
+	Phone     string
+	Gender    string
+	BirthYear int  // 0 表示未知，见 BirthYearOf
+	UserID    uint // 患者本人自助挂号时的账号
+}
+
+// BirthYearOf 由某一时刻的年龄推算出生年份
+func BirthYearOf(age int, at time.Time) int {
+	if age <= 0 {
+		return 0
+	}
+	return at.Year() - age
+}
+
+// MatchPatient 查找同一人的患者档案，找不到时返回 gorm.ErrRecordNotFound，
+// 以及是否存在无法确认的同名档案 (新建档案时据此标记待核对)
+// 身份证号或本人账号一致即为同一人；否则只有姓名相同、且电话或 性别 + 年龄 也一致时才归并，
+// 身份证号不同的档案绝不归并 (同名不同人合并后病历、预交金都会串)
+func MatchPatient(tx *gorm.DB, info PatientInfo) (Patient, bool, error) {
+	var patient Patient
+	var err error
+	switch {
+	case info.IDCard != "":
+		err = tx.Where("id_card = ?", info.IDCard).First(&patient).Error
+	case info.UserID != 0:
+		err = tx.Where("user_id = ?", info.UserID).Order("id asc").First(&patient).Error
+	default:
+		err = gorm.ErrRecordNotFound
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return patient, false, err
+	}
+
+	// 同名候选：已登记身份证号的只在本次也没有身份证号时考虑，已绑定其他账号的不考虑
+	var candidates []Patient
+	q := tx.Where("name = ?", info.Name)
+	if info.IDCard != "" {
+		q = q.Where("id_card = '' OR id_card IS NULL")
+	}
+	if info.UserID != 0 {
+		q = q.Where("user_id = 0 OR user_id IS NULL")
+	}
+	if err := q.Order("id asc").Find(&candidates).Error; err != nil {
+		return patient, false, err
+	}
+	var matched []Patient
+	for _, p := range candidates {
+		if sameIdentity(p, info) {
+			matched = append(matched, p)
+		}
+	}
+	if len(matched) == 1 {
+		return matched[0], false, nil
+	}
+	return patient, len(candidates) > 0, gorm.ErrRecordNotFound
+}
+
+// FindOrCreatePatient 按 MatchPatient 查找患者档案并补全缺失的信息，找不到则新建
+// 同名但无法确认是同一人的新建为单独档案并标记待核对，由人工合并
+func FindOrCreatePatient(tx *gorm.DB, info PatientInfo) (Patient, error) {
+	patient, ambiguous, err := MatchPatient(tx, info)
+	if err == nil {
+		updates := map[string]interface{}{}
+		if info.Phone != "" && patient.Phone == "" {
+			updates["phone"] = info.Phone
+		}
+		if info.IDCard != "" && patient.IDCard == "" {
+			updates["id_card"] = info.IDCard
+		}
+		if info.Gender != "" && patient.Gender == "" {
+			updates["gender"] = info.Gender
+		}
+		if info.BirthYear != 0 && patient.BirthYear == 0 {
+			updates["birth_year"] = info.BirthYear
+		}
+		if info.UserID != 0 && patient.UserID == 0 {
+			updates["user_id"] = info.UserID
+		}
+		if len(updates) > 0 {
+			err = tx.Model(&patient).Updates(updates).Error
+		}
+		return patient, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return patient, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	patient = Patient{
+		Name:        info.Name,
+		Phone:       info.Phone,
+		IDCard:      info.IDCard,
+		Gender:      info.Gender,
+		BirthYear:   info.BirthYear,
+		UserID:      info.UserID,
+		NeedsReview: ambiguous,
+		CreatedAt:   time.Now(),
+	}
+	err = tx.Create(&patient).Error
+	return patient, err
+}
+
+// sameIdentity 同名档案是否有第二项身份信息一致：电话相同，或性别相同且出生年份相差不超过一年
+// 电话都已登记但不同时不归并
+func sameIdentity(p Patient, info PatientInfo) bool {
+	if p.Phone != "" && info.Phone != "" {
+		return p.Phone == info.Phone
+	}
+	if p.Gender == "" || info.Gender == "" || p.BirthYear == 0 || info.BirthYear == 0 {
+		return false
+	}
+	diff := p.BirthYear - info.BirthYear
+	return p.Gender == info.Gender && diff >= -1 && diff <= 1
+}
+
+// SetPassword 加密并设置新密码，创建用户、修改 / 重置密码都走这里
+func (u *User) SetPassword(password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
+	now := time.Now()
 	u.Password = string(hashedPassword)
+	u.PasswordChangedAt = &now
 	return nil
 }
 
+// BeforeSave 兜底：Password 里放的是明文时 (例如直接 Create)，写库前统一加密
+func (u *User) BeforeSave(tx *gorm.DB) (err error) {
+	if isPasswordHash(u.Password) {
+		return nil
+	}
+	return u.SetPassword(u.Password)
+}
+
+// isPasswordHash 是否已经是 bcrypt 哈希 ($2a$ / $2b$ / $2y$ 开头且格式完整)
+func isPasswordHash(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
+
 // CheckPassword 验证密码
 func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
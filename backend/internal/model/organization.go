@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// DefaultOrgID 默认机构 (总院)，单机构部署时所有数据都属于它
+const DefaultOrgID = 1
+
+// Organization 机构 (院区)
+// 业务数据按 OrgID 隔离，见 database.Tenant
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;not null" json:"name"`
+	Code      string    `gorm:"index" json:"code"` // 机构编码，例如区域平台分配的编号
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// Role 角色：一组权限 (权限点定义见 internal/authz)，管理员可在后台修改，无需重新编译
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;not null" json:"name"` // 与 User.Role 对应，例如 doctor
+	Label       string    `json:"label"`                            // 显示名称，例如 医生
+	Description string    `json:"description"`
+	Builtin     bool      `json:"builtin"`    // 系统内置角色，不能删除
+	Customized  bool      `json:"customized"` // 内置角色被管理员改过权限后，升级时不再用默认权限覆盖
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Permissions []string `gorm:"-" json:"permissions"`
+}
+
+// RolePermission 角色拥有的权限点
+type RolePermission struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	Role       string `gorm:"uniqueIndex:idx_role_permission;not null" json:"role"`
+	Permission string `gorm:"uniqueIndex:idx_role_permission;not null" json:"permission"`
+}
+
+// RoleGrant 管理员角色授予申请，需另一位管理员审批后生效
+// 生命周期: Pending (待审批) -> Approved (已生效) / Rejected (驳回或撤回) / Expired (用户角色已变化或账号已删除)
+type RoleGrant struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	OrgID         uint       `gorm:"index" json:"org_id"` // 所属机构 (与目标用户一致)
+	UserID        uint       `gorm:"index" json:"user_id"`
+	Username      string     `json:"username"`
+	FromRole      string     `json:"from_role"` // 申请时的角色，审批时不一致则申请失效
+	ToRole        string     `json:"to_role"`
+	Status        string     `gorm:"default:Pending;index" json:"status"`
+	RequestedBy   uint       `json:"requested_by"`
+	RequesterName string     `json:"requester_name"`
+	DecidedBy     uint       `json:"decided_by"`
+	DeciderName   string     `json:"decider_name"`
+	DecidedAt     *time.Time `json:"decided_at"`
+	Reason        string     `json:"reason"` // 驳回原因
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Referral 转诊 (科室间 / 医生间)
+// 原挂号单与转入后生成的新挂号单通过 FromBookingID / ToBookingID 关联
+type Referral struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrgID          uint      `gorm:"index" json:"org_id"` // 所属机构
+	FromBookingID  uint      `gorm:"index" json:"from_booking_id"`
+	ToBookingID    uint      `gorm:"index" json:"to_booking_id"`
+	PatientID      uint      `gorm:"index" json:"patient_id"`
+	FromDoctorID   uint      `json:"from_doctor_id"`
+	FromDepartment string    `json:"from_department"`
+	ToDoctorID     uint      `json:"to_doctor_id"` // 0 表示转入科室候诊池，由该科室医生叫号时认领
+	ToDepartment   string    `json:"to_department"`
+	Reason         string    `json:"reason"`
+	Notes          string    `json:"notes"`
+	Context        string    `json:"-"` // ReferralContext 的 JSON 快照
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ReferralContext 转诊时随附的就诊信息
+type ReferralContext struct {
+	RecordID   uint           `json:"record_id,omitempty"`
+	Record     *RecordContent `json:"record,omitempty"`
+	Triage     *TriageRecord  `json:"triage,omitempty"`
+	LabResults []LabOrder     `json:"lab_results"`
+}
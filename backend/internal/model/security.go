@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// SecurityEvent 安全审计日志 (登录、令牌、密码、账号变更)，只追加
+type SecurityEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Type      string    `gorm:"index" json:"type"`     // 见 api/security.go 中的事件类型
+	Username  string    `gorm:"index" json:"username"` // 事件涉及的账号 (目标)
+	UserID    uint      `gorm:"index" json:"user_id"`  // 用户不存在时为 0
+	ActorID   uint      `gorm:"index" json:"actor_id"` // 操作人，未登录的请求 (登录、刷新令牌) 为 0
+	ActorName string    `json:"actor_name"`
+	IP        string    `gorm:"index" json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// LoginThrottle 登录失败计数 (按用户名、按 IP 各一条)
+// 每次失败后需等待的时间按 2 的幂增长，连续失败达到上限后锁定，再次锁定时锁定时长翻倍
+type LoginThrottle struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Key           string     `gorm:"uniqueIndex" json:"key"` // user:<用户名> 或 ip:<地址>
+	Failures      int        `json:"failures"`               // 当前窗口内连续失败次数
+	LockCount     int        `json:"lock_count"`             // 已被锁定次数，决定下次锁定时长
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Session 登录会话
+// 访问令牌 (JWT) 有效期很短并带有会话 ID (sid)，过期后凭刷新令牌换发；
+// 刷新令牌每次使用都会轮换，数据库只保存其 SHA-256
+type Session struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"index" json:"user_id"`
+	RefreshHash     string     `gorm:"uniqueIndex" json:"-"` // 当前刷新令牌的哈希
+	PrevRefreshHash string     `gorm:"index" json:"-"`       // 上一个已轮换的刷新令牌，再次出现说明令牌泄露
+	IP              string     `json:"ip"`
+	UserAgent       string     `json:"user_agent"`
+	ExpiresAt       time.Time  `json:"expires_at"` // 会话绝对过期时间，刷新不会延长
+	LastUsedAt      time.Time  `json:"last_used_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	RevokeReason    string     `json:"revoke_reason"` // logout, logout_all, admin, role_changed, user_deleted, refresh_reuse, password_changed, password_reset
+	CreatedAt       time.Time  `json:"created_at"`
+}
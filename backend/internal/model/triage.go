@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// TriageRecord 急诊分诊记录 (每次分诊/复评一条，保留历史)
+// 分级采用 5 级：1 级最危重，5 级非紧急
+type TriageRecord struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"index" json:"org_id"` // 所属机构
+	BookingID uint      `gorm:"index" json:"booking_id"`
+	Level     int       `json:"level"`
+	Complaint string    `json:"complaint"` // 主诉
+	Vitals    Vitals    `gorm:"embedded;embeddedPrefix:vital_" json:"vitals"`
+	Reason    string    `json:"reason"` // 复评原因，首次分诊为空
+	TriagedBy uint      `json:"triaged_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,297 @@
+// Package ssostandin 本地联调和测试用的目录服务 + OIDC 身份提供方，不要在生产环境使用 (见 cmd/sso-standin)
+//
+// 演示账号 (密码均为 DemoPassword):
+//
+//	zhangsan  组 doctors，科室 内科
+//	lisi      组 finance
+//	wangwu    不属于任何映射组 (应被拒绝登录)
+package ssostandin
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"hospital-system/internal/ldap"
+	"hospital-system/internal/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	BaseDN           = "dc=hospital,dc=local"
+	ReadonlyDN       = "cn=readonly," + BaseDN
+	ReadonlyPassword = "readonly"
+	DemoPassword     = "Standin-2026"
+)
+
+type demoUser struct {
+	UID        string
+	Name       string
+	Department string
+	Groups     []string
+}
+
+var users = []demoUser{
+	{UID: "zhangsan", Name: "张三", Department: "内科", Groups: []string{"doctors"}},
+	{UID: "lisi", Name: "李四", Department: "财务科", Groups: []string{"finance"}},
+	{UID: "wangwu", Name: "王五", Department: "后勤"},
+}
+
+func (u demoUser) dn() string { return "uid=" + u.UID + ",ou=people," + BaseDN }
+
+func (u demoUser) groupDNs() []string {
+	var dns []string
+	for _, g := range u.Groups {
+		dns = append(dns, "cn="+g+",ou=groups,"+BaseDN)
+	}
+	return dns
+}
+
+func (u demoUser) entry() *ldap.Entry {
+	return &ldap.Entry{DN: u.dn(), Attributes: map[string][]string{
+		"objectClass":      {"inetOrgPerson"},
+		"uid":              {u.UID},
+		"cn":               {u.Name},
+		"departmentNumber": {u.Department},
+		"memberOf":         u.groupDNs(),
+	}}
+}
+
+func findUser(uid string) (demoUser, bool) {
+	for _, u := range users {
+		if strings.EqualFold(u.UID, uid) {
+			return u, true
+		}
+	}
+	return demoUser{}, false
+}
+
+func checkPassword(password string) bool {
+	return subtle.ConstantTimeCompare([]byte(password), []byte(DemoPassword)) == 1
+}
+
+// NewLDAPServer 演示目录：服务账号 cn=readonly 可以查找，演示账号用 DemoPassword bind
+func NewLDAPServer(addr string) *ldap.Server {
+	return &ldap.Server{
+		Addr: addr,
+		Bind: func(dn, password string) bool {
+			if strings.EqualFold(dn, ReadonlyDN) {
+				return password == ReadonlyPassword
+			}
+			for _, u := range users {
+				if strings.EqualFold(dn, u.dn()) {
+					return checkPassword(password)
+				}
+			}
+			return false
+		},
+		Search: func(base string, filter *ldap.Filter) []*ldap.Entry {
+			var out []*ldap.Entry
+			for _, u := range users {
+				e := u.entry()
+				if strings.HasSuffix(strings.ToLower(e.DN), strings.ToLower(base)) && filter.Match(e) {
+					out = append(out, e)
+				}
+			}
+			return out
+		},
+	}
+}
+
+// --- OIDC 身份提供方 ---
+
+type authCode struct {
+	User        demoUser
+	ClientID    string
+	RedirectURI string
+	Nonce       string
+	Challenge   string
+	ExpiresAt   time.Time
+}
+
+type IdP struct {
+	issuer, clientID, clientSecret string
+	key                            *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+// NewIdP 演示 OIDC 身份提供方 (每次启动生成新的签名密钥)
+func NewIdP(issuer, clientID, clientSecret string) (*IdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &IdP{issuer: issuer, clientID: clientID, clientSecret: clientSecret, key: key, codes: map[string]authCode{}}, nil
+}
+
+// Handler 发现文档、登录页、令牌和 JWKS 端点
+func (p *IdP) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (p *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<meta charset="utf-8"><title>统一身份认证 (联调)</title>
+<form method="post" style="max-width:320px;margin:80px auto;font-family:sans-serif">
+<h3>统一身份认证 (联调)</h3>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">{{end}}
+<p><input name="username" placeholder="用户名" autofocus></p>
+<p><input name="password" type="password" placeholder="密码"></p>
+<p><button>登录</button></p>
+</form>`))
+
+// authorize GET 显示登录页，POST 校验账号后带授权码跳回 redirect_uri
+func (p *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	params := url.Values{}
+	for _, k := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		params.Set(k, r.Form.Get(k))
+	}
+	if params.Get("client_id") != p.clientID || params.Get("response_type") != "code" || params.Get("redirect_uri") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if params.Get("code_challenge") == "" || params.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE (S256) required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		loginPage.Execute(w, map[string]interface{}{"Params": params})
+		return
+	}
+	user, ok := findUser(r.PostForm.Get("username"))
+	if !ok || !checkPassword(r.PostForm.Get("password")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		loginPage.Execute(w, map[string]interface{}{"Params": params, "Error": "用户名或密码错误"})
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "server_error", http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	p.codes[code] = authCode{
+		User:        user,
+		ClientID:    params.Get("client_id"),
+		RedirectURI: params.Get("redirect_uri"),
+		Nonce:       params.Get("nonce"),
+		Challenge:   params.Get("code_challenge"),
+		ExpiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	q := url.Values{"code": {code}, "state": {params.Get("state")}}
+	http.Redirect(w, r, params.Get("redirect_uri")+"?"+q.Encode(), http.StatusFound)
+}
+
+// token 授权码换 ID Token (client_secret_basic / client_secret_post，强制 PKCE)
+func (p *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != p.clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(p.clientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	ac, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || time.Now().After(ac.ExpiresAt) || ac.ClientID != id || ac.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != ac.Challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE 校验失败"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.issuer,
+		"sub":                "standin-" + ac.User.UID,
+		"aud":                id,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              ac.Nonce,
+		"preferred_username": ac.User.UID,
+		"name":               ac.User.Name,
+		"department":         ac.User.Department,
+		"groups":             ac.User.Groups,
+	})
+	idToken.Header["kid"] = "standin"
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "standin-" + ac.User.UID,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func (p *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "standin",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
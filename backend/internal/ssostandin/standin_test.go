@@ -0,0 +1,183 @@
+package ssostandin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hospital-system/internal/ldap"
+	"hospital-system/internal/oidc"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 在进程内启动联调目录和身份提供方，用 internal/ldap、internal/oidc 的客户端走一遍登录流程
+
+// startLDAP 在随机端口启动演示目录，返回 ldap:// 地址
+func startLDAP(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewLDAPServer("").Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return "ldap://" + ln.Addr().String()
+}
+
+// startIdP 在随机端口启动演示身份提供方，issuer 为其地址
+func startIdP(t *testing.T, clientID, clientSecret string) string {
+	t.Helper()
+	var handler http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler.ServeHTTP(w, r) }))
+	t.Cleanup(srv.Close)
+	idp, err := NewIdP(srv.URL, clientID, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler = idp.Handler()
+	return srv.URL
+}
+
+func dialLDAP(t *testing.T, addr string) *ldap.Conn {
+	t.Helper()
+	conn, err := ldap.Dial(addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestLDAPBind(t *testing.T) {
+	addr := startLDAP(t)
+
+	conn := dialLDAP(t, addr)
+	if err := conn.Bind(ReadonlyDN, ReadonlyPassword); err != nil {
+		t.Fatalf("service bind: %v", err)
+	}
+	if err := conn.Bind("uid=zhangsan,ou=people,"+BaseDN, DemoPassword); err != nil {
+		t.Errorf("user bind: %v", err)
+	}
+
+	for _, password := range []string{"wrong-password", ""} {
+		err := dialLDAP(t, addr).Bind("uid=zhangsan,ou=people,"+BaseDN, password)
+		if !errors.Is(err, ldap.ErrInvalidCredentials) {
+			t.Errorf("bind with %q: err = %v, want ErrInvalidCredentials", password, err)
+		}
+	}
+	if err := dialLDAP(t, addr).Bind("uid=nobody,ou=people,"+BaseDN, DemoPassword); !errors.Is(err, ldap.ErrInvalidCredentials) {
+		t.Errorf("bind unknown dn: err = %v", err)
+	}
+}
+
+func TestLDAPFilterEscaping(t *testing.T) {
+	conn := dialLDAP(t, startLDAP(t))
+	if err := conn.Bind(ReadonlyDN, ReadonlyPassword); err != nil {
+		t.Fatal(err)
+	}
+	search := func(filter string) int {
+		t.Helper()
+		entries, err := conn.Search(ldap.SearchRequest{BaseDN: BaseDN, Filter: filter, Attributes: []string{"uid"}})
+		if err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+		return len(entries)
+	}
+
+	if n := search(fmt.Sprintf("(uid=%s)", ldap.EscapeFilter("zhangsan"))); n != 1 {
+		t.Errorf("zhangsan: %d entries", n)
+	}
+	// 不转义时 * 会匹配所有账号
+	if n := search("(uid=*)"); n != len(users) {
+		t.Errorf("unescaped *: %d entries, want %d", n, len(users))
+	}
+	for _, login := range []string{"*", "zhangsan)(uid=*", "*)(|(uid=*", `zhang\san`} {
+		if n := search(fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(login))); n != 0 {
+			t.Errorf("escaped %q matched %d entries", login, n)
+		}
+	}
+
+	// 转义后解析回原值
+	raw := `a*b(c)\d` + "\x00"
+	f, err := ldap.ParseFilter("(uid=" + ldap.EscapeFilter(raw) + ")")
+	if err != nil || f.Value != raw {
+		t.Errorf("round trip: %+v %v", f, err)
+	}
+}
+
+// authorize 以演示账号登录 IdP，返回回调地址中的授权码
+func authorize(t *testing.T, p *oidc.Provider, username, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(authURL, url.Values{"username": {username}, "password": {DemoPassword}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil {
+		t.Fatalf("authorize: %d %v", resp.StatusCode, err)
+	}
+	if loc.Query().Get("state") != "state-1" {
+		t.Errorf("state not echoed: %s", loc)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestOIDCCodeFlow(t *testing.T) {
+	issuer := startIdP(t, "hospital-system", "standin-secret")
+	p := oidc.New(issuer, "hospital-system", "standin-secret", "http://app.local/callback", nil)
+	ctx := context.Background()
+
+	code := authorize(t, p, "zhangsan", "nonce-1", "verifier-1")
+	raw, err := p.Exchange(ctx, code, "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Verify(ctx, raw, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["preferred_username"] != "zhangsan" || claims["sub"] != "standin-zhangsan" {
+		t.Errorf("claims %v", claims)
+	}
+
+	// 授权码只能用一次
+	if _, err := p.Exchange(ctx, code, "verifier-1"); err == nil {
+		t.Error("authorization code reused")
+	}
+	// PKCE：verifier 与 challenge 不符
+	code = authorize(t, p, "lisi", "nonce-2", "verifier-2")
+	if _, err := p.Exchange(ctx, code, "another-verifier"); err == nil {
+		t.Error("exchange accepted a wrong code_verifier")
+	}
+
+	code = authorize(t, p, "lisi", "nonce-3", "verifier-3")
+	raw, err = p.Exchange(ctx, code, "verifier-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nonce 不一致 (回调中的 ID Token 不属于这次登录)
+	if _, err := p.Verify(ctx, raw, "nonce-other"); err == nil {
+		t.Error("ID token accepted with a different nonce")
+	}
+	// aud 不是本系统的 client_id
+	other := oidc.New(issuer, "other-client", "standin-secret", "http://app.local/callback", nil)
+	if _, err := other.Verify(ctx, raw, "nonce-3"); err == nil {
+		t.Error("ID token for another client accepted")
+	}
+	// 客户端密钥错误
+	bad := oidc.New(issuer, "hospital-system", "wrong-secret", "http://app.local/callback", nil)
+	code = authorize(t, p, "lisi", "nonce-4", "verifier-4")
+	if _, err := bad.Exchange(ctx, code, "verifier-4"); err == nil {
+		t.Error("exchange accepted a wrong client secret")
+	}
+}
@@ -0,0 +1,144 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// key 一把签名密钥；sign 为空表示只用于验证
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+func newHMACKey(id string, secret []byte) *key {
+	return &key{id: id, method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// loadKey 按配置加载密钥；私钥文件不存在时生成一把新的并写入该路径
+func loadKey(kc config.SigningKey) (*key, error) {
+	switch kc.Alg {
+	case "HS256":
+		if kc.Secret == "" {
+			return nil, errors.New("HS256 密钥需要 secret")
+		}
+		return newHMACKey(kc.Kid, []byte(kc.Secret)), nil
+	case "EdDSA":
+		k := &key{id: kc.Kid, method: jwt.SigningMethodEdDSA}
+		if kc.PrivateKey != "" {
+			data, err := readOrGenerate(kc.PrivateKey, generateEd25519)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			k.sign = priv
+			k.verify = priv.(ed25519.PrivateKey).Public()
+			return k, nil
+		}
+		data, err := os.ReadFile(kc.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if k.verify, err = jwt.ParseEdPublicKeyFromPEM(data); err != nil {
+			return nil, err
+		}
+		return k, nil
+	case "RS256":
+		k := &key{id: kc.Kid, method: jwt.SigningMethodRS256}
+		if kc.PrivateKey != "" {
+			data, err := readOrGenerate(kc.PrivateKey, generateRSA)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			k.sign = priv
+			k.verify = &priv.PublicKey
+			return k, nil
+		}
+		data, err := os.ReadFile(kc.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if k.verify, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, err
+		}
+		return k, nil
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %q (可选 HS256, EdDSA, RS256)", kc.Alg)
+	}
+}
+
+// readOrGenerate 读取 PEM 私钥文件，不存在则生成并以 0600 权限保存
+func readOrGenerate(path string, generate func() (interface{}, error)) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil || !os.IsNotExist(err) {
+		return data, err
+	}
+
+	priv, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	log.Printf("已生成新的签名私钥: %s", path)
+	return data, nil
+}
+
+func generateEd25519() (interface{}, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	return priv, err
+}
+
+func generateRSA() (interface{}, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// jwk 公钥的 JWK 表示 (RFC 7517 / RFC 8037)，对称密钥返回 nil
+func (k *key) jwk() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.verify.(type) {
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": b64(pub), "kid": k.id, "alg": "EdDSA", "use": "sig"}
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   b64(pub.N.Bytes()),
+			"e":   b64(big.NewInt(int64(pub.E)).Bytes()),
+			"kid": k.id,
+			"alg": "RS256",
+			"use": "sig",
+		}
+	}
+	return nil
+}
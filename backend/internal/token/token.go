@@ -0,0 +1,161 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultKid jwt_secret 对应的 HS256 密钥；不带 kid 的旧 Token 也按它验证
+const defaultKid = "default"
+
+// Service 签发与校验访问令牌
+// 只用 active 密钥签发；所有已配置的密钥都可验证，且 Token 的 alg 必须与 kid 对应密钥的算法一致
+type Service struct {
+	AccessTTL  time.Duration // 访问令牌有效期
+	SessionTTL time.Duration // 登录会话 (刷新令牌) 有效期
+	Issuer     string
+
+	active  *key
+	keys    map[string]*key
+	methods []string
+}
+
+// Default 全局令牌服务，由 Init 初始化
+var Default *Service
+
+// Init 按配置初始化全局令牌服务
+func Init(cfg config.Config) error {
+	s, err := NewService(cfg)
+	if err != nil {
+		return err
+	}
+	Default = s
+	return nil
+}
+
+// NewService 加载签名密钥
+func NewService(cfg config.Config) (*Service, error) {
+	auth := cfg.Auth
+	s := &Service{
+		AccessTTL:  15 * time.Minute,
+		SessionTTL: 24 * time.Hour,
+		Issuer:     auth.Issuer,
+		keys:       map[string]*key{},
+	}
+	if auth.AccessExpireMinutes > 0 {
+		s.AccessTTL = time.Duration(auth.AccessExpireMinutes) * time.Minute
+	}
+	if auth.JwtExpireHours > 0 {
+		s.SessionTTL = time.Duration(auth.JwtExpireHours) * time.Hour
+	}
+
+	if auth.JwtSecret != "" {
+		s.add(newHMACKey(defaultKid, []byte(auth.JwtSecret)))
+	}
+	for _, kc := range auth.SigningKeys {
+		if kc.Kid == "" {
+			return nil, errors.New("签名密钥缺少 kid")
+		}
+		if _, dup := s.keys[kc.Kid]; dup {
+			return nil, fmt.Errorf("签名密钥 kid 重复: %s", kc.Kid)
+		}
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("加载签名密钥 %s 失败: %w", kc.Kid, err)
+		}
+		s.add(k)
+	}
+
+	activeKid := auth.ActiveKid
+	if activeKid == "" {
+		activeKid = defaultKid
+		if len(auth.SigningKeys) > 0 {
+			activeKid = auth.SigningKeys[0].Kid
+		}
+	}
+	active, ok := s.keys[activeKid]
+	if !ok {
+		return nil, fmt.Errorf("签发密钥 %q 未配置", activeKid)
+	}
+	if active.sign == nil {
+		return nil, fmt.Errorf("签发密钥 %q 只有公钥，不能签发", activeKid)
+	}
+	s.active = active
+	return s, nil
+}
+
+func (s *Service) add(k *key) {
+	s.keys[k.id] = k
+	for _, m := range s.methods {
+		if m == k.method.Alg() {
+			return
+		}
+	}
+	s.methods = append(s.methods, k.method.Alg())
+}
+
+// Sign 签发访问令牌，自动补上 iat / exp / iss，并在头部写入 kid
+func (s *Service) Sign(claims jwt.MapClaims) (string, error) {
+	return s.SignWithTTL(claims, s.AccessTTL)
+}
+
+// SignWithTTL 按指定有效期签发 (例如两步验证前的临时令牌)
+func (s *Service) SignWithTTL(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	if s.Issuer != "" {
+		claims["iss"] = s.Issuer
+	}
+
+	t := jwt.NewWithClaims(s.active.method, claims)
+	t.Header["kid"] = s.active.id
+	return t.SignedString(s.active.sign)
+}
+
+// Parse 校验访问令牌并返回声明
+func (s *Service) Parse(tokenString string) (jwt.MapClaims, error) {
+	opts := []jwt.ParserOption{jwt.WithValidMethods(s.methods), jwt.WithExpirationRequired()}
+	if s.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.Issuer))
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, s.keyFunc, opts...); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// keyFunc 按 kid 找验证密钥，并拒绝与密钥算法不一致的 Token (防止算法混淆攻击)
+func (s *Service) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = defaultKid
+	}
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("签名算法不匹配: %s", t.Method.Alg())
+	}
+	return k.verify, nil
+}
+
+// JWKS 非对称密钥的公钥集合 (HS256 共享密钥不对外公开)
+func (s *Service) JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+	for _, k := range s.keys {
+		if jwk := k.jwk(); jwk != nil {
+			keys = append(keys, jwk)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["kid"] < keys[j]["kid"] })
+	return map[string]interface{}{"keys": keys}
+}
@@ -7,6 +7,7 @@ import Home from './pages/Home';
 import Login from './pages/Login';
 import Register from './pages/Register';
 import Experts from './pages/Experts';
+import ChangePassword from './pages/ChangePassword';
 
 // 业务页面组件
 import Overview from './pages/dashboard/Overview';
@@ -27,6 +28,11 @@ function App() {
         <Route path="/login" element={<Login />} />
         <Route path="/register" element={<Register />} />
         <Route path="/experts" element={<Experts />} />
+        <Route path="/change-password" element={
+          <ProtectedRoute>
+            <ChangePassword />
+          </ProtectedRoute>
+        } />
         {/* 2. 受保护的 Dashboard */}
         <Route path="/dashboard" element={
           <ProtectedRoute>
@@ -4,6 +4,7 @@ export const ROLES = {
   FINANCE: 'finance',             // 财务：缴费与收支
   STOREKEEPER: 'storekeeper',     // 库管：物资进销存
   DOCTOR: 'doctor',               // 医生：接诊、开处方、病历
+  LAB: 'lab',                     // 检验科：标本采集、结果录入
   REGISTRATION: 'registration',   // 挂号员：患者登记
   GENERAL_USER: 'general_user'    // 普通用户：查看本人病历、缴费记录
 };
\ No newline at end of file
@@ -1,8 +1,9 @@
 import React, { useState } from 'react';
 import { Layout, Menu, Button, theme, Dropdown, Space } from 'antd';
 import { Outlet, useNavigate, useLocation } from 'react-router-dom';
-import { MenuFoldOutlined, MenuUnfoldOutlined, UserOutlined, LogoutOutlined } from '@ant-design/icons';
+import { MenuFoldOutlined, MenuUnfoldOutlined, UserOutlined, LogoutOutlined, LockOutlined } from '@ant-design/icons';
 import { menuConfig } from '../config/menuConfig';
+import request from '../utils/request';
 
 const { Header, Sider, Content } = Layout;
 
@@ -25,12 +26,15 @@ const DashboardLayout = () => {
             label: item.label,
         }));
 
-    const handleLogout = () => {
+    const handleLogout = async () => {
+        // 通知后端作废当前会话，失败也不影响本地退出
+        await request.post('/dashboard/logout').catch(() => {});
         localStorage.clear();
         navigate('/login');
     };
 
     const userMenuItems = [
+        { key: 'password', label: '修改密码', icon: <LockOutlined />, onClick: () => navigate('/change-password') },
         { key: 'logout', label: '退出登录', icon: <LogoutOutlined />, onClick: handleLogout }
     ];
 
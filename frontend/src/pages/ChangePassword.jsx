@@ -0,0 +1,86 @@
+import React, { useState } from 'react';
+import { Form, Input, Button, Card, Typography, message, Alert } from 'antd';
+import { LockOutlined } from '@ant-design/icons';
+import { useNavigate } from 'react-router-dom';
+import request from '../utils/request';
+
+const { Title, Text } = Typography;
+
+// 修改密码：管理员重置后首次登录会被引导到这里
+const ChangePassword = () => {
+    const [loading, setLoading] = useState(false);
+    const navigate = useNavigate();
+    const forced = localStorage.getItem('must_change_password') === 'true';
+
+    const onFinish = async ({ old_password, new_password }) => {
+        setLoading(true);
+        try {
+            // 修改成功后其他设备下线，当前设备换发新的会话
+            const { token, refresh_token } = await request.post('/dashboard/password', { old_password, new_password });
+            localStorage.setItem('token', token);
+            localStorage.setItem('refresh_token', refresh_token);
+            localStorage.removeItem('must_change_password');
+
+            message.success('密码已修改');
+            navigate('/dashboard/overview');
+        } catch (error) {
+            message.error(error.response?.data?.error || '修改失败');
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    return (
+        <div style={{ height: '100vh', display: 'flex', justifyContent: 'center', alignItems: 'center', background: '#f0f2f5' }}>
+            <Card style={{ width: 450, borderRadius: 12, boxShadow: '0 8px 24px rgba(0,0,0,0.1)' }}>
+                <div style={{ textAlign: 'center', marginBottom: 24 }}>
+                    <Title level={2} style={{ color: '#1677ff', marginBottom: 8 }}>修改密码</Title>
+                    <Text type="secondary">修改后其他设备上的登录将失效</Text>
+                </div>
+
+                {forced && <Alert type="warning" showIcon message="管理员已重置您的密码，请先设置新密码" style={{ marginBottom: 24 }} />}
+
+                <Form name="change_password_form" onFinish={onFinish} size="large" layout="vertical">
+                    <Form.Item name="old_password" label="当前密码" rules={[{ required: true, message: '请输入当前密码' }]}>
+                        <Input.Password prefix={<LockOutlined />} placeholder="当前密码 / 临时密码" />
+                    </Form.Item>
+
+                    <Form.Item
+                        name="new_password"
+                        label="新密码"
+                        rules={[{ required: true, message: '请输入新密码' }, { min: 8, message: '密码至少8位' }]}
+                    >
+                        <Input.Password prefix={<LockOutlined />} placeholder="至少8位，包含字母和数字" />
+                    </Form.Item>
+
+                    <Form.Item
+                        name="confirm"
+                        label="确认新密码"
+                        dependencies={['new_password']}
+                        rules={[
+                            { required: true, message: '请再次输入新密码' },
+                            ({ getFieldValue }) => ({
+                                validator(_, value) {
+                                    if (!value || getFieldValue('new_password') === value) {
+                                        return Promise.resolve();
+                                    }
+                                    return Promise.reject(new Error('两次输入的密码不匹配'));
+                                },
+                            }),
+                        ]}
+                    >
+                        <Input.Password prefix={<LockOutlined />} placeholder="请再次输入新密码" />
+                    </Form.Item>
+
+                    <Form.Item>
+                        <Button type="primary" htmlType="submit" block loading={loading}>
+                            确认修改
+                        </Button>
+                    </Form.Item>
+                </Form>
+            </Card>
+        </div>
+    );
+};
+
+export default ChangePassword;
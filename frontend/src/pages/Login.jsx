@@ -1,14 +1,82 @@
-import { useState } from 'react';
-import { Form, Input, Button, Card, Typography, message, Row, Col } from 'antd';
-import { UserOutlined, LockOutlined, ArrowLeftOutlined } from '@ant-design/icons';
-import { useNavigate } from 'react-router-dom';
+import { useState, useEffect } from 'react';
+import { Form, Input, Button, Card, Typography, message, Row, Col, QRCode, Modal } from 'antd';
+import { UserOutlined, LockOutlined, ArrowLeftOutlined, SafetyOutlined, TeamOutlined } from '@ant-design/icons';
+import { useNavigate, useSearchParams } from 'react-router-dom';
 import request from '../utils/request';
 
 const { Title, Text } = Typography;
 
 const Login = () => {
     const [loading, setLoading] = useState(false);
+    // 两步验证：{ token, setup, uri, secret }
+    const [mfa, setMfa] = useState(null);
+    // 统一身份认证 (OIDC) 是否可用
+    const [ssoEnabled, setSsoEnabled] = useState(false);
     const navigate = useNavigate();
+    const [searchParams, setSearchParams] = useSearchParams();
+
+    useEffect(() => {
+        request.get('/sso/providers').then((res) => setSsoEnabled(res.oidc)).catch(() => {});
+    }, []);
+
+    // OIDC 登录回来：用一次性 sso_code 换 Token
+    useEffect(() => {
+        const ssoError = searchParams.get('sso_error');
+        const ssoCode = searchParams.get('sso_code');
+        if (!ssoError && !ssoCode) return;
+        setSearchParams({}, { replace: true });
+        if (ssoError) {
+            message.error(ssoError);
+            return;
+        }
+        setLoading(true);
+        request.post('/sso/exchange', { code: ssoCode })
+            .then(handleLoginResponse)
+            .catch((error) => message.error(error.response?.data?.error || '登录失败'))
+            .finally(() => setLoading(false));
+        // eslint-disable-next-line react-hooks/exhaustive-deps
+    }, []);
+
+    // 登录完成：保存 Token 并跳转
+    const completeLogin = ({ token, refresh_token, user, must_change_password }) => {
+        localStorage.setItem('token', token);
+        localStorage.setItem('refresh_token', refresh_token);
+        localStorage.setItem('role', user.role);
+        localStorage.setItem('username', user.username);
+
+        message.success('登录成功');
+
+        // 管理员重置过密码：先去修改密码
+        if (must_change_password) {
+            localStorage.setItem('must_change_password', 'true');
+            navigate('/change-password');
+            return;
+        }
+
+        // 根据角色跳转逻辑保持不变  110]
+        if (user.role === 'registration') {
+            navigate('/dashboard/bookings');
+        } else {
+            navigate('/dashboard/overview');
+        }
+    };
+
+    // 密码登录和统一身份认证登录的后续步骤相同
+    const handleLoginResponse = async (res) => {
+        // 已开启两步验证：输入动态码
+        if (res.mfa_required) {
+            setMfa({ token: res.mfa_token });
+            return;
+        }
+        // 角色要求两步验证但未绑定：先扫码绑定
+        if (res.mfa_setup_required) {
+            const setup = await request.post('/login/mfa/setup', { mfa_token: res.mfa_token });
+            setMfa({ token: res.mfa_token, setup: true, uri: setup.otpauth_uri, secret: setup.secret });
+            return;
+        }
+
+        completeLogin(res);
+    };
 
     // 提交登录表单
     const onFinish = async (values) => {
@@ -16,20 +84,8 @@ const Login = () => {
         try {
             // 2. 使用封装好的 request，它会自动加上 /api/v1 前缀
             // 3. 因为拦截器写了 return response.data，这里直接解构即可
-            const { token, user } = await request.post('/login', values);
-
-            localStorage.setItem('token', token);
-            localStorage.setItem('role', user.role);
-            localStorage.setItem('username', user.username);
-
-            message.success('登录成功');
-
-            // 根据角色跳转逻辑保持不变  110]
-            if (user.role === 'registration') {
-                navigate('/dashboard/bookings');
-            } else {
-                navigate('/dashboard/overview');
-            }
+            const res = await request.post('/login', values);
+            await handleLoginResponse(res);
         } catch (error) {
             // 此时 error.response.data 依然有效
             const errorMsg = error.response?.data?.error || '登录失败';
@@ -39,6 +95,34 @@ const Login = () => {
         }
     };
 
+    // 提交动态码 / 恢复码
+    const onVerify = async ({ code }) => {
+        setLoading(true);
+        try {
+            const res = await request.post('/login/mfa', { mfa_token: mfa.token, code });
+            if (res.recovery_codes) {
+                // 恢复码只显示这一次
+                Modal.info({
+                    title: '请保存恢复码',
+                    content: (
+                        <div>
+                            <p>手机丢失时可用恢复码代替动态码登录，每个只能使用一次：</p>
+                            <pre>{res.recovery_codes.join('\n')}</pre>
+                        </div>
+                    ),
+                    onOk: () => completeLogin(res),
+                });
+                return;
+            }
+            completeLogin(res);
+        } catch (error) {
+            const errorMsg = error.response?.data?.error || '验证失败';
+            message.error(errorMsg);
+        } finally {
+            setLoading(false);
+        }
+    };
+
     return (
         <div style={{
             height: '100vh',
@@ -53,45 +137,80 @@ const Login = () => {
                     <Text type="secondary">智慧医疗管理系统</Text>
                 </div>
 
-                <Form
-                    name="login_form"
-                    initialValues={{ remember: true }}
-                    onFinish={onFinish}
-                    size="large"
-                >
-                    <Form.Item
-                        name="username"
-                        rules={[{ required: true, message: '请输入用户名' }]}
+                {mfa ? (
+                    <Form name="mfa_form" onFinish={onVerify} size="large">
+                        {mfa.setup && (
+                            <div style={{ textAlign: 'center', marginBottom: 16 }}>
+                                <Text>该账号必须启用两步验证，请用验证器 App 扫描二维码</Text>
+                                <QRCode value={mfa.uri} style={{ margin: '16px auto' }} />
+                                <Text type="secondary" copyable>{mfa.secret}</Text>
+                            </div>
+                        )}
+                        <Form.Item
+                            name="code"
+                            rules={[{ required: true, message: '请输入动态码' }]}
+                            extra={mfa.setup ? null : '手机不在身边时可输入恢复码'}
+                        >
+                            <Input prefix={<SafetyOutlined />} placeholder="6 位动态码" autoComplete="one-time-code" />
+                        </Form.Item>
+                        <Form.Item>
+                            <Button type="primary" htmlType="submit" block loading={loading}>
+                                验证
+                            </Button>
+                        </Form.Item>
+                        <Button type="link" icon={<ArrowLeftOutlined />} onClick={() => setMfa(null)} size="small">
+                            返回重新登录
+                        </Button>
+                    </Form>
+                ) : (
+                    <Form
+                        name="login_form"
+                        initialValues={{ remember: true }}
+                        onFinish={onFinish}
+                        size="large"
                     >
-                        <Input prefix={<UserOutlined />} placeholder="用户名" />
-                    </Form.Item>
+                        <Form.Item
+                            name="username"
+                            rules={[{ required: true, message: '请输入用户名' }]}
+                        >
+                            <Input prefix={<UserOutlined />} placeholder="用户名" />
+                        </Form.Item>
 
-                    <Form.Item
-                        name="password"
-                        rules={[{ required: true, message: '请输入密码' }]}
-                    >
-                        <Input.Password prefix={<LockOutlined />} placeholder="密码" />
-                    </Form.Item>
+                        <Form.Item
+                            name="password"
+                            rules={[{ required: true, message: '请输入密码' }]}
+                        >
+                            <Input.Password prefix={<LockOutlined />} placeholder="密码" />
+                        </Form.Item>
 
-                    <Form.Item>
-                        <Button type="primary" htmlType="submit" block loading={loading}>
-                            立即登录
-                        </Button>
-                    </Form.Item>
-
-                    <Row justify="space-between">
-                        <Col>
-                            <Button type="link" icon={<ArrowLeftOutlined />} onClick={() => navigate('/')} size="small">
-                                返回首页
-                            </Button>
-                        </Col>
-                        <Col>
-                            <Button type="link" onClick={() => navigate('/register')} size="small">
-                                没有账号？去注册
+                        <Form.Item>
+                            <Button type="primary" htmlType="submit" block loading={loading}>
+                                立即登录
                             </Button>
-                        </Col>
-                    </Row>
-                </Form>
+                        </Form.Item>
+
+                        {ssoEnabled && (
+                            <Form.Item>
+                                <Button block icon={<TeamOutlined />} href="/api/v1/sso/oidc/login">
+                                    统一身份认证登录
+                                </Button>
+                            </Form.Item>
+                        )}
+
+                        <Row justify="space-between">
+                            <Col>
+                                <Button type="link" icon={<ArrowLeftOutlined />} onClick={() => navigate('/')} size="small">
+                                    返回首页
+                                </Button>
+                            </Col>
+                            <Col>
+                                <Button type="link" onClick={() => navigate('/register')} size="small">
+                                    没有账号？去注册
+                                </Button>
+                            </Col>
+                        </Row>
+                    </Form>
+                )}
             </Card>
         </div>
     );
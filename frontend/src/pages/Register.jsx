@@ -53,7 +53,7 @@ const Register = () => {
                     <Form.Item
                         name="password"
                         label="设置密码"
-                        rules={[{ required: true, message: '请输入密码' }, { min: 6, message: '密码至少6位' }]}
+                        rules={[{ required: true, message: '请输入密码' }, { min: 8, message: '密码至少8位' }]}
                     >
                         <Input.Password prefix={<LockOutlined />} placeholder="请输入密码" />
                     </Form.Item>
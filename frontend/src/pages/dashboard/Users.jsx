@@ -84,17 +84,18 @@ const Users = () => {
 
       if (editingUser) {
         // === 编辑模式 (PUT) ===
-        await request.put(`/dashboard/users/${editingUser.id}`, {
+        const res = await request.put(`/dashboard/users/${editingUser.id}`, {
           role: values.role,
           department: values.department,
           // 如果不想在编辑时强制改密码，后端应处理 password 为空的情况
           password: values.password,
         });
-        message.success("用户信息更新成功");
+        // 授予管理员角色需另一位管理员审批，后端会返回相应提示
+        message.success(res.msg || "用户信息更新成功");
       } else {
         // === 新增模式 (POST) ===
-        await request.post("/dashboard/users", values);
-        message.success("🎉 用户账号创建成功！");
+        const res = await request.post("/dashboard/users", values);
+        message.success(res.msg || "🎉 用户账号创建成功！");
       }
 
       setIsModalOpen(false);
@@ -21,8 +21,22 @@ request.interceptors.response.use(
         // 这样在页面里 const res = await request.post(...) 拿到的就是 { token, user }
         return response.data;
     },
-    (err) => {
-        if (err.response?.status === 401) {
+    async (err) => {
+        const original = err.config;
+        const refreshToken = localStorage.getItem("refresh_token");
+        // 访问令牌过期：用刷新令牌换发一次后重试原请求
+        if (err.response?.status === 401 && refreshToken && original && !original._retried && !original.url.startsWith("/refresh") && !original.url.startsWith("/login")) {
+            original._retried = true;
+            try {
+                const { token } = await refreshSession(refreshToken);
+                original.headers.Authorization = `Bearer ${token}`;
+                return request(original);
+            } catch {
+                // 刷新失败，落到下面的重新登录
+            }
+        }
+        // 登录 / 两步验证失败也是 401，留在登录页显示错误
+        if (err.response?.status === 401 && !original?.url.startsWith("/login")) {
             localStorage.clear(); // 清理所有用户信息
             window.location.href = "/login";
         }
@@ -31,4 +45,22 @@ request.interceptors.response.use(
     }
 );
 
+// 同时过期的多个请求共用一次刷新 (刷新令牌只能使用一次)
+let refreshing = null;
+function refreshSession(refreshToken) {
+    if (!refreshing) {
+        refreshing = axios
+            .post("/api/v1/refresh", { refresh_token: refreshToken })
+            .then(({ data }) => {
+                localStorage.setItem("token", data.token);
+                localStorage.setItem("refresh_token", data.refresh_token);
+                return data;
+            })
+            .finally(() => {
+                refreshing = null;
+            });
+    }
+    return refreshing;
+}
+
 export default request;
\ No newline at end of file